@@ -0,0 +1,678 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/keystore"
+	"txt-encdec-cli/platform"
+)
+
+const (
+	ExitOK               = 0
+	ExitFailure          = 1
+	ExitUsage            = 2
+	ExitDecryptionFailed = 3
+	ExitInvalidInput     = 4
+	ExitNoSecret         = 5
+)
+
+var ErrUsage = errors.New("usage error")
+
+type App struct {
+	Name    string
+	Version string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	Cipher   core.AlgorithmID
+	Armor    bool
+	Encoding string
+	KDF      core.KDFParams
+	OpenSSL  core.OpenSSLParams
+	Packing  core.Packing
+	Keys     *keystore.Store
+
+	Clipboard platform.ClipboardOptions
+
+	// Keyfiles and Challenge are the configured secret factors; -keyfile
+	// and -challenge replace them.
+	Keyfiles  []string
+	Challenge string
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(a *App, args []string) error
+}
+
+var commands = []command{
+	{"encrypt", "encrypt text from arguments, a file or stdin", (*App).runEncrypt},
+	{"decrypt", "decrypt ciphertext from arguments, a file or stdin", (*App).runDecrypt},
+	{"keygen", "generate an identity in the key store and print its public key", (*App).runKeygen},
+	{"keys", "list the key store, or add a recipient with 'keys add name key'", (*App).runKeys},
+	{"doctor", "check which clipboard backends work here", (*App).runDoctor},
+	{"version", "print the version and exit", (*App).runVersion},
+	{"help", "show this help", nil},
+}
+
+func IsCommand(name string) bool {
+	if name == "-h" || name == "--help" {
+		return true
+	}
+	_, ok := findCommand(name)
+	return ok
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func (a *App) Run(args []string) int {
+	if len(args) == 0 {
+		a.printUsage(a.Stderr)
+		return ExitUsage
+	}
+
+	name := args[0]
+	if name == "-h" || name == "--help" {
+		name = "help"
+	}
+
+	if name == "help" {
+		a.printUsage(a.Stdout)
+		return ExitOK
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(a.Stderr, "%s: unknown command %q\n\n", a.Name, args[0])
+		a.printUsage(a.Stderr)
+		return ExitUsage
+	}
+
+	if err := cmd.run(a, args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		fmt.Fprintf(a.Stderr, "%s %s: %v\n", a.Name, cmd.name, err)
+		return ExitCode(err)
+	}
+
+	return ExitOK
+}
+
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUsage):
+		return ExitUsage
+	case errors.Is(err, core.ErrDecryptionFailed), errors.Is(err, core.ErrContextMismatch):
+		return ExitDecryptionFailed
+	case errors.Is(err, core.ErrInvalidBase64),
+		errors.Is(err, core.ErrInvalidEncoding),
+		errors.Is(err, core.ErrInvalidCiphertext),
+		errors.Is(err, core.ErrTruncatedHeader),
+		errors.Is(err, core.ErrUnknownVersion),
+		errors.Is(err, core.ErrUnsupportedAlgorithm),
+		errors.Is(err, core.ErrUnsupportedKDF),
+		errors.Is(err, core.ErrInvalidKDF),
+		errors.Is(err, core.ErrUnsupportedPacking),
+		errors.Is(err, core.ErrRecipientEnvelope),
+		errors.Is(err, core.ErrPassphraseEnvelope),
+		errors.Is(err, core.ErrNotAge),
+		errors.Is(err, core.ErrNotOpenSSL),
+		errors.Is(err, core.ErrDamagedArmor):
+		return ExitInvalidInput
+	case errors.Is(err, core.ErrInvalidRecipient),
+		errors.Is(err, core.ErrInvalidIdentity),
+		errors.Is(err, core.ErrTooManyRecipients),
+		errors.Is(err, keystore.ErrKeyNotFound),
+		errors.Is(err, keystore.ErrInvalidName),
+		errors.Is(err, keystore.ErrKeyExists),
+		errors.Is(err, core.ErrInvalidOpenSSL),
+		errors.Is(err, core.ErrInvalidContext),
+		errors.Is(err, core.ErrContextUnsupported):
+		return ExitUsage
+	case errors.Is(err, ErrNoSecret),
+		errors.Is(err, ErrSecretMismatch),
+		errors.Is(err, core.ErrKeyfile),
+		errors.Is(err, core.ErrChallengeResponse):
+		return ExitNoSecret
+	default:
+		return ExitFailure
+	}
+}
+
+type ioOptions struct {
+	in      string
+	out     string
+	secret  SecretSource
+	keys    stringList
+	openssl opensslOptions
+}
+
+// opensslOptions overrides the configured openssl enc parameters, with
+// flags named after openssl's own.
+type opensslOptions struct {
+	params core.OpenSSLParams
+	legacy bool
+	iter   bool
+}
+
+// resolve applies openssl's rule that -iter implies -pbkdf2.
+func (o opensslOptions) resolve() (core.OpenSSLParams, error) {
+	params := o.params
+	switch {
+	case o.legacy && o.iter:
+		return params, fmt.Errorf("%w: -openssl-iter and -openssl-legacy are mutually exclusive", ErrUsage)
+	case o.legacy:
+		params.PBKDF2 = false
+	case o.iter:
+		params.PBKDF2 = true
+	}
+	return params, params.Validate()
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (a *App) newFlagSet(name string, opts *ioOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+
+	fs.StringVar(&opts.in, "in", "", "read input from `file` (\"-\" for stdin)")
+	fs.StringVar(&opts.out, "out", "", "write output to `file` instead of stdout")
+	fs.StringVar(&opts.secret.Env, "secret-env", "", "read the secret from environment variable `name`")
+	fs.IntVar(&opts.secret.FD, "secret-fd", 0, "read the secret from file descriptor `n`")
+	fs.StringVar(&opts.secret.File, "secret-file", "", "read the secret from `file`")
+	opts.secret.Keyfiles = a.Keyfiles
+	fs.Func("keyfile", "combine the secret with `file` (repeatable; replaces configured keyfiles)", func(path string) error {
+		if !flagSet(fs, "keyfile") {
+			opts.secret.Keyfiles = nil
+		}
+		opts.secret.Keyfiles = append(opts.secret.Keyfiles, path)
+		return nil
+	})
+	fs.StringVar(&opts.secret.Challenge, "challenge", a.Challenge, "combine the secret with a challenge-response `provider:arg` ("+challengeProviderNames()+")")
+
+	opts.openssl.params = a.OpenSSL
+	fs.StringVar(&opts.openssl.params.Cipher, "openssl-cipher", a.OpenSSL.Cipher, "openssl enc `cipher` ("+strings.Join(core.OpenSSLCiphers(), ", ")+")")
+	fs.StringVar(&opts.openssl.params.Digest, "openssl-md", a.OpenSSL.Digest, "openssl enc `digest` for key derivation ("+strings.Join(core.OpenSSLDigests(), ", ")+")")
+	fs.Func("openssl-iter", "openssl enc PBKDF2 `iterations` (implies PBKDF2)", func(value string) error {
+		n, err := strconv.Atoi(value)
+		opts.openssl.params.Iterations, opts.openssl.iter = n, true
+		return err
+	})
+	fs.BoolVar(&opts.openssl.legacy, "openssl-legacy", false, "derive openssl enc keys with EVP_BytesToKey instead of PBKDF2")
+
+	fs.Usage = func() {
+		fmt.Fprintf(a.Stderr, "Usage: %s %s [flags] [text...]\n\n", a.Name, name)
+		fmt.Fprintf(a.Stderr, "Without text or -in, input is read from stdin.\n")
+		fmt.Fprintf(a.Stderr, "Without a secret flag, the secret is prompted for on /dev/tty.\n\n")
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+func (a *App) runEncrypt(args []string) error {
+	var opts ioOptions
+	var kdfName string
+	var cipherName string
+	var formatName string
+	var context string
+	var armor bool
+	var encodingName string
+	var compressName string
+	var padName string
+
+	fs := a.newFlagSet("encrypt", &opts)
+	fs.StringVar(&context, "context", "", "bind the ciphertext to context `label` (stored in the clear, authenticated)")
+	fs.BoolVar(&armor, "armor", a.Armor, "wrap native output in BEGIN/END armor with 64-column lines and a checksum")
+	fs.StringVar(&encodingName, "encoding", a.encoding(), "native output `encoding`: "+encodingNames())
+	fs.StringVar(&compressName, "compress", a.Packing.Compression.String(), "native `compression` for texts of at least packing.min_compress_size bytes: none or deflate")
+	fs.StringVar(&padName, "pad", a.Packing.Padding.String(), "native `padding` hiding the plaintext length: none, padme or bucket")
+	fs.StringVar(&kdfName, "kdf", "", "key derivation `function` (argon2id or scrypt; default from config)")
+	fs.StringVar(&cipherName, "cipher", "", "AEAD `suite` ("+suiteNames()+"; default from config)")
+	fs.StringVar(&formatName, "format", core.FormatNative.String(), "output `format`: native, age (armored, readable by age -d) or openssl (unauthenticated, readable by openssl enc -d -base64)")
+	fs.Var(&opts.keys, "r", "encrypt to `recipient` (key store name, public key or file; repeatable) instead of a secret")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	format, err := core.FormatByName(formatName)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if format != core.FormatNative && cipherName != "" {
+		return fmt.Errorf("%w: -cipher does not apply to %s output", ErrUsage, format)
+	}
+	if format == core.FormatOpenSSL && (kdfName != "" || len(opts.keys) > 0) {
+		return fmt.Errorf("%w: openssl output only supports a secret and the -openssl-* flags", ErrUsage)
+	}
+
+	encoding, err := core.EncodingByName(encodingName)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if format != core.FormatNative && flagSet(fs, "encoding") {
+		return fmt.Errorf("%w: -encoding does not apply to %s output", ErrUsage, format)
+	}
+	if armor && encoding.Name != core.EncodingBase64 {
+		return fmt.Errorf("%w: -armor requires base64 encoding", ErrUsage)
+	}
+
+	packing, err := a.packing(compressName, padName)
+	if err != nil {
+		return err
+	}
+	if format != core.FormatNative && (flagSet(fs, "compress") || flagSet(fs, "pad")) {
+		return fmt.Errorf("%w: -compress and -pad do not apply to %s output", ErrUsage, format)
+	}
+
+	cipher, err := a.cipherByName(cipherName)
+	if err != nil {
+		return err
+	}
+
+	kdf, err := a.kdfByName(kdfName)
+	if err != nil {
+		return err
+	}
+	if format == core.FormatAge && kdfName != "" && kdf.ID != core.KDFScrypt {
+		return fmt.Errorf("%w: age passphrases only use scrypt", ErrUsage)
+	}
+
+	input, err := a.readInput(opts.in, fs.Args())
+	if err != nil {
+		return err
+	}
+	if input == "" {
+		return fmt.Errorf("%w: nothing to encrypt", ErrUsage)
+	}
+
+	var cryptor core.Cryptor
+	if len(opts.keys) > 0 {
+		recipients, err := a.recipients(opts.keys)
+		if err != nil {
+			return err
+		}
+		if format == core.FormatAge {
+			if cryptor, err = core.NewAgeRecipientCryptor(recipients, nil); err != nil {
+				return err
+			}
+		} else {
+			cryptor = core.NewRecipientCryptor(cipher, recipients, nil).WithPacking(packing)
+		}
+	} else {
+		secret, err := opts.secret.Resolve(true)
+		if err != nil {
+			return err
+		}
+		switch format {
+		case core.FormatAge:
+			if cryptor, err = core.NewAgePassphraseCryptor(secret, core.AgeWorkFactor(kdf)); err != nil {
+				return err
+			}
+		case core.FormatOpenSSL:
+			if cryptor, err = a.opensslCryptor(secret, opts.openssl); err != nil {
+				return err
+			}
+		default:
+			cryptor = core.NewCryptor(secret, cipher, kdf).WithPacking(packing)
+		}
+	}
+
+	result, err := core.EncryptContext(cryptor, input, context)
+	if err != nil {
+		return err
+	}
+	if format == core.FormatNative {
+		if armor {
+			result, err = core.ArmorCiphertext(result, time.Now())
+		} else if encoding.Name != core.EncodingBase64 {
+			result, err = core.EncodeCiphertext(result, encoding)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.writeOutput(opts.out, result+"\n")
+}
+
+func (a *App) runDecrypt(args []string) error {
+	var opts ioOptions
+
+	var context string
+
+	fs := a.newFlagSet("decrypt", &opts)
+	fs.StringVar(&context, "context", "", "fail unless the ciphertext is bound to context `label`")
+	fs.Var(&opts.keys, "i", "decrypt with `identity` (key store name or file; repeatable) instead of a secret")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	input, err := a.readInput(opts.in, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return fmt.Errorf("%w: nothing to decrypt", ErrUsage)
+	}
+
+	format := core.DetectFormat(input)
+	if format == core.FormatOpenSSL && len(opts.keys) > 0 {
+		return fmt.Errorf("%w: openssl enc ciphertext is decrypted with a secret, not -i", ErrUsage)
+	}
+
+	var cryptor core.Cryptor
+	if len(opts.keys) > 0 {
+		identities, err := a.identities(opts.keys)
+		if err != nil {
+			return err
+		}
+		if format == core.FormatAge {
+			if cryptor, err = core.NewAgeRecipientCryptor(nil, identities); err != nil {
+				return err
+			}
+		} else {
+			cryptor = core.NewRecipientCryptor(a.Cipher, nil, identities)
+		}
+	} else {
+		secret, err := opts.secret.Resolve(false)
+		if err != nil {
+			return err
+		}
+		switch format {
+		case core.FormatAge:
+			if cryptor, err = core.NewAgePassphraseCryptor(secret, 0); err != nil {
+				return err
+			}
+		case core.FormatOpenSSL:
+			if cryptor, err = a.opensslCryptor(secret, opts.openssl); err != nil {
+				return err
+			}
+		default:
+			cryptor = core.NewCryptor(secret, a.Cipher, a.KDF)
+		}
+	}
+
+	result, err := core.DecryptContext(cryptor, input, context)
+	if err != nil {
+		return err
+	}
+
+	if env, err := core.InspectCiphertext(input); err == nil && env.Context != "" {
+		fmt.Fprintf(a.Stderr, "%s: context: %s\n", a.Name, env.Context)
+	}
+	return a.writeOutput(opts.out, result)
+}
+
+// opensslCryptor warns on stderr every time it is used, since openssl enc
+// ciphertexts carry no authentication tag.
+func (a *App) opensslCryptor(secret string, opts opensslOptions) (core.Cryptor, error) {
+	params, err := opts.resolve()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(a.Stderr, "%s: warning: openssl enc (%s) is unauthenticated; tampering is not detected\n", a.Name, params)
+	return core.NewOpenSSLCryptor(secret, params), nil
+}
+
+func (a *App) runKeygen(args []string) error {
+	var name string
+
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	fs.StringVar(&name, "name", "default", "store the identity as `name`")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", ErrUsage, fs.Arg(0))
+	}
+
+	identity, err := a.Keys.Generate(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Stderr, "identity written to %s\n", filepath.Join(a.Keys.Dir, name+keystore.IdentityExt))
+	fmt.Fprintf(a.Stderr, "age recipient: %s\n", identity.Recipient().AgeString())
+	fmt.Fprintln(a.Stdout, identity.Recipient())
+	return nil
+}
+
+func (a *App) runKeys(args []string) error {
+	if len(args) > 0 {
+		if args[0] != "add" || len(args) != 3 {
+			return fmt.Errorf("%w: usage: keys [add name public-key]", ErrUsage)
+		}
+
+		recipient, err := core.ParseRecipient(args[2])
+		if err != nil {
+			return err
+		}
+		return a.Keys.AddRecipient(args[1], recipient)
+	}
+
+	identities, err := a.Keys.Identities()
+	if err != nil {
+		return err
+	}
+	recipients, err := a.Keys.Recipients()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.Stdout, "Key store: %s\n\nIdentities:\n", a.Keys.Dir)
+	for _, entry := range identities {
+		fmt.Fprintf(a.Stdout, "  %s\n", entry.Name)
+	}
+	fmt.Fprintf(a.Stdout, "\nRecipients:\n")
+	for _, entry := range recipients {
+		recipient, err := a.Keys.Recipient(entry.Name)
+		if err != nil {
+			fmt.Fprintf(a.Stdout, "  %-16s (%v)\n", entry.Name, err)
+			continue
+		}
+		fmt.Fprintf(a.Stdout, "  %-16s %s\n", entry.Name, recipient)
+	}
+	return nil
+}
+
+func (a *App) recipients(names []string) ([]*core.Recipient, error) {
+	recipients := make([]*core.Recipient, len(names))
+	for i, name := range names {
+		r, err := a.Keys.Recipient(name)
+		if err != nil {
+			return nil, err
+		}
+		recipients[i] = r
+	}
+	return recipients, nil
+}
+
+func (a *App) identities(names []string) ([]*core.Identity, error) {
+	identities := make([]*core.Identity, len(names))
+	for i, name := range names {
+		identity, err := a.Keys.Identity(name)
+		if err != nil {
+			return nil, err
+		}
+		identities[i] = identity
+	}
+	return identities, nil
+}
+
+func (a *App) runVersion(args []string) error {
+	fmt.Fprintf(a.Stdout, "%s %s\n", a.Name, a.Version)
+	return nil
+}
+
+func (a *App) printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [--config file] [command] [flags]\n\n", a.Name)
+	fmt.Fprintf(w, "Without a command, the interactive interface is started.\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nExit codes: %d ok, %d failure, %d usage, %d decryption failed, %d invalid input, %d no secret\n",
+		ExitOK, ExitFailure, ExitUsage, ExitDecryptionFailed, ExitInvalidInput, ExitNoSecret)
+}
+
+func (a *App) readInput(path string, args []string) (string, error) {
+	if path != "" && len(args) > 0 {
+		return "", fmt.Errorf("%w: use either -in or text arguments, not both", ErrUsage)
+	}
+
+	if len(args) > 0 {
+		return strings.Join(args, " "), nil
+	}
+
+	var r io.Reader = a.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	return string(data), nil
+}
+
+func (a *App) writeOutput(path, data string) error {
+	if path == "" || path == "-" {
+		_, err := io.WriteString(a.Stdout, data)
+		return err
+	}
+
+	return os.WriteFile(path, []byte(data), 0o600)
+}
+
+func (a *App) kdfByName(name string) (core.KDFParams, error) {
+	if a.KDF.ID != core.KDFLegacySHA256 && (name == "" || name == a.KDF.ID.String()) {
+		return a.KDF, nil
+	}
+	if name == "" {
+		name = core.KDFArgon2id.String()
+	}
+
+	switch name {
+	case core.KDFArgon2id.String():
+		return core.DefaultArgon2idParams(), nil
+	case core.KDFScrypt.String():
+		return core.DefaultScryptParams(), nil
+	default:
+		return core.KDFParams{}, fmt.Errorf("%w: unknown kdf %q", ErrUsage, name)
+	}
+}
+
+func (a *App) cipherByName(name string) (core.AlgorithmID, error) {
+	if name == "" {
+		if a.Cipher == 0 {
+			return core.AlgAES256GCM, nil
+		}
+		return a.Cipher, nil
+	}
+
+	cipher, err := core.AlgorithmByName(name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	return cipher, nil
+}
+
+func suiteNames() string {
+	var names []string
+	for _, suite := range core.Suites() {
+		names = append(names, suite.ID.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (a *App) packing(compressName, padName string) (core.Packing, error) {
+	p := a.Packing
+	var err error
+	if p.Compression, err = core.CompressionByName(compressName); err != nil {
+		return core.Packing{}, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if p.Padding, err = core.PaddingByName(padName); err != nil {
+		return core.Packing{}, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	return p, nil
+}
+
+func challengeProviderNames() string {
+	var names []string
+	for _, p := range core.ChallengeProviders() {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func encodingNames() string {
+	var names []string
+	for _, enc := range core.Encodings() {
+		names = append(names, enc.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// encoding is the configured native output encoding, base64 when unset.
+func (a *App) encoding() string {
+	if a.Encoding == "" {
+		return core.EncodingBase64
+	}
+	return a.Encoding
+}
+
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func usageError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrUsage, err)
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/keystore"
+)
+
+var testKDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func run(t *testing.T, stdin string, args ...string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	app := &App{
+		Name:   "enc",
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Cipher: core.AlgAES256GCM,
+		KDF:    testKDF,
+		Keys:   keystore.New(t.TempDir()),
+	}
+	code := app.Run(args)
+	return result{code, stdout.String(), stderr.String()}
+}
+
+func encrypt(t *testing.T, plaintext string, args ...string) string {
+	t.Helper()
+	r := run(t, plaintext, append([]string{"encrypt"}, args...)...)
+	if r.code != ExitOK {
+		t.Fatalf("encrypt %v = %d: %s", args, r.code, r.stderr)
+	}
+	return strings.TrimSpace(r.stdout)
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, ExitOK},
+		{fmt.Errorf("%w: bad flag", ErrUsage), ExitUsage},
+		{fmt.Errorf("%w: cipher: message authentication failed", core.ErrDecryptionFailed), ExitDecryptionFailed},
+		{core.ErrContextMismatch, ExitDecryptionFailed},
+		{fmt.Errorf("%w at position 3", core.ErrInvalidBase64), ExitInvalidInput},
+		{core.ErrTruncatedHeader, ExitInvalidInput},
+		{core.ErrInvalidContext, ExitUsage},
+		{fmt.Errorf("%w: secret is empty", ErrNoSecret), ExitNoSecret},
+		{ErrSecretMismatch, ExitNoSecret},
+		{errors.New("disk full"), ExitFailure},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTripInputs(t *testing.T) {
+	t.Setenv("ENC_TEST_SECRET", "hunter2")
+	dir := t.TempDir()
+
+	encoded := encrypt(t, "from stdin", "-secret-env", "ENC_TEST_SECRET")
+	in := filepath.Join(dir, "blob.txt")
+	if err := os.WriteFile(in, []byte(encoded+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  string
+	}{
+		{"stdin", encoded + "\n", []string{"-secret-env", "ENC_TEST_SECRET"}, "from stdin"},
+		{"stdin dash", encoded, []string{"-secret-env", "ENC_TEST_SECRET", "-in", "-"}, "from stdin"},
+		{"in file", "", []string{"-secret-env", "ENC_TEST_SECRET", "-in", in}, "from stdin"},
+		{"argument", "", []string{"-secret-env", "ENC_TEST_SECRET", encoded}, "from stdin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := run(t, tt.stdin, append([]string{"decrypt"}, tt.args...)...)
+			if r.code != ExitOK || r.stdout != tt.want {
+				t.Fatalf("decrypt = %d, %q (%s), want %q", r.code, r.stdout, r.stderr, tt.want)
+			}
+		})
+	}
+
+	joined := encrypt(t, "", "-secret-env", "ENC_TEST_SECRET", "two", "words")
+	if r := run(t, "", "decrypt", "-secret-env", "ENC_TEST_SECRET", joined); r.stdout != "two words" {
+		t.Fatalf("arguments were encrypted as %q, want %q", r.stdout, "two words")
+	}
+
+	out := filepath.Join(dir, "plain.txt")
+	if r := run(t, encoded, "decrypt", "-secret-env", "ENC_TEST_SECRET", "-out", out); r.code != ExitOK || r.stdout != "" {
+		t.Fatalf("decrypt -out = %d, stdout %q", r.code, r.stdout)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "from stdin" {
+		t.Fatalf("-out file = %q, %v", data, err)
+	}
+}
+
+func TestSecretSources(t *testing.T) {
+	t.Setenv("ENC_TEST_SECRET", "hunter2")
+	dir := t.TempDir()
+
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("hunter2\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyfile := filepath.Join(dir, "key.bin")
+	if err := os.WriteFile(keyfile, []byte{0, 1, 2, 3}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := encrypt(t, "hello", "-secret-file", secretFile)
+	if r := run(t, encoded, "decrypt", "-secret-env", "ENC_TEST_SECRET"); r.code != ExitOK || r.stdout != "hello" {
+		t.Fatalf("-secret-env after -secret-file = %d, %q (%s)", r.code, r.stdout, r.stderr)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.WriteString("hunter2\n")
+	pw.Close()
+	if r := run(t, encoded, "decrypt", "-secret-fd", fmt.Sprint(pr.Fd())); r.code != ExitOK || r.stdout != "hello" {
+		t.Fatalf("-secret-fd = %d, %q (%s)", r.code, r.stdout, r.stderr)
+	}
+
+	withKeyfile := encrypt(t, "hello", "-secret-env", "ENC_TEST_SECRET", "-keyfile", keyfile)
+	if r := run(t, withKeyfile, "decrypt", "-secret-env", "ENC_TEST_SECRET", "-keyfile", keyfile); r.code != ExitOK || r.stdout != "hello" {
+		t.Fatalf("-keyfile = %d, %q (%s)", r.code, r.stdout, r.stderr)
+	}
+	if r := run(t, withKeyfile, "decrypt", "-secret-env", "ENC_TEST_SECRET"); r.code != ExitDecryptionFailed {
+		t.Fatalf("decrypt without the keyfile = %d, want %d", r.code, ExitDecryptionFailed)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Setenv("ENC_TEST_SECRET", "hunter2")
+	t.Setenv("ENC_TEST_WRONG", "hunter3")
+	t.Setenv("ENC_TEST_EMPTY", "")
+	encoded := encrypt(t, "hello", "-secret-env", "ENC_TEST_SECRET")
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{"no command", "", nil, ExitUsage},
+		{"unknown command", "", []string{"frobnicate"}, ExitUsage},
+		{"help", "", []string{"help"}, ExitOK},
+		{"unknown flag", "", []string{"encrypt", "-frobnicate"}, ExitUsage},
+		{"in and arguments", "", []string{"encrypt", "-secret-env", "ENC_TEST_SECRET", "-in", "x", "text"}, ExitUsage},
+		{"nothing to encrypt", "", []string{"encrypt", "-secret-env", "ENC_TEST_SECRET"}, ExitUsage},
+		{"nothing to decrypt", " \n", []string{"decrypt", "-secret-env", "ENC_TEST_SECRET"}, ExitUsage},
+		{"wrong secret", encoded, []string{"decrypt", "-secret-env", "ENC_TEST_WRONG"}, ExitDecryptionFailed},
+		{"context mismatch", encoded, []string{"decrypt", "-secret-env", "ENC_TEST_SECRET", "-context", "prod"}, ExitDecryptionFailed},
+		{"invalid base64", "not*base64", []string{"decrypt", "-secret-env", "ENC_TEST_SECRET"}, ExitInvalidInput},
+		{"empty secret", encoded, []string{"decrypt", "-secret-env", "ENC_TEST_EMPTY"}, ExitNoSecret},
+		{"unset secret", encoded, []string{"decrypt", "-secret-env", "ENC_TEST_UNSET"}, ExitNoSecret},
+		{"missing secret file", encoded, []string{"decrypt", "-secret-file", "/nonexistent/secret"}, ExitNoSecret},
+		{"missing keyfile", "hello", []string{"encrypt", "-secret-env", "ENC_TEST_SECRET", "-keyfile", "/nonexistent/key"}, ExitNoSecret},
+		{"missing input file", "", []string{"decrypt", "-secret-env", "ENC_TEST_SECRET", "-in", "/nonexistent/blob"}, ExitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := run(t, tt.stdin, tt.args...); r.code != tt.want {
+				t.Fatalf("Run(%q) = %d, want %d (%s)", tt.args, r.code, tt.want, r.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"txt-encdec-cli/platform"
+)
+
+// runDoctor reports which clipboard backends this environment allows and
+// whether each one round-trips a copy, marking the one copies will use.
+func (a *App) runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.Stderr, "Usage: %s doctor\n\nChecks every clipboard backend by copying a test marker, reading it back and\nemptying the clipboard again; whatever the clipboard held is lost.\n", a.Name)
+	}
+	if err := fs.Parse(args); err != nil {
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", ErrUsage, fs.Arg(0))
+	}
+
+	fmt.Fprintf(a.Stdout, "Environment: %s\n", platform.CurrentClipboardEnv())
+	fmt.Fprintf(a.Stdout, "Backend: %s , target: %s\n\n", a.Clipboard.Backend, a.Clipboard.Target.Label())
+
+	checks := platform.DiagnoseClipboard(a.Clipboard)
+	var chosen *platform.ClipboardCheck
+	for i, check := range checks {
+		mark := " "
+		if check.Chosen {
+			mark, chosen = "*", &checks[i]
+		}
+		fmt.Fprintf(a.Stdout, "%s %-8s %-12s %-24s %s\n", mark, check.Name, check.Status(), check.Latency(), check.Detail)
+		if check.Err != nil {
+			for _, line := range strings.Split(check.Err.Error(), "\n") {
+				fmt.Fprintf(a.Stdout, "  %-8s %s\n", "", line)
+			}
+		}
+	}
+
+	switch {
+	case chosen == nil:
+		return fmt.Errorf("%w: no backend is available for %q", platform.ErrNoClipboardTool, a.Clipboard.Backend)
+	case chosen.Verified:
+		fmt.Fprintf(a.Stdout, "\nCopies use %s.\n", chosen.Name)
+		return nil
+	case chosen.Copied && chosen.Backend == platform.ClipboardOSC52:
+		fmt.Fprintf(a.Stdout, "\nCopies use %s; the terminal does not let them be read back to verify.\n", chosen.Name)
+		return nil
+	default:
+		return fmt.Errorf("%w: %s, the backend copies use, did not pass", platform.ErrClipboardFailed, chosen.Name)
+	}
+}
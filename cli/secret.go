@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"txt-encdec-cli/core"
+
+	"golang.org/x/term"
+)
+
+var (
+	ErrNoSecret       = errors.New("no secret provided")
+	ErrSecretMismatch = errors.New("secrets do not match")
+)
+
+type SecretSource struct {
+	Env  string
+	FD   int
+	File string
+
+	// Keyfiles and Challenge are combined with the passphrase, so that the
+	// passphrase alone is not enough; see core.SecretFactors.
+	Keyfiles  []string
+	Challenge string
+}
+
+func (s SecretSource) Resolve(confirm bool) (string, error) {
+	factors, err := s.factors()
+	if err != nil {
+		return "", err
+	}
+
+	passphrase, err := s.passphrase(confirm)
+	if err != nil {
+		return "", err
+	}
+	return factors.Compose(passphrase)
+}
+
+// factors opens the challenge-response provider before any prompt, so a
+// missing token is reported first.
+func (s SecretSource) factors() (core.SecretFactors, error) {
+	factors := core.SecretFactors{Keyfiles: s.Keyfiles}
+	if s.Challenge != "" {
+		responder, err := core.OpenChallengeResponder(s.Challenge)
+		if err != nil {
+			return factors, err
+		}
+		factors.Responder = responder
+	}
+	return factors, nil
+}
+
+func (s SecretSource) passphrase(confirm bool) (string, error) {
+	switch {
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok || value == "" {
+			return "", fmt.Errorf("%w: environment variable %s is empty", ErrNoSecret, s.Env)
+		}
+		return value, nil
+
+	case s.FD > 0:
+		f := os.NewFile(uintptr(s.FD), fmt.Sprintf("fd%d", s.FD))
+		if f == nil {
+			return "", fmt.Errorf("%w: invalid file descriptor %d", ErrNoSecret, s.FD)
+		}
+		defer f.Close()
+		return readSecret(f)
+
+	case s.File != "":
+		f, err := os.Open(s.File)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrNoSecret, err)
+		}
+		defer f.Close()
+		return readSecret(f)
+
+	default:
+		return promptSecret(confirm)
+	}
+}
+
+func readSecret(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoSecret, err)
+	}
+
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return "", fmt.Errorf("%w: secret is empty", ErrNoSecret)
+	}
+
+	return string(data), nil
+}
+
+func promptSecret(confirm bool) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("%w: no terminal available for prompt", ErrNoSecret)
+	}
+	defer tty.Close()
+
+	secret, err := readPassword(tty, "Secret key: ")
+	if err != nil {
+		return "", err
+	}
+
+	if confirm {
+		again, err := readPassword(tty, "Confirm secret key: ")
+		if err != nil {
+			return "", err
+		}
+		if again != secret {
+			return "", ErrSecretMismatch
+		}
+	}
+
+	return secret, nil
+}
+
+func readPassword(tty *os.File, prompt string) (string, error) {
+	fmt.Fprint(tty, prompt)
+	data, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoSecret, err)
+	}
+
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%w: secret is empty", ErrNoSecret)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,525 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/platform"
+	"txt-encdec-cli/vault"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	AppDirName  = "txt-encdec-cli"
+	FileName    = "config.toml"
+	KeysDirName = "keys"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid configuration")
+	ErrUnknownKey    = errors.New("unknown configuration key")
+)
+
+type Config struct {
+	Cipher    string          `toml:"cipher"`
+	Armor     bool            `toml:"armor"`
+	Encoding  string          `toml:"encoding"`
+	KeyStore  string          `toml:"key_store"`
+	Layout    LayoutConfig    `toml:"layout"`
+	KDF       KDFConfig       `toml:"kdf"`
+	OpenSSL   OpenSSLConfig   `toml:"openssl"`
+	Packing   PackingConfig   `toml:"packing"`
+	Secret    SecretConfig    `toml:"secret"`
+	Vault     VaultConfig     `toml:"vault"`
+	Clipboard ClipboardConfig `toml:"clipboard"`
+	Theme     ThemeConfig     `toml:"theme"`
+	Keys      KeysConfig      `toml:"keys"`
+}
+
+type LayoutConfig struct {
+	MinInputWidth     int `toml:"min_input_width"`
+	MaxInputWidth     int `toml:"max_input_width"`
+	DefaultWidth      int `toml:"default_width"`
+	DefaultHeight     int `toml:"default_height"`
+	InputCharLimit    int `toml:"input_char_limit"`
+	MinTerminalWidth  int `toml:"min_terminal_width"`
+	MinTextAreaHeight int `toml:"min_text_area_height"`
+	MaxTextAreaHeight int `toml:"max_text_area_height"`
+	TextCharLimit     int `toml:"text_char_limit"`
+	TextMaxLines      int `toml:"text_max_lines"`
+}
+
+type KDFConfig struct {
+	Algorithm string         `toml:"algorithm"`
+	Argon2id  Argon2idConfig `toml:"argon2id"`
+	Scrypt    ScryptConfig   `toml:"scrypt"`
+}
+
+type Argon2idConfig struct {
+	Time    uint32 `toml:"time"`
+	Memory  uint32 `toml:"memory"`
+	Threads uint8  `toml:"threads"`
+}
+
+type ScryptConfig struct {
+	LogN uint8  `toml:"log_n"`
+	R    uint32 `toml:"r"`
+	P    uint32 `toml:"p"`
+}
+
+// OpenSSLConfig selects how legacy `openssl enc` ciphertexts are read and
+// written; the header carries only the salt, so these must match the
+// options the blob was made with.
+type OpenSSLConfig struct {
+	Cipher     string `toml:"cipher"`
+	PBKDF2     bool   `toml:"pbkdf2"`
+	Iterations int    `toml:"iterations"`
+	Digest     string `toml:"digest"`
+}
+
+// PackingConfig sets the compression and padding applied to native
+// message plaintext before encryption.
+type PackingConfig struct {
+	Compression     string `toml:"compression"`
+	Padding         string `toml:"padding"`
+	MinCompressSize int    `toml:"min_compress_size"`
+}
+
+// SecretConfig lists factors combined with every typed secret. Ciphertext
+// made with them cannot be decrypted without them.
+type SecretConfig struct {
+	Keyfiles   []string `toml:"keyfiles"`
+	Challenge  string   `toml:"challenge"`
+	KeyfileDir string   `toml:"keyfile_dir"`
+}
+
+// VaultConfig locates the vault file and sets how long an unlocked vault
+// may sit idle; zero never locks it.
+type VaultConfig struct {
+	Path     string        `toml:"path"`
+	AutoLock time.Duration `toml:"auto_lock"`
+}
+
+type ClipboardConfig struct {
+	Backend    string        `toml:"backend"`
+	Target     string        `toml:"target"`
+	Timeout    time.Duration `toml:"timeout"`
+	ClearAfter time.Duration `toml:"clear_after"`
+	OSC52Limit int           `toml:"osc52_limit"`
+}
+
+type ThemeConfig struct {
+	Primary    string `toml:"primary"`
+	Success    string `toml:"success"`
+	Error      string `toml:"error"`
+	Warning    string `toml:"warning"`
+	Info       string `toml:"info"`
+	Muted      string `toml:"muted"`
+	Background string `toml:"background"`
+	Foreground string `toml:"foreground"`
+}
+
+type KeysConfig struct {
+	Submit   string `toml:"submit"`
+	Reveal   string `toml:"reveal"`
+	CopyAll  string `toml:"copy_all"`
+	CopyLine string `toml:"copy_line"`
+	Encoding string `toml:"encoding"`
+	Keyfile  string `toml:"keyfile"`
+	Paste    string `toml:"paste"`
+}
+
+func Default() Config {
+	argon := core.DefaultArgon2idParams()
+	scrypt := core.DefaultScryptParams()
+	openssl := core.DefaultOpenSSLParams()
+	packing := core.DefaultPacking()
+	clipboard := platform.DefaultClipboardOptions()
+
+	return Config{
+		Cipher:   core.AlgAES256GCM.String(),
+		Encoding: core.EncodingBase64,
+		Layout: LayoutConfig{
+			MinInputWidth:     50,
+			MaxInputWidth:     100,
+			DefaultWidth:      80,
+			DefaultHeight:     24,
+			InputCharLimit:    1024,
+			MinTerminalWidth:  66,
+			MinTextAreaHeight: 3,
+			MaxTextAreaHeight: 20,
+			TextCharLimit:     64 * 1024,
+			TextMaxLines:      2000,
+		},
+		KDF: KDFConfig{
+			Algorithm: argon.ID.String(),
+			Argon2id:  Argon2idConfig{Time: argon.Time, Memory: argon.Memory, Threads: argon.Threads},
+			Scrypt:    ScryptConfig{LogN: scrypt.LogN, R: scrypt.R, P: scrypt.P},
+		},
+		OpenSSL: OpenSSLConfig{
+			Cipher:     openssl.Cipher,
+			PBKDF2:     openssl.PBKDF2,
+			Iterations: openssl.Iterations,
+			Digest:     openssl.Digest,
+		},
+		Packing: PackingConfig{
+			Compression:     packing.Compression.String(),
+			Padding:         packing.Padding.String(),
+			MinCompressSize: packing.MinCompressSize,
+		},
+		Clipboard: ClipboardConfig{
+			Backend:    string(clipboard.Backend),
+			Target:     string(clipboard.Target),
+			Timeout:    clipboard.Timeout,
+			ClearAfter: clipboard.ClearAfter,
+			OSC52Limit: clipboard.OSC52Limit,
+		},
+		Theme: ThemeConfig{
+			Primary:    "#7C3AED",
+			Success:    "#10B981",
+			Error:      "#EF4444",
+			Warning:    "#F59E0B",
+			Info:       "#3B82F6",
+			Muted:      "#6B7280",
+			Background: "#1F2937",
+			Foreground: "#F3F4F6",
+		},
+		Vault: VaultConfig{
+			AutoLock: 5 * time.Minute,
+		},
+		Keys: KeysConfig{
+			Submit:   "ctrl+d",
+			Reveal:   "r",
+			CopyAll:  "c",
+			CopyLine: "y",
+			Encoding: "e",
+			Keyfile:  "ctrl+o",
+			Paste:    "ctrl+v",
+		},
+	}
+}
+
+func DefaultDir() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, AppDirName), nil
+}
+
+// DefaultDataDir is the application directory under $XDG_DATA_HOME, or
+// ~/.local/share when that is unset.
+func DefaultDataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, AppDirName), nil
+}
+
+func DefaultPath() (string, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+func Load(path string) (Config, error) {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return Default(), nil
+		}
+	}
+
+	cfg, err := LoadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		cfg, err = Default(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg.applyEnv()
+	return cfg, nil
+}
+
+func LoadFile(path string) (Config, error) {
+	cfg := Default()
+
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return Config{}, fmt.Errorf("%s: %w: %s", path, ErrUnknownKey, strings.Join(keys, ", "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() {
+	if _, ok := os.LookupEnv(platform.ClipboardBackendEnv); ok {
+		c.Clipboard.Backend = string(platform.ClipboardBackendFromEnv())
+	}
+	if _, ok := os.LookupEnv(platform.ClipboardTargetEnv); ok {
+		c.Clipboard.Target = string(platform.ClipboardTargetFromEnv())
+	}
+	if value, ok := os.LookupEnv(platform.ClipboardClearAfterEnv); ok {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			c.Clipboard.ClearAfter = d
+		}
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+		}
+	}
+
+	if _, err := core.AlgorithmByName(c.Cipher); err != nil {
+		errs = append(errs, fmt.Errorf("%w: cipher: %w", ErrInvalidConfig, err))
+	}
+	if _, err := core.EncodingByName(c.Encoding); err != nil {
+		errs = append(errs, fmt.Errorf("%w: encoding: %w", ErrInvalidConfig, err))
+	}
+	check(!c.Armor || strings.EqualFold(c.Encoding, core.EncodingBase64), "armor requires encoding %q", core.EncodingBase64)
+
+	l := c.Layout
+	check(l.MinInputWidth > 0, "layout.min_input_width must be positive")
+	check(l.MaxInputWidth >= l.MinInputWidth, "layout.max_input_width must be at least layout.min_input_width")
+	check(l.DefaultWidth > 0 && l.DefaultHeight > 0, "layout.default_width and layout.default_height must be positive")
+	check(l.InputCharLimit > 0, "layout.input_char_limit must be positive")
+	check(l.MinTerminalWidth > 0, "layout.min_terminal_width must be positive")
+	check(l.MinTextAreaHeight > 0, "layout.min_text_area_height must be positive")
+	check(l.MaxTextAreaHeight >= l.MinTextAreaHeight, "layout.max_text_area_height must be at least layout.min_text_area_height")
+	check(l.TextCharLimit >= 0, "layout.text_char_limit must not be negative")
+	check(l.TextMaxLines >= 0, "layout.text_max_lines must not be negative")
+
+	if kdf, err := c.KDFParams(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: kdf: %w", ErrInvalidConfig, err))
+	} else if err := kdf.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: kdf: %w", ErrInvalidConfig, err))
+	}
+
+	if err := c.OpenSSLParams().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: openssl: %w", ErrInvalidConfig, err))
+	}
+
+	if packing, err := c.PackingParams(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: packing: %w", ErrInvalidConfig, err))
+	} else if err := packing.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: packing: %w", ErrInvalidConfig, err))
+	}
+
+	if c.Secret.Challenge != "" {
+		name, _, _ := strings.Cut(c.Secret.Challenge, ":")
+		check(slices.ContainsFunc(core.ChallengeProviders(), func(p core.ChallengeProvider) bool { return strings.EqualFold(p.Name, name) }),
+			"secret.challenge: unknown provider %q", name)
+	}
+
+	switch platform.ClipboardBackend(c.Clipboard.Backend) {
+	case platform.ClipboardAuto, platform.ClipboardSystem, platform.ClipboardOSC52:
+	default:
+		check(false, "clipboard.backend must be %q, %q or %q", platform.ClipboardAuto, platform.ClipboardSystem, platform.ClipboardOSC52)
+	}
+	switch platform.ClipboardTarget(c.Clipboard.Target) {
+	case platform.TargetClipboard, platform.TargetPrimary, platform.TargetBoth:
+	default:
+		check(false, "clipboard.target must be %q, %q or %q", platform.TargetClipboard, platform.TargetPrimary, platform.TargetBoth)
+	}
+	check(c.Vault.AutoLock >= 0, "vault.auto_lock must not be negative")
+	check(c.Clipboard.Timeout > 0, "clipboard.timeout must be positive")
+	check(c.Clipboard.ClearAfter >= 0, "clipboard.clear_after must not be negative")
+	check(c.Clipboard.OSC52Limit >= 0, "clipboard.osc52_limit must not be negative")
+
+	for _, color := range c.Theme.colors() {
+		check(validColor(color.value), "theme.%s: %q is not a #RRGGBB or 0-255 color", color.name, color.value)
+	}
+
+	errs = append(errs, c.Keys.validate()...)
+
+	return errors.Join(errs...)
+}
+
+func (c Config) KDFParams() (core.KDFParams, error) {
+	switch c.KDF.Algorithm {
+	case core.KDFArgon2id.String():
+		a := c.KDF.Argon2id
+		return core.KDFParams{ID: core.KDFArgon2id, Time: a.Time, Memory: a.Memory, Threads: a.Threads}, nil
+	case core.KDFScrypt.String():
+		s := c.KDF.Scrypt
+		return core.KDFParams{ID: core.KDFScrypt, LogN: s.LogN, R: s.R, P: s.P}, nil
+	default:
+		return core.KDFParams{}, fmt.Errorf("%w: %q", core.ErrUnsupportedKDF, c.KDF.Algorithm)
+	}
+}
+
+func (c Config) OpenSSLParams() core.OpenSSLParams {
+	o := c.OpenSSL
+	return core.OpenSSLParams{Cipher: o.Cipher, PBKDF2: o.PBKDF2, Iterations: o.Iterations, Digest: o.Digest}
+}
+
+func (c Config) PackingParams() (core.Packing, error) {
+	compression, err := core.CompressionByName(c.Packing.Compression)
+	if err != nil {
+		return core.Packing{}, err
+	}
+	padding, err := core.PaddingByName(c.Packing.Padding)
+	if err != nil {
+		return core.Packing{}, err
+	}
+	return core.Packing{Compression: compression, Padding: padding, MinCompressSize: c.Packing.MinCompressSize}, nil
+}
+
+// KeyStoreDir returns key_store, or the keys directory next to the default
+// config file when it is unset.
+func (c Config) KeyStoreDir() string {
+	if c.KeyStore != "" {
+		return c.KeyStore
+	}
+	dir, err := DefaultDir()
+	if err != nil {
+		return KeysDirName
+	}
+	return filepath.Join(dir, KeysDirName)
+}
+
+// VaultPath returns vault.path, or the vault file in the data directory.
+func (c Config) VaultPath() string {
+	if c.Vault.Path != "" {
+		return c.Vault.Path
+	}
+	dir, err := DefaultDataDir()
+	if err != nil {
+		return vault.FileName
+	}
+	return filepath.Join(dir, vault.FileName)
+}
+
+// KeyfileDir is where the TUI keyfile picker starts: secret.keyfile_dir,
+// or the home directory.
+func (c Config) KeyfileDir() string {
+	if c.Secret.KeyfileDir != "" {
+		return c.Secret.KeyfileDir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return home
+}
+
+func (c Config) ClipboardOptions() platform.ClipboardOptions {
+	return platform.ClipboardOptions{
+		Backend:    platform.ClipboardBackend(c.Clipboard.Backend),
+		Target:     platform.ClipboardTarget(c.Clipboard.Target),
+		Timeout:    c.Clipboard.Timeout,
+		ClearAfter: c.Clipboard.ClearAfter,
+		OSC52Limit: c.Clipboard.OSC52Limit,
+	}
+}
+
+type namedValue struct {
+	name  string
+	value string
+}
+
+func (t ThemeConfig) colors() []namedValue {
+	return []namedValue{
+		{"primary", t.Primary},
+		{"success", t.Success},
+		{"error", t.Error},
+		{"warning", t.Warning},
+		{"info", t.Info},
+		{"muted", t.Muted},
+		{"background", t.Background},
+		{"foreground", t.Foreground},
+	}
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+func validColor(color string) bool {
+	if hexColor.MatchString(color) {
+		return true
+	}
+	n, err := strconv.Atoi(color)
+	return err == nil && n >= 0 && n <= 255
+}
+
+var reservedKeys = []string{"enter", "up", "down", "k", "j", "pgup", "pgdown", "ctrl+c"}
+
+func (k KeysConfig) validate() []error {
+	var errs []error
+
+	if k.Submit == "" || k.Submit == "enter" || len([]rune(k.Submit)) == 1 {
+		errs = append(errs, fmt.Errorf("%w: keys.submit must be a key combination other than enter, got %q", ErrInvalidConfig, k.Submit))
+	}
+	if k.Keyfile == "" || isReserved(k.Keyfile) || len([]rune(k.Keyfile)) == 1 || k.Keyfile == k.Submit {
+		errs = append(errs, fmt.Errorf("%w: keys.keyfile must be a free key combination, got %q", ErrInvalidConfig, k.Keyfile))
+	}
+	if k.Paste == "" || isReserved(k.Paste) || len([]rune(k.Paste)) == 1 || k.Paste == k.Submit || k.Paste == k.Keyfile {
+		errs = append(errs, fmt.Errorf("%w: keys.paste must be a free key combination, got %q", ErrInvalidConfig, k.Paste))
+	}
+
+	seen := make(map[string]string)
+	for _, binding := range []namedValue{
+		{"reveal", k.Reveal},
+		{"copy_all", k.CopyAll},
+		{"copy_line", k.CopyLine},
+		{"encoding", k.Encoding},
+	} {
+		switch {
+		case binding.value == "":
+			errs = append(errs, fmt.Errorf("%w: keys.%s must not be empty", ErrInvalidConfig, binding.name))
+		case isReserved(binding.value):
+			errs = append(errs, fmt.Errorf("%w: keys.%s: %q is reserved", ErrInvalidConfig, binding.name, binding.value))
+		case seen[binding.value] != "":
+			errs = append(errs, fmt.Errorf("%w: keys.%s: %q is already bound to keys.%s", ErrInvalidConfig, binding.name, binding.value, seen[binding.value]))
+		default:
+			seen[binding.value] = binding.name
+		}
+	}
+
+	return errs
+}
+
+func isReserved(key string) bool {
+	for _, reserved := range reservedKeys {
+		if key == reserved {
+			return true
+		}
+	}
+	return false
+}
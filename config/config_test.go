@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"txt-encdec-cli/platform"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// unsetClipboardEnv clears the overrides for the rest of the test; Setenv
+// first so they are restored afterwards.
+func unsetClipboardEnv(t *testing.T) {
+	for _, name := range []string{platform.ClipboardBackendEnv, platform.ClipboardTargetEnv, platform.ClipboardClearAfterEnv} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+cipher = "XChaCha20-Poly1305"
+encoding = "base58"
+
+[layout]
+max_input_width = 120
+
+[kdf]
+algorithm = "scrypt"
+[kdf.scrypt]
+log_n = 16
+
+[clipboard]
+target = "both"
+clear_after = "45s"
+
+[keys]
+submit = "ctrl+s"
+`)
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Cipher != "XChaCha20-Poly1305" || cfg.Encoding != "base58" {
+		t.Fatalf("cipher, encoding = %q, %q", cfg.Cipher, cfg.Encoding)
+	}
+	if cfg.Layout.MaxInputWidth != 120 || cfg.Layout.MinInputWidth != Default().Layout.MinInputWidth {
+		t.Fatalf("layout = %+v, want max_input_width set and the rest defaulted", cfg.Layout)
+	}
+	kdf, err := cfg.KDFParams()
+	if err != nil || kdf.LogN != 16 || kdf.R != Default().KDF.Scrypt.R {
+		t.Fatalf("KDFParams = %+v, %v", kdf, err)
+	}
+	opts := cfg.ClipboardOptions()
+	if opts.Target != platform.TargetBoth || opts.ClearAfter != 45*time.Second || opts.Timeout != Default().Clipboard.Timeout {
+		t.Fatalf("ClipboardOptions = %+v", opts)
+	}
+	if cfg.Keys.Submit != "ctrl+s" || cfg.Keys.Reveal != "r" {
+		t.Fatalf("keys = %+v", cfg.Keys)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    error
+		mention []string
+	}{
+		{"unknown keys", "colour = \"red\"\n[layout]\nwidth = 3\n", ErrUnknownKey, []string{"colour", "layout.width"}},
+		{"invalid value", "cipher = \"rot13\"\n", ErrInvalidConfig, []string{"cipher"}},
+		{"bad duration", "[vault]\nauto_lock = \"soon\"\n", nil, []string{"auto_lock"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			_, err := LoadFile(path)
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("LoadFile = %v, want %v", err, tt.want)
+			}
+			for _, s := range append(tt.mention, path) {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("error %q does not mention %q", err, s)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateJoinsErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Cipher = "rot13"
+	cfg.Layout.MinInputWidth = 0
+	cfg.Clipboard.Target = "secondary"
+	cfg.Theme.Primary = "purple"
+	cfg.Keys.CopyAll = cfg.Keys.Reveal
+
+	err := cfg.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Validate = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	lines := strings.Split(err.Error(), "\n")
+	for i, want := range []string{"cipher", "layout.min_input_width", "clipboard.target", "theme.primary", "keys.copy_all"} {
+		if i >= len(lines) || !strings.Contains(lines[i], want) {
+			t.Fatalf("Validate error line %d of %q, want one mentioning %s", i, lines, want)
+		}
+	}
+	if len(lines) != 5 {
+		t.Fatalf("Validate reported %d problems, want 5:\n%v", len(lines), err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	unsetClipboardEnv(t)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load without a config file: %v", err)
+	}
+	if cfg.Cipher != Default().Cipher {
+		t.Fatalf("Load without a config file = %+v, want the defaults", cfg)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load of a missing explicit file = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	path := writeConfig(t, "[clipboard]\nbackend = \"system\"\ntarget = \"primary\"\nclear_after = \"30s\"\n")
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		backend    platform.ClipboardBackend
+		target     platform.ClipboardTarget
+		clearAfter time.Duration
+	}{
+		{"unset", nil, platform.ClipboardSystem, platform.TargetPrimary, 30 * time.Second},
+		{"overrides", map[string]string{
+			platform.ClipboardBackendEnv:    "osc52",
+			platform.ClipboardTargetEnv:     "both",
+			platform.ClipboardClearAfterEnv: "1m30s",
+		}, platform.ClipboardOSC52, platform.TargetBoth, 90 * time.Second},
+		{"zero disables clearing", map[string]string{platform.ClipboardClearAfterEnv: "0"}, platform.ClipboardSystem, platform.TargetPrimary, 0},
+		{"unknown values fall back", map[string]string{
+			platform.ClipboardBackendEnv: "pigeon",
+			platform.ClipboardTargetEnv:  "secondary",
+		}, platform.ClipboardAuto, platform.TargetClipboard, 30 * time.Second},
+		{"bad duration is ignored", map[string]string{platform.ClipboardClearAfterEnv: "soon"}, platform.ClipboardSystem, platform.TargetPrimary, 30 * time.Second},
+		{"negative duration is ignored", map[string]string{platform.ClipboardClearAfterEnv: "-5s"}, platform.ClipboardSystem, platform.TargetPrimary, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetClipboardEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := cfg.ClipboardOptions()
+			if opts.Backend != tt.backend || opts.Target != tt.target || opts.ClearAfter != tt.clearAfter {
+				t.Fatalf("ClipboardOptions = %s, %s, %s, want %s, %s, %s",
+					opts.Backend, opts.Target, opts.ClearAfter, tt.backend, tt.target, tt.clearAfter)
+			}
+		})
+	}
+}
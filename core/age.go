@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const ageMagic = "age-encryption.org/v1"
+
+var (
+	ErrNotAge        = errors.New("ciphertext is not in age format")
+	ErrAgeWorkFactor = errors.New("invalid age scrypt work factor")
+)
+
+// AgeCryptor reads and writes the age v1 format, so ciphertext can be
+// exchanged with age and rage. Text is ASCII-armored; streams are binary.
+type AgeCryptor struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+func NewAgeCryptor(recipients []age.Recipient, identities []age.Identity) *AgeCryptor {
+	return &AgeCryptor{recipients: recipients, identities: identities}
+}
+
+// NewAgePassphraseCryptor uses scrypt stanzas. A workFactor of 0 keeps
+// age's default; decryption accepts any work factor age itself accepts.
+func NewAgePassphraseCryptor(secret string, workFactor int) (*AgeCryptor, error) {
+	if workFactor < 0 || workFactor > maxScryptLogN {
+		return nil, fmt.Errorf("%w: %d", ErrAgeWorkFactor, workFactor)
+	}
+
+	recipient, err := age.NewScryptRecipient(secret)
+	if err != nil {
+		return nil, err
+	}
+	if workFactor > 0 {
+		recipient.SetWorkFactor(workFactor)
+	}
+
+	identity, err := age.NewScryptIdentity(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAgeCryptor([]age.Recipient{recipient}, []age.Identity{identity}), nil
+}
+
+// AgeWorkFactor carries a configured scrypt cost over to age; other KDFs
+// leave age's default in place.
+func AgeWorkFactor(kdf KDFParams) int {
+	if kdf.ID == KDFScrypt {
+		return int(kdf.LogN)
+	}
+	return 0
+}
+
+// NewAgeRecipientCryptor uses X25519 stanzas for the same keys the native
+// recipient mode uses.
+func NewAgeRecipientCryptor(recipients []*Recipient, identities []*Identity) (*AgeCryptor, error) {
+	c := &AgeCryptor{}
+
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(r.AgeString())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+		}
+		c.recipients = append(c.recipients, recipient)
+	}
+
+	for _, i := range identities {
+		identity, err := age.ParseX25519Identity(i.AgeString())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIdentity, err)
+		}
+		c.identities = append(c.identities, identity)
+	}
+
+	return c, nil
+}
+
+func (c *AgeCryptor) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	if err := c.encrypt(aw, strings.NewReader(plaintext)); err != nil {
+		return "", err
+	}
+	if err := aw.Close(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func (c *AgeCryptor) Decrypt(ciphertext string) (string, error) {
+	ciphertext = strings.TrimSpace(ciphertext)
+	if ciphertext == "" {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := c.DecryptStream(&buf, strings.NewReader(ciphertext)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c *AgeCryptor) EncryptStream(dst io.Writer, src io.Reader) error {
+	return c.encrypt(dst, src)
+}
+
+// DecryptStream accepts both armored and binary age input. Armor may be
+// preceded by whitespace, as the age spec allows.
+func (c *AgeCryptor) DecryptStream(dst io.Writer, src io.Reader) error {
+	br := bufio.NewReader(src)
+	start, _ := br.Peek(br.Size())
+
+	var in io.Reader = br
+	switch {
+	case bytes.HasPrefix(bytes.TrimLeft(start, " \t\r\n"), []byte(armor.Header)):
+		in = armor.NewReader(br)
+	case bytes.HasPrefix(start, []byte(ageMagic)):
+	default:
+		return ErrNotAge
+	}
+
+	r, err := age.Decrypt(in, c.identities...)
+	if err != nil {
+		return ageError(err)
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		var armorErr *armor.Error
+		if errors.As(err, &armorErr) {
+			return fmt.Errorf("%w: %v", ErrInvalidBase64, err)
+		}
+		return fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	return nil
+}
+
+func (c *AgeCryptor) encrypt(dst io.Writer, src io.Reader) error {
+	if len(c.recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	w, err := age.Encrypt(dst, c.recipients...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func ageError(err error) error {
+	var noMatch *age.NoIdentityMatchError
+	var armorErr *armor.Error
+
+	switch {
+	case errors.As(err, &noMatch) && slices.Contains(noMatch.StanzaTypes, "scrypt"):
+		return fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	case errors.As(err, &noMatch):
+		return fmt.Errorf("%w: %w: %v", ErrDecryptionFailed, ErrNoMatchingIdentity, err)
+	case errors.As(err, &armorErr):
+		return fmt.Errorf("%w: %v", ErrInvalidBase64, err)
+	default:
+		return fmt.Errorf("%w: age: %v", ErrInvalidCiphertext, err)
+	}
+}
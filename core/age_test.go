@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	agetest "c2sp.org/CCTV/age"
+	"filippo.io/age"
+)
+
+type ageVector struct {
+	expect     string
+	payload    string
+	passphrase string
+	identities []*Identity
+	file       []byte
+}
+
+// parseAgeVector reads a CCTV age test vector. It returns nil for vectors
+// using keys this tool has no counterpart for, such as post-quantum hybrids.
+func parseAgeVector(t *testing.T, data []byte) *ageVector {
+	t.Helper()
+
+	v := &ageVector{}
+	compressed := false
+	for {
+		line, rest, ok := bytes.Cut(data, []byte("\n"))
+		if !ok {
+			t.Fatal("vector has no header terminator")
+		}
+		data = rest
+		if len(line) == 0 {
+			break
+		}
+
+		key, value, _ := strings.Cut(string(line), ": ")
+		switch key {
+		case "expect":
+			v.expect = value
+		case "payload":
+			v.payload = value
+		case "passphrase":
+			v.passphrase = value
+		case "identity":
+			if !strings.HasPrefix(value, "AGE-SECRET-KEY-1") {
+				return nil
+			}
+			identity, err := ParseIdentity(value)
+			if err != nil {
+				t.Fatalf("ParseIdentity(%s): %v", value, err)
+			}
+			v.identities = append(v.identities, identity)
+		case "compressed":
+			compressed = value == "zlib"
+		}
+	}
+
+	if compressed {
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v.file = data
+	return v
+}
+
+func TestAgeVectors(t *testing.T) {
+	names, err := fs.Glob(agetest.Vectors, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		data, err := fs.ReadFile(agetest.Vectors, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			v := parseAgeVector(t, data)
+			if v == nil {
+				t.Skip("uses a key type this tool does not support")
+			}
+
+			var c *AgeCryptor
+			var err error
+			if v.passphrase != "" {
+				if c, err = NewAgePassphraseCryptor(v.passphrase, 0); err != nil {
+					t.Fatal(err)
+				}
+			} else if c, err = NewAgeRecipientCryptor(nil, v.identities); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err = c.DecryptStream(&out, bytes.NewReader(v.file))
+
+			switch v.expect {
+			case "success":
+				if err != nil {
+					t.Fatalf("DecryptStream: %v", err)
+				}
+				sum := sha256.Sum256(out.Bytes())
+				if got := hex.EncodeToString(sum[:]); got != v.payload {
+					t.Fatalf("payload hash = %s, want %s", got, v.payload)
+				}
+			case "no match":
+				if !errors.Is(err, ErrDecryptionFailed) {
+					t.Fatalf("DecryptStream = %v, want %v", err, ErrDecryptionFailed)
+				}
+			default:
+				if err == nil {
+					t.Fatalf("DecryptStream succeeded, want %s", v.expect)
+				}
+			}
+		})
+	}
+}
+
+func TestAgeRoundTrip(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	passphrase, err := NewAgePassphraseCryptor("secret", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := NewAgeRecipientCryptor([]*Recipient{alice.Recipient(), bob.Recipient()}, []*Identity{bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, c := range map[string]*AgeCryptor{"scrypt": passphrase, "x25519": recipients} {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := c.Encrypt("hello\nage")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(encoded, "-----BEGIN AGE ENCRYPTED FILE-----\n") {
+				t.Fatalf("Encrypt output is not armored:\n%s", encoded)
+			}
+			if DetectFormat(encoded) != FormatAge {
+				t.Fatal("DetectFormat did not recognise age output")
+			}
+
+			decoded, err := c.Decrypt("\n" + encoded + "\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != "hello\nage" {
+				t.Fatalf("Decrypt = %q", decoded)
+			}
+		})
+	}
+
+	encoded, err := recipients.Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := NewAgeRecipientCryptor(nil, []*Identity{newTestIdentity(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eve.Decrypt(encoded); !errors.Is(err, ErrNoMatchingIdentity) {
+		t.Fatalf("Decrypt with other identity = %v, want %v", err, ErrNoMatchingIdentity)
+	}
+}
+
+func TestAgeKeyEncoding(t *testing.T) {
+	// Identity from the CCTV x25519 vector; the recipient is computed by age.
+	const secret = "AGE-SECRET-KEY-1EGTZVFFV20835NWYV6270LXYVK2VKNX2MMDKWYKLMGR48UAWX40Q2P2LM0"
+
+	identity, err := ParseIdentity("# created by age-keygen\n" + secret + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := identity.AgeString(); got != secret {
+		t.Fatalf("AgeString = %s, want %s", got, secret)
+	}
+
+	reference, err := age.ParseX25519Identity(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := identity.Recipient().AgeString(), reference.Recipient().String(); got != want {
+		t.Fatalf("recipient AgeString = %s, want %s", got, want)
+	}
+
+	recipient, err := ParseRecipient(reference.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.String() != identity.Recipient().String() {
+		t.Fatal("age recipient did not round-trip")
+	}
+
+	corrupted := []byte(reference.Recipient().String())
+	if corrupted[len(corrupted)-1] == 'q' {
+		corrupted[len(corrupted)-1] = 'p'
+	} else {
+		corrupted[len(corrupted)-1] = 'q'
+	}
+	if _, err := ParseRecipient(string(corrupted)); !errors.Is(err, ErrInvalidRecipient) {
+		t.Fatalf("ParseRecipient with bad checksum = %v, want %v", err, ErrInvalidRecipient)
+	}
+}
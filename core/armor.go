@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ArmorBegin = "-----BEGIN TEDC MESSAGE-----"
+	ArmorEnd   = "-----END TEDC MESSAGE-----"
+
+	ArmorVersion = "Version"
+	ArmorContext = "Context"
+	ArmorCreated = "Created"
+
+	armorLineSize = 64
+)
+
+var ErrDamagedArmor = errors.New("damaged armor")
+
+type ArmorHeader struct {
+	Key   string
+	Value string
+}
+
+// Armored is a decoded armor block. Headers are informational only; the
+// context label is authenticated through the envelope, not through them.
+type Armored struct {
+	Headers []ArmorHeader
+	Data    []byte
+}
+
+func (a *Armored) Header(key string) string {
+	for _, h := range a.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// EncodeArmor wraps data in BEGIN/END markers with 64-column base64 and an
+// OpenPGP-style CRC-24 line, so copy damage is caught before decryption.
+func EncodeArmor(data []byte, headers ...ArmorHeader) string {
+	var b strings.Builder
+	b.WriteString(ArmorBegin + "\n")
+	for _, h := range headers {
+		fmt.Fprintf(&b, "%s: %s\n", h.Key, h.Value)
+	}
+	b.WriteString("\n")
+	b.WriteString(wrapLines(base64.StdEncoding.EncodeToString(data), armorLineSize) + "\n")
+	b.WriteString("=" + crc24Base64(data) + "\n")
+	b.WriteString(ArmorEnd)
+	return b.String()
+}
+
+func IsArmored(text string) bool {
+	return strings.Contains(text, ArmorBegin)
+}
+
+// DecodeArmor finds the armor block in text, ignoring anything around it
+// and the "> " quote markers and indentation chat clients add to lines.
+func DecodeArmor(text string) (*Armored, error) {
+	_, body, ok := strings.Cut(text, ArmorBegin)
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s line", ErrDamagedArmor, ArmorBegin)
+	}
+	body, _, ok = strings.Cut(body, ArmorEnd)
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s line", ErrDamagedArmor, ArmorEnd)
+	}
+
+	a := &Armored{}
+	var payload strings.Builder
+	var checksum string
+	for _, line := range strings.Split(body, "\n") {
+		line = unquoteLine(line)
+		switch {
+		case line == "":
+		case len(line) == 5 && line[0] == '=':
+			checksum = line[1:]
+		case strings.Contains(line, ":"):
+			if payload.Len() > 0 {
+				return nil, fmt.Errorf("%w: header after data", ErrDamagedArmor)
+			}
+			key, value, _ := strings.Cut(line, ":")
+			a.Headers = append(a.Headers, ArmorHeader{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+		default:
+			payload.WriteString(strings.Join(strings.Fields(line), ""))
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDamagedArmor, err)
+	}
+	if checksum == "" {
+		return nil, fmt.Errorf("%w: missing checksum", ErrDamagedArmor)
+	}
+	if checksum != crc24Base64(data) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrDamagedArmor)
+	}
+
+	a.Data = data
+	return a, nil
+}
+
+func unquoteLine(line string) string {
+	line = strings.TrimSpace(line)
+	for strings.HasPrefix(line, ">") {
+		line = strings.TrimSpace(line[1:])
+	}
+	return line
+}
+
+// ArmorCiphertext re-encodes the base64 output of the native cryptors as
+// armor, filling the headers from the envelope.
+func ArmorCiphertext(encoded string, created time.Time) (string, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+
+	var headers []ArmorHeader
+	if env, err := ParseEnvelope(data); err == nil {
+		headers = append(headers, ArmorHeader{ArmorVersion, strconv.Itoa(int(env.Version))})
+		if env.Context != "" {
+			headers = append(headers, ArmorHeader{ArmorContext, env.Context})
+		}
+	}
+	if !created.IsZero() {
+		headers = append(headers, ArmorHeader{ArmorCreated, created.UTC().Format(time.RFC3339)})
+	}
+
+	return EncodeArmor(data, headers...), nil
+}
+
+const (
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+// crc24 is the OpenPGP armor checksum (RFC 4880, section 6.1).
+func crc24(data []byte) uint32 {
+	crc := uint32(crc24Init)
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
+
+func crc24Base64(data []byte) string {
+	crc := crc24(data)
+	return base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)})
+}
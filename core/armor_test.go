@@ -0,0 +1,92 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRC24(t *testing.T) {
+	if got := crc24([]byte("123456789")); got != 0x21cf02 {
+		t.Fatalf("crc24 = %#06x, want 0x21cf02", got)
+	}
+}
+
+func TestArmorRoundTrip(t *testing.T) {
+	c := NewCryptor("secret", AlgAES256GCM, testKDF)
+	plaintext := strings.Repeat("long enough to wrap ", 10)
+
+	encoded, err := c.EncryptWithContext(plaintext, "staging/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	armored, err := ArmorCiphertext(encoded, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(armored, "\n")
+	if lines[0] != ArmorBegin || lines[len(lines)-1] != ArmorEnd {
+		t.Fatalf("armor is not framed by BEGIN/END lines:\n%s", armored)
+	}
+	for _, line := range lines {
+		if len(line) > armorLineSize {
+			t.Fatalf("line longer than %d columns: %q", armorLineSize, line)
+		}
+	}
+
+	block, err := DecodeArmor(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{ArmorVersion: "1", ArmorContext: "staging/db", ArmorCreated: "2026-10-17T09:30:00Z"} {
+		if got := block.Header(key); got != want {
+			t.Errorf("header %s = %q, want %q", key, got, want)
+		}
+	}
+
+	quoted := "bob: here you go\r\n> > " + strings.ReplaceAll(armored, "\n", "\r\n>  ") + "\r\nthanks!"
+	decoded, err := c.Decrypt(quoted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != plaintext {
+		t.Fatalf("Decrypt = %q", decoded)
+	}
+}
+
+func TestArmorDamage(t *testing.T) {
+	c := NewCryptor("secret", AlgAES256GCM, testKDF)
+	encoded, err := c.Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := ArmorCiphertext(encoded, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(armored, "\n")
+	data := []byte(lines[3])
+	if data[10] == 'A' {
+		data[10] = 'B'
+	} else {
+		data[10] = 'A'
+	}
+	lines[3] = string(data)
+
+	for name, text := range map[string]string{
+		"flipped character": strings.Join(lines, "\n"),
+		"missing end":       strings.TrimSuffix(armored, ArmorEnd),
+		"missing checksum":  strings.Join(append(lines[:4:4], ArmorEnd), "\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Decrypt(text)
+			if !errors.Is(err, ErrDamagedArmor) {
+				t.Fatalf("Decrypt = %v, want %v", err, ErrDamagedArmor)
+			}
+		})
+	}
+}
@@ -4,17 +4,19 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 var (
 	ErrInvalidCiphertext = errors.New("invalid ciphertext: too short or malformed")
 	ErrDecryptionFailed  = errors.New("decryption failed: invalid key or corrupted data")
 	ErrInvalidBase64     = errors.New("invalid base64 encoding")
+
+	ErrContextUnsupported = errors.New("this format cannot carry a context label")
 )
 
 type Cryptor interface {
@@ -22,58 +24,258 @@ type Cryptor interface {
 	Decrypt(ciphertext string) (string, error)
 }
 
-type AESCryptor struct {
-	key []byte
+// ContextCryptor binds ciphertext to a context label such as "staging/db".
+// The label is stored in the clear and authenticated with the payload.
+// Decrypting with a non-empty label fails with ErrContextMismatch unless
+// the ciphertext carries exactly that label; an empty label accepts any.
+type ContextCryptor interface {
+	Cryptor
+	EncryptWithContext(plaintext, context string) (string, error)
+	DecryptWithContext(ciphertext, context string) (string, error)
+}
+
+// EncryptContext uses c's context support when a label is given and plain
+// Encrypt otherwise.
+func EncryptContext(c Cryptor, plaintext, context string) (string, error) {
+	if context == "" {
+		return c.Encrypt(plaintext)
+	}
+	cc, ok := c.(ContextCryptor)
+	if !ok {
+		return "", ErrContextUnsupported
+	}
+	return cc.EncryptWithContext(plaintext, context)
+}
+
+func DecryptContext(c Cryptor, ciphertext, context string) (string, error) {
+	if context == "" {
+		return c.Decrypt(ciphertext)
+	}
+	cc, ok := c.(ContextCryptor)
+	if !ok {
+		return "", ErrContextUnsupported
+	}
+	return cc.DecryptWithContext(ciphertext, context)
+}
+
+type AEADCryptor struct {
+	secret    string
+	algorithm AlgorithmID
+	kdf       KDFParams
+	packing   Packing
 }
 
-func NewAESCryptor(secret string) *AESCryptor {
-	return &AESCryptor{
-		key: deriveKey(secret),
+func NewCryptor(secret string, algorithm AlgorithmID, kdf KDFParams) *AEADCryptor {
+	return &AEADCryptor{
+		secret:    secret,
+		algorithm: algorithm,
+		kdf:       kdf,
 	}
 }
 
-func (c *AESCryptor) Encrypt(plaintext string) (string, error) {
+// WithPacking sets the compression and padding applied to messages
+// encrypted from now on. Streams are never packed.
+func (c *AEADCryptor) WithPacking(p Packing) *AEADCryptor {
+	c.packing = p
+	return c
+}
+
+func NewAESCryptor(secret string) *AEADCryptor {
+	return NewAESCryptorWithKDF(secret, DefaultArgon2idParams())
+}
+
+func NewAESCryptorWithKDF(secret string, kdf KDFParams) *AEADCryptor {
+	return NewCryptor(secret, AlgAES256GCM, kdf)
+}
+
+func (c *AEADCryptor) Encrypt(plaintext string) (string, error) {
+	return c.EncryptWithContext(plaintext, "")
+}
+
+func (c *AEADCryptor) EncryptWithContext(plaintext, context string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
+	if err := ValidateContext(context); err != nil {
+		return "", err
+	}
 
-	block, err := aes.NewCipher(c.key)
+	aead, env, err := c.newEnvelope(0)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
 	}
-
-	gcm, err := cipher.NewGCM(block)
+	env.setContext(context)
+	payload, err := env.pack(c.packing, []byte(plaintext))
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
+	nonce := make([]byte, aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	env.Nonce = nonce
+	env.Ciphertext = aead.Seal(nil, nonce, payload, env.Header())
+	return base64.StdEncoding.EncodeToString(env.Marshal()), nil
 }
 
-func (c *AESCryptor) Decrypt(encoded string) (string, error) {
-	if encoded == "" {
-		return "", nil
+func (c *AEADCryptor) newEnvelope(flags byte) (cipher.AEAD, *Envelope, error) {
+	if c.kdf.ID == KDFLegacySHA256 {
+		return nil, nil, fmt.Errorf("%w: %s is only supported for decryption", ErrUnsupportedKDF, c.kdf.ID)
+	}
+
+	suite, err := SuiteByID(c.algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := c.kdf.DeriveKey(c.secret, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := suite.New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := &Envelope{
+		Version:   CurrentEnvelopeVersion,
+		Flags:     flags,
+		Algorithm: suite.ID,
+		KDF:       c.kdf,
+		Salt:      salt,
+	}
+	return aead, env, nil
+}
+
+func (c *AEADCryptor) envelopeAEAD(env *Envelope) (cipher.AEAD, error) {
+	suite, err := SuiteByID(env.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := env.KDF.DeriveKey(c.secret, env.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return suite.New(key)
+}
+
+func (c *AEADCryptor) Decrypt(encoded string) (string, error) {
+	return c.DecryptWithContext(encoded, "")
+}
+
+func (c *AEADCryptor) DecryptWithContext(encoded, context string) (string, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+
+	env, err := ParseEnvelope(data)
+	if errors.Is(err, ErrNotEnvelope) {
+		if context != "" {
+			return "", fmt.Errorf("%w: legacy ciphertext has no context", ErrContextMismatch)
+		}
+		return c.decryptLegacy(data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := c.decryptEnvelope(env)
+	if err != nil {
+		return "", err
+	}
+	if err := env.checkContext(context); err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+func InspectCiphertext(encoded string) (*Envelope, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseEnvelope(data)
+}
+
+func decodeCiphertext(encoded string) ([]byte, error) {
+	if IsArmored(encoded) {
+		armored, err := DecodeArmor(encoded)
+		if err != nil {
+			return nil, err
+		}
+		return armored.Data, nil
+	}
+
+	if strings.TrimSpace(encoded) == "" {
+		return nil, nil
+	}
+
+	_, data, err := SniffEncoding(encoded)
+	return data, err
+}
+
+func (c *AEADCryptor) decryptEnvelope(env *Envelope) (string, error) {
+	if env.Flags&FlagStream != 0 {
+		return "", ErrStreamEnvelope
+	}
+
+	gcm, err := c.envelopeAEAD(env)
+	if err != nil {
+		return "", err
 	}
 
-	data, err := base64.StdEncoding.DecodeString(encoded)
+	if len(env.Nonce) != gcm.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	payload, err := gcm.Open(nil, env.Nonce, env.Ciphertext, env.Header())
 	if err != nil {
-		return "", fmt.Errorf("%w: %v", ErrInvalidBase64, err)
+		return "", fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
 	}
 
-	block, err := aes.NewCipher(c.key)
+	plaintext, err := env.unpack(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// decryptLegacy opens the headerless format of the first release: the
+// nonce and AES-256-GCM ciphertext under the SHA-256 of the secret.
+func (c *AEADCryptor) decryptLegacy(data []byte) (string, error) {
+	return openGCM(deriveKey(c.secret), data)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
+
+func openGCM(key, data []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
 	}
 
 	nonceSize := gcm.NonceSize()
@@ -90,10 +292,6 @@ func (c *AESCryptor) Decrypt(encoded string) (string, error) {
 	return string(plaintext), nil
 }
 
-func deriveKey(secret string) []byte {
-	hash := sha256.Sum256([]byte(secret))
-	return hash[:]
-}
 func Encrypt(secret, plaintext string) (string, error) {
 	cryptor := NewAESCryptor(secret)
 	return cryptor.Encrypt(plaintext)
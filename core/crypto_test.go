@@ -0,0 +1,234 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testKDF = KDFParams{ID: KDFScrypt, LogN: 10, R: 8, P: 1}
+
+func TestSuitesRoundTrip(t *testing.T) {
+	for _, suite := range Suites() {
+		t.Run(suite.ID.String(), func(t *testing.T) {
+			c := NewCryptor("secret", suite.ID, testKDF)
+
+			encoded, err := c.Encrypt("hello\nworld")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env, err := InspectCiphertext(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Algorithm != suite.ID {
+				t.Fatalf("envelope algorithm = %s, want %s", env.Algorithm, suite.ID)
+			}
+
+			decoded, err := NewCryptor("secret", AlgAES256GCM, testKDF).Decrypt(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != "hello\nworld" {
+				t.Fatalf("Decrypt = %q", decoded)
+			}
+
+			_, err = NewCryptor("wrong", suite.ID, testKDF).Decrypt(encoded)
+			if !errors.Is(err, ErrDecryptionFailed) {
+				t.Fatalf("Decrypt with wrong secret = %v, want %v", err, ErrDecryptionFailed)
+			}
+		})
+	}
+}
+
+func TestSuitesStreamRoundTrip(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("0123456789abcdef"), StreamChunkSize/16*2+7)
+
+	for _, suite := range Suites() {
+		t.Run(suite.ID.String(), func(t *testing.T) {
+			c := NewCryptor("secret", suite.ID, testKDF)
+
+			var sealed bytes.Buffer
+			if err := c.EncryptStream(&sealed, bytes.NewReader(plaintext)); err != nil {
+				t.Fatal(err)
+			}
+
+			var opened bytes.Buffer
+			if err := c.DecryptStream(&opened, bytes.NewReader(sealed.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened.Bytes(), plaintext) {
+				t.Fatal("stream round trip mismatch")
+			}
+
+			truncated := sealed.Bytes()[:sealed.Len()-len(plaintext)%StreamChunkSize-suiteOverhead(t, suite)]
+			err := c.DecryptStream(&bytes.Buffer{}, bytes.NewReader(truncated))
+			if !errors.Is(err, ErrTruncatedStream) {
+				t.Fatalf("truncated stream error = %v, want %v", err, ErrTruncatedStream)
+			}
+		})
+	}
+}
+
+func TestAlgorithmByName(t *testing.T) {
+	for _, suite := range Suites() {
+		got, err := AlgorithmByName(strings.ToLower(suite.ID.String()))
+		if err != nil || got != suite.ID {
+			t.Fatalf("AlgorithmByName(%q) = %s, %v", suite.ID, got, err)
+		}
+	}
+
+	if _, err := AlgorithmByName("rot13"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("AlgorithmByName(rot13) = %v, want %v", err, ErrUnsupportedAlgorithm)
+	}
+}
+
+func suiteOverhead(t *testing.T, suite Suite) int {
+	t.Helper()
+	aead, err := suite.New(make([]byte, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead.Overhead()
+}
+
+func TestContextBinding(t *testing.T) {
+	alice := newTestIdentity(t)
+	cryptors := map[string]ContextCryptor{
+		"secret":     NewCryptor("secret", AlgAES256GCM, testKDF),
+		"recipients": NewRecipientCryptor(AlgAES256GCM, []*Recipient{alice.Recipient()}, []*Identity{alice}),
+	}
+
+	for name, c := range cryptors {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := c.EncryptWithContext("hunter2", "staging/db")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env, err := InspectCiphertext(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Context != "staging/db" {
+				t.Fatalf("envelope context = %q, want %q", env.Context, "staging/db")
+			}
+
+			for _, context := range []string{"staging/db", ""} {
+				decoded, err := c.DecryptWithContext(encoded, context)
+				if err != nil {
+					t.Fatalf("DecryptWithContext(%q): %v", context, err)
+				}
+				if decoded != "hunter2" {
+					t.Fatalf("DecryptWithContext(%q) = %q", context, decoded)
+				}
+			}
+
+			if _, err := c.DecryptWithContext(encoded, "prod/db"); !errors.Is(err, ErrContextMismatch) {
+				t.Fatalf("DecryptWithContext with another context = %v, want %v", err, ErrContextMismatch)
+			}
+
+			env.Context = "staging/dc"
+			if _, err := c.Decrypt(base64.StdEncoding.EncodeToString(env.Marshal())); !errors.Is(err, ErrDecryptionFailed) {
+				t.Fatalf("Decrypt with the context altered = %v, want %v", err, ErrDecryptionFailed)
+			}
+
+			plain, err := c.Encrypt("hunter2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.DecryptWithContext(plain, "staging/db"); !errors.Is(err, ErrContextMismatch) {
+				t.Fatalf("DecryptWithContext without a stored context = %v, want %v", err, ErrContextMismatch)
+			}
+		})
+	}
+}
+
+func TestContextValidation(t *testing.T) {
+	for _, context := range []string{"line\nbreak", strings.Repeat("x", MaxContextSize+1), "\xff"} {
+		if err := ValidateContext(context); !errors.Is(err, ErrInvalidContext) {
+			t.Errorf("ValidateContext(%q) = %v, want %v", context, err, ErrInvalidContext)
+		}
+	}
+
+	age, err := NewAgePassphraseCryptor("secret", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncryptContext(age, "hello", "staging/db"); !errors.Is(err, ErrContextUnsupported) {
+		t.Fatalf("EncryptContext with age = %v, want %v", err, ErrContextUnsupported)
+	}
+}
+
+// legacyVector was sealed the way the first release did: base64 of the
+// nonce and AES-256-GCM ciphertext, keyed by SHA-256 of the secret.
+const legacyVector = "bGVnYWN5LW5vbmNlFluCUZG9YRUarYgIpU/oFIdymwf0b+STTwFvHM/El0GGuw=="
+
+func TestLegacyCiphertext(t *testing.T) {
+	decoded, err := NewCryptor("correct horse", AlgAES256GCM, testKDF).Decrypt(legacyVector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != "baseline plaintext" {
+		t.Fatalf("Decrypt = %q", decoded)
+	}
+
+	if _, err := Decrypt("wrong", legacyVector); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("Decrypt with wrong secret = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if _, err := Decrypt("correct horse", "c2hvcnQ="); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("Decrypt of a short blob = %v, want %v", err, ErrInvalidCiphertext)
+	}
+	if _, err := Decrypt("correct horse", "%%%"); !errors.Is(err, ErrInvalidBase64) {
+		t.Fatalf("Decrypt of garbage = %v, want %v", err, ErrInvalidBase64)
+	}
+}
+
+func TestParseEnvelopeErrors(t *testing.T) {
+	env := &Envelope{
+		Version:   CurrentEnvelopeVersion,
+		Algorithm: AlgAES256GCM,
+		KDF:       testKDF,
+		Salt:      make([]byte, SaltSize),
+		Nonce:     make([]byte, 12),
+	}
+	header := env.Header()
+	with := func(offset int, b byte) []byte {
+		data := bytes.Clone(header)
+		data[offset] = b
+		return data
+	}
+	magic := len(EnvelopeMagic)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not an envelope", []byte("hello"), ErrNotEnvelope},
+		{"magic only", []byte(EnvelopeMagic), ErrTruncatedHeader},
+		{"legacy version", with(magic, EnvelopeLegacy), ErrUnknownVersion},
+		{"future version", with(magic, 9), ErrUnknownVersion},
+		{"no algorithm", header[:magic+2], ErrTruncatedHeader},
+		{"unknown algorithm", with(magic+2, 0x7f), ErrUnsupportedAlgorithm},
+		{"unknown flag", with(magic+1, 0x80), ErrUnsupportedFlags},
+		{"cut in kdf", header[:magic+5], ErrTruncatedHeader},
+		{"unknown kdf", with(magic+3, 0x7f), ErrUnsupportedKDF},
+		{"cut in salt", header[:magic+3+1+kdfParamsSize+4], ErrTruncatedHeader},
+		{"cut in nonce", header[:len(header)-1], ErrTruncatedHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseEnvelope(tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("ParseEnvelope = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseEnvelope(header); err != nil {
+		t.Fatalf("ParseEnvelope of the intact header: %v", err)
+	}
+}
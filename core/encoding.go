@@ -0,0 +1,369 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var ErrInvalidEncoding = errors.New("invalid text encoding")
+
+// DecodeError reports where ciphertext text stopped being valid. Offsets
+// count characters after whitespace has been removed.
+type DecodeError struct {
+	Encoding string
+	Offset   int
+	Reason   string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("invalid %s encoding at position %d", e.Encoding, e.Offset)
+	}
+	return fmt.Sprintf("invalid %s encoding at position %d: %s", e.Encoding, e.Offset, e.Reason)
+}
+
+// Is keeps errors.Is(err, ErrInvalidBase64) working for base64 input.
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrInvalidEncoding || target == ErrInvalidBase64 && e.Encoding == EncodingBase64
+}
+
+const (
+	EncodingBase64    = "base64"
+	EncodingBase64URL = "base64url"
+	EncodingBase32    = "base32"
+	EncodingBase58    = "base58"
+	EncodingHex       = "hex"
+	EncodingZ85       = "z85"
+)
+
+// TextEncoding turns envelope bytes into text. Decrypt tries each
+// registered encoding in order and keeps the first one that yields an
+// envelope, so none needs a marker of its own.
+type TextEncoding struct {
+	Name   string
+	Encode func(data []byte) string
+	Decode func(text string) ([]byte, error)
+}
+
+var (
+	encodingsMu sync.RWMutex
+	encodings   = []TextEncoding{
+		{Name: EncodingBase64, Encode: base64.StdEncoding.EncodeToString, Decode: decodeBase64(EncodingBase64, base64.StdEncoding)},
+		{Name: EncodingBase64URL, Encode: base64.RawURLEncoding.EncodeToString, Decode: decodeBase64(EncodingBase64URL, base64.RawURLEncoding)},
+		{Name: EncodingBase32, Encode: encodeCrockford, Decode: decodeCrockford},
+		{Name: EncodingHex, Encode: encodeHex, Decode: decodeHex},
+		{Name: EncodingZ85, Encode: encodeZ85, Decode: decodeZ85},
+		{Name: EncodingBase58, Encode: encodeBase58, Decode: decodeBase58},
+	}
+)
+
+func RegisterEncoding(e TextEncoding) error {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	for _, existing := range encodings {
+		if strings.EqualFold(existing.Name, e.Name) {
+			return fmt.Errorf("encoding %s is already registered", e.Name)
+		}
+	}
+	encodings = append(encodings, e)
+	return nil
+}
+
+func Encodings() []TextEncoding {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	return append([]TextEncoding(nil), encodings...)
+}
+
+func EncodingByName(name string) (TextEncoding, error) {
+	for _, e := range Encodings() {
+		if strings.EqualFold(e.Name, name) {
+			return e, nil
+		}
+	}
+	return TextEncoding{}, fmt.Errorf("%w: unknown encoding %q", ErrInvalidEncoding, name)
+}
+
+// SniffEncoding finds the encoding native ciphertext was written in.
+//
+// When no encoding yields a parsable envelope, the one that best fits the
+// text is kept: first one that decodes all of it to a damaged envelope,
+// then the one that fails furthest in while the text before the failure
+// still decodes to the start of an envelope, whose positioned error is
+// returned. Text that looks like no envelope in any encoding is treated as
+// base64, the only encoding legacy ciphertext ever used.
+func SniffEncoding(text string) (TextEncoding, []byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+
+	var best TextEncoding
+	var bestData []byte
+	var bestErr error
+	reach := -1
+
+	all := Encodings()
+	for _, e := range all {
+		data, err := e.Decode(text)
+		var decodeErr *DecodeError
+		switch {
+		case err == nil && IsEnvelope(data):
+			if _, err := ParseEnvelope(data); err == nil {
+				return e, data, nil
+			}
+			if reach < len(text) {
+				best, bestData, bestErr, reach = e, data, nil, len(text)
+			}
+		case errors.As(err, &decodeErr):
+			if decodeErr.Offset > reach && decodesToEnvelope(e, text, decodeErr.Offset) {
+				best, bestData, bestErr, reach = e, nil, err, decodeErr.Offset
+			}
+		}
+	}
+
+	if reach >= 0 {
+		return best, bestData, bestErr
+	}
+	data, err := all[0].Decode(text)
+	return all[0], data, err
+}
+
+// decodesToEnvelope reports whether text, damaged at offset, is otherwise
+// e's encoding of an envelope. A bad character is patched over, which
+// keeps positional encodings like base58 aligned; a bad length leaves only
+// the text before it.
+func decodesToEnvelope(e TextEncoding, text string, offset int) bool {
+	if offset < len(text) {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		for _, filler := range []string{"0", "A", "a", "1"} {
+			if data, err := e.Decode(text[:offset] + filler + text[offset+size:]); err == nil {
+				return IsEnvelope(data)
+			}
+		}
+	}
+	for n := min(offset, len(text)); n >= 0 && n > offset-8; n-- {
+		if data, err := e.Decode(text[:n]); err == nil {
+			return IsEnvelope(data)
+		}
+	}
+	return false
+}
+
+// EncodeCiphertext re-encodes native ciphertext, given in any supported
+// encoding or armor, as enc.
+func EncodeCiphertext(encoded string, enc TextEncoding) (string, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+	return enc.Encode(data), nil
+}
+
+func decodeBase64(name string, enc *base64.Encoding) func(string) ([]byte, error) {
+	return func(text string) ([]byte, error) {
+		data, err := enc.DecodeString(text)
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			return nil, &DecodeError{Encoding: name, Offset: int(corrupt)}
+		}
+		return data, err
+	}
+}
+
+const hexDigits = "0123456789abcdef"
+
+func encodeHex(data []byte) string {
+	out := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		out = append(out, hexDigits[b>>4], hexDigits[b&0x0f])
+	}
+	return string(out)
+}
+
+func decodeHex(text string) ([]byte, error) {
+	text = strings.ToLower(text)
+	if i := strings.IndexFunc(text, func(r rune) bool { return !strings.ContainsRune(hexDigits, r) }); i >= 0 {
+		return nil, &DecodeError{Encoding: EncodingHex, Offset: i}
+	}
+	if len(text)%2 != 0 {
+		return nil, &DecodeError{Encoding: EncodingHex, Offset: len(text), Reason: "odd length"}
+	}
+
+	out := make([]byte, len(text)/2)
+	for i := range out {
+		out[i] = byte(strings.IndexByte(hexDigits, text[2*i]))<<4 | byte(strings.IndexByte(hexDigits, text[2*i+1]))
+	}
+	return out, nil
+}
+
+// Crockford's base32 avoids I, L, O and U so it can be read aloud; decoding
+// is case-insensitive and maps the look-alikes back.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func encodeCrockford(data []byte) string {
+	var b strings.Builder
+	var acc uint32
+	var bits uint
+	for _, v := range data {
+		acc = acc<<8 | uint32(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(crockfordAlphabet[acc>>bits&31])
+		}
+	}
+	if bits > 0 {
+		b.WriteByte(crockfordAlphabet[acc<<(5-bits)&31])
+	}
+	return b.String()
+}
+
+func decodeCrockford(text string) ([]byte, error) {
+	var out []byte
+	var acc uint32
+	var bits uint
+	for i, r := range strings.ToUpper(text) {
+		switch r {
+		case '-':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		v := strings.IndexRune(crockfordAlphabet, r)
+		if v < 0 {
+			return nil, &DecodeError{Encoding: EncodingBase32, Offset: i}
+		}
+		acc = acc<<5 | uint32(v)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return nil, &DecodeError{Encoding: EncodingBase32, Offset: len(text), Reason: "trailing bits"}
+	}
+	return out, nil
+}
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	// base58Chunk digits are converted per big.Int operation.
+	base58Chunk = 10
+)
+
+var base58ChunkBase = new(big.Int).Exp(big.NewInt(58), big.NewInt(base58Chunk), nil)
+
+// encodeBase58 uses the Bitcoin alphabet; leading zero bytes become '1'.
+func encodeBase58(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	var digits []byte
+	x := new(big.Int).SetBytes(data[zeros:])
+	rem := new(big.Int)
+	for x.Sign() > 0 {
+		x.QuoRem(x, base58ChunkBase, rem)
+		r := rem.Uint64()
+		for i := 0; i < base58Chunk && (x.Sign() > 0 || r > 0); i++ {
+			digits = append(digits, base58Alphabet[r%58])
+			r /= 58
+		}
+	}
+
+	out := make([]byte, zeros, zeros+len(digits))
+	for i := range out {
+		out[i] = '1'
+	}
+	for i := len(digits) - 1; i >= 0; i-- {
+		out = append(out, digits[i])
+	}
+	return string(out)
+}
+
+func decodeBase58(text string) ([]byte, error) {
+	if i := strings.IndexFunc(text, func(r rune) bool { return !strings.ContainsRune(base58Alphabet, r) }); i >= 0 {
+		return nil, &DecodeError{Encoding: EncodingBase58, Offset: i}
+	}
+
+	zeros := 0
+	for zeros < len(text) && text[zeros] == '1' {
+		zeros++
+	}
+
+	x := new(big.Int)
+	chunk := new(big.Int)
+	for rest := text[zeros:]; rest != ""; {
+		n := min(len(rest), base58Chunk)
+		var v uint64
+		for _, c := range []byte(rest[:n]) {
+			v = v*58 + uint64(strings.IndexByte(base58Alphabet, c))
+		}
+		scale := new(big.Int).Exp(big.NewInt(58), big.NewInt(int64(n)), nil)
+		x.Mul(x, scale).Add(x, chunk.SetUint64(v))
+		rest = rest[n:]
+	}
+
+	return append(make([]byte, zeros), x.Bytes()...), nil
+}
+
+// Z85 is ZeroMQ's ascii85 variant. A final partial group of n bytes is
+// written as n+1 characters, as Ascii85 does, so any length round-trips.
+const z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+func encodeZ85(data []byte) string {
+	out := make([]byte, 0, (len(data)+3)/4*5)
+	for len(data) > 0 {
+		n := min(len(data), 4)
+		var group [4]byte
+		copy(group[:], data[:n])
+		v := uint32(group[0])<<24 | uint32(group[1])<<16 | uint32(group[2])<<8 | uint32(group[3])
+
+		var chars [5]byte
+		for i := 4; i >= 0; i-- {
+			chars[i] = z85Alphabet[v%85]
+			v /= 85
+		}
+		out = append(out, chars[:n+1]...)
+		data = data[n:]
+	}
+	return string(out)
+}
+
+func decodeZ85(text string) ([]byte, error) {
+	if len(text)%5 == 1 {
+		return nil, &DecodeError{Encoding: EncodingZ85, Offset: len(text) - 1, Reason: "dangling character"}
+	}
+
+	out := make([]byte, 0, len(text)/5*4+3)
+	for start := 0; start < len(text); start += 5 {
+		group := text[start:min(start+5, len(text))]
+
+		var v uint64
+		for i := 0; i < 5; i++ {
+			d := len(z85Alphabet) - 1
+			if i < len(group) {
+				if d = strings.IndexByte(z85Alphabet, group[i]); d < 0 {
+					return nil, &DecodeError{Encoding: EncodingZ85, Offset: start + i}
+				}
+			}
+			v = v*85 + uint64(d)
+		}
+		if v > 0xffffffff {
+			return nil, &DecodeError{Encoding: EncodingZ85, Offset: start, Reason: "group out of range"}
+		}
+
+		word := [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, word[:len(group)-1]...)
+	}
+	return out, nil
+}
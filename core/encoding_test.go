@@ -0,0 +1,160 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncodingVectors(t *testing.T) {
+	vectors := []struct {
+		encoding string
+		data     []byte
+		text     string
+	}{
+		{EncodingZ85, []byte{0x86, 0x4f, 0xd2, 0x6f, 0xb5, 0x59, 0xf7, 0x5b}, "HelloWorld"},
+		{EncodingBase58, []byte("Hello World!"), "2NEpo7TZRRrLZSi2U"},
+		{EncodingBase58, []byte{0, 0, 1}, "112"},
+		{EncodingBase32, []byte("foobar"), "CSQPYRK1E8"},
+		{EncodingHex, []byte{0xde, 0xad, 0xbe, 0xef}, "deadbeef"},
+		{EncodingBase64URL, []byte{0xfb, 0xff}, "-_8"},
+	}
+
+	for _, v := range vectors {
+		enc, err := EncodingByName(v.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := enc.Encode(v.data); got != v.text {
+			t.Errorf("%s Encode(%x) = %q, want %q", v.encoding, v.data, got, v.text)
+		}
+		if got, err := enc.Decode(v.text); err != nil || !bytes.Equal(got, v.data) {
+			t.Errorf("%s Decode(%q) = %x, %v, want %x", v.encoding, v.text, got, err, v.data)
+		}
+	}
+}
+
+func TestEncodingsRoundTrip(t *testing.T) {
+	c := NewCryptor("secret", AlgAES256GCM, testKDF)
+	encoded, err := c.Encrypt("hello encodings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, enc := range Encodings() {
+		t.Run(enc.Name, func(t *testing.T) {
+			for n := 0; n < 40; n++ {
+				data := bytes.Repeat([]byte{0}, n%3)
+				for i := len(data); i < n; i++ {
+					data = append(data, byte(i*37+n))
+				}
+				got, err := enc.Decode(enc.Encode(data))
+				if err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("round trip of %x = %x, %v", data, got, err)
+				}
+			}
+
+			text, err := EncodeCiphertext(encoded, enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := c.Decrypt(text)
+			if err != nil {
+				t.Fatalf("Decrypt(%s): %v", text, err)
+			}
+			if decoded != "hello encodings" {
+				t.Fatalf("Decrypt = %q", decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		offset   int
+	}{
+		{EncodingBase64, "VEVE*Q==", 4},
+		{EncodingHex, "5445zz", 4},
+		{EncodingBase58, "2NEp0", 4},
+		{EncodingBase32, "CSQ*", 3},
+		{EncodingZ85, "Hel~oWorld", 3},
+	}
+
+	for _, tt := range tests {
+		enc, err := EncodingByName(tt.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = enc.Decode(tt.text)
+
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Offset != tt.offset {
+			t.Errorf("%s Decode(%q) = %v, want error at position %d", tt.encoding, tt.text, err, tt.offset)
+		}
+		if !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("%s Decode(%q) = %v, want %v", tt.encoding, tt.text, err, ErrInvalidEncoding)
+		}
+	}
+
+	if _, err := NewCryptor("secret", AlgAES256GCM, testKDF).Decrypt("not*base64"); !errors.Is(err, ErrInvalidBase64) {
+		t.Fatalf("Decrypt of junk = %v, want %v", err, ErrInvalidBase64)
+	}
+}
+
+func TestDecryptNamesDamagedEncoding(t *testing.T) {
+	// 0xfb salt bytes put '+' and '/' early in base64 and '-' and '_' in
+	// base64url, so neither alphabet can stand in for the other.
+	env := &Envelope{
+		Version:    CurrentEnvelopeVersion,
+		Algorithm:  AlgAES256GCM,
+		KDF:        testKDF,
+		Salt:       bytes.Repeat([]byte{0xfb}, SaltSize),
+		Nonce:      make([]byte, 12),
+		Ciphertext: bytes.Repeat([]byte{0x5a, 0xc3, 0x0f}, 20),
+	}
+	data := env.Marshal()
+	c := NewCryptor("secret", AlgAES256GCM, testKDF)
+
+	tests := []struct {
+		encoding string
+		damage   string // replaces the character at position 40
+		cut      int    // characters dropped from the end instead
+		want     string
+	}{
+		{encoding: EncodingBase64, damage: "*", want: "invalid base64 encoding at position 40"},
+		{encoding: EncodingBase64, damage: "-", want: "invalid base64 encoding at position 40"},
+		{encoding: EncodingBase64URL, damage: "*", want: "invalid base64url encoding at position 40"},
+		{encoding: EncodingBase64URL, damage: "+", want: "invalid base64url encoding at position 40"},
+		{encoding: EncodingBase32, damage: "U", want: "invalid base32 encoding at position 40"},
+		{encoding: EncodingHex, damage: "g", want: "invalid hex encoding at position 40"},
+		{encoding: EncodingZ85, damage: "~", want: "invalid z85 encoding at position 40"},
+		{encoding: EncodingBase58, damage: "0", want: "invalid base58 encoding at position 40"},
+		{encoding: EncodingBase58, damage: "+", want: "invalid base58 encoding at position 40"},
+		{encoding: EncodingHex, cut: 1, want: "invalid hex encoding at position 213: odd length"},
+		{encoding: EncodingZ85, cut: 3, want: "invalid z85 encoding at position 130: dangling character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			enc, err := EncodingByName(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := enc.Encode(data)
+			if tt.cut > 0 {
+				text = text[:len(text)-tt.cut]
+			} else {
+				text = text[:40] + tt.damage + text[41:]
+			}
+
+			_, err = c.Decrypt(text)
+			if !errors.Is(err, ErrInvalidEncoding) || err.Error() != tt.want {
+				t.Fatalf("Decrypt = %v, want %q", err, tt.want)
+			}
+			if isBase64 := tt.encoding == EncodingBase64; errors.Is(err, ErrInvalidBase64) != isBase64 {
+				t.Fatalf("errors.Is(%v, ErrInvalidBase64) = %t, want %t", err, !isBase64, isBase64)
+			}
+		})
+	}
+}
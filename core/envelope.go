@@ -0,0 +1,276 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	EnvelopeMagic = "TEDC"
+
+	EnvelopeLegacy byte = 0
+	EnvelopeV1     byte = 1
+
+	CurrentEnvelopeVersion = EnvelopeV1
+
+	FlagStream     byte = 1 << 0
+	FlagRecipients byte = 1 << 1
+	FlagContext    byte = 1 << 2
+	// FlagPacked marks message envelopes whose plaintext was compressed or
+	// padded; stream envelopes never carry it.
+	FlagPacked byte = 1 << 3
+
+	knownFlags = FlagStream | FlagRecipients | FlagContext | FlagPacked
+
+	MaxContextSize = 255
+)
+
+var (
+	ErrNotEnvelope          = errors.New("data is not a framed envelope")
+	ErrUnknownVersion       = errors.New("unknown envelope version")
+	ErrTruncatedHeader      = errors.New("truncated envelope header")
+	ErrUnsupportedAlgorithm = errors.New("unsupported encryption algorithm")
+	ErrUnsupportedFlags     = errors.New("unsupported envelope flags")
+	ErrStreamEnvelope       = errors.New("ciphertext is a stream envelope; decrypt it as a file")
+	ErrInvalidContext       = errors.New("invalid context label")
+	ErrContextMismatch      = errors.New("context label does not match")
+)
+
+type AlgorithmID byte
+
+const (
+	AlgAES256GCM AlgorithmID = iota + 1
+	AlgXChaCha20Poly1305
+	AlgAES256GCMSIV
+)
+
+func (a AlgorithmID) String() string {
+	switch a {
+	case AlgAES256GCM:
+		return "AES-256-GCM"
+	case AlgXChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	case AlgAES256GCMSIV:
+		return "AES-256-GCM-SIV"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(a))
+	}
+}
+
+type Envelope struct {
+	Version    byte
+	Flags      byte
+	Algorithm  AlgorithmID
+	KDF        KDFParams
+	Salt       []byte
+	Nonce      []byte
+	Recipients []Stanza
+	Context    string
+
+	Compression CompressionID
+	Padding     PaddingID
+
+	Ciphertext []byte
+}
+
+type envelopeParser func(data []byte) (*Envelope, error)
+
+var envelopeParsers = map[byte]envelopeParser{
+	EnvelopeV1: parseEnvelopeV1,
+}
+
+func (e *Envelope) Header() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(EnvelopeMagic)
+	buf.WriteByte(e.Version)
+	buf.WriteByte(e.Flags)
+	buf.WriteByte(byte(e.Algorithm))
+	buf.Write(e.KDF.marshal())
+	buf.WriteByte(byte(len(e.Salt)))
+	buf.Write(e.Salt)
+	buf.WriteByte(byte(len(e.Nonce)))
+	buf.Write(e.Nonce)
+	if e.Flags&FlagRecipients != 0 {
+		buf.WriteByte(byte(len(e.Recipients)))
+		for _, stanza := range e.Recipients {
+			buf.WriteByte(byte(len(stanza.Share)))
+			buf.Write(stanza.Share)
+			buf.WriteByte(byte(len(stanza.WrappedKey)))
+			buf.Write(stanza.WrappedKey)
+		}
+	}
+	if e.Flags&FlagContext != 0 {
+		buf.WriteByte(byte(len(e.Context)))
+		buf.WriteString(e.Context)
+	}
+	if e.Flags&FlagPacked != 0 {
+		buf.WriteByte(byte(e.Compression))
+		buf.WriteByte(byte(e.Padding))
+	}
+	return buf.Bytes()
+}
+
+// ValidateContext accepts labels of up to MaxContextSize bytes of printable
+// UTF-8. The empty label means no context.
+func ValidateContext(context string) error {
+	if len(context) > MaxContextSize {
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidContext, MaxContextSize)
+	}
+	if !utf8.ValidString(context) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidContext)
+	}
+	for _, r := range context {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: contains control characters", ErrInvalidContext)
+		}
+	}
+	return nil
+}
+
+// setContext stores an already validated label; the header, and so the
+// AAD, carries it from then on.
+func (e *Envelope) setContext(context string) {
+	if context == "" {
+		return
+	}
+	e.Flags |= FlagContext
+	e.Context = context
+}
+
+// checkContext must only run once the envelope has been authenticated, so
+// the label it compares is the one the sender wrote.
+func (e *Envelope) checkContext(expected string) error {
+	if expected != "" && e.Context != expected {
+		return fmt.Errorf("%w: ciphertext is bound to %q, expected %q", ErrContextMismatch, e.Context, expected)
+	}
+	return nil
+}
+
+func (e *Envelope) Marshal() []byte {
+	return append(e.Header(), e.Ciphertext...)
+}
+
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(EnvelopeMagic))
+}
+
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	if !IsEnvelope(data) {
+		return nil, ErrNotEnvelope
+	}
+
+	if len(data) < len(EnvelopeMagic)+1 {
+		return nil, ErrTruncatedHeader
+	}
+
+	version := data[len(EnvelopeMagic)]
+	parse, ok := envelopeParsers[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return parse(data)
+}
+
+func parseEnvelopeV1(data []byte) (*Envelope, error) {
+	r := headerReader{data: data[len(EnvelopeMagic):]}
+
+	env := &Envelope{
+		Version:   r.byte(),
+		Flags:     r.byte(),
+		Algorithm: AlgorithmID(r.byte()),
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if env.Flags&^knownFlags != 0 || env.Flags&(FlagStream|FlagPacked) == FlagStream|FlagPacked {
+		return nil, fmt.Errorf("%w: %#02x", ErrUnsupportedFlags, env.Flags)
+	}
+
+	if _, err := SuiteByID(env.Algorithm); err != nil {
+		return nil, err
+	}
+
+	kdf, n, err := unmarshalKDFParams(r.rest())
+	if err != nil {
+		if errors.Is(err, ErrInvalidCiphertext) {
+			return nil, ErrTruncatedHeader
+		}
+		return nil, err
+	}
+	env.KDF = kdf
+	r.skip(n)
+
+	env.Salt = r.prefixed()
+	env.Nonce = r.prefixed()
+	if env.Flags&FlagRecipients != 0 {
+		n := int(r.byte())
+		for i := 0; i < n && r.err == nil; i++ {
+			env.Recipients = append(env.Recipients, Stanza{Share: r.prefixed(), WrappedKey: r.prefixed()})
+		}
+	}
+	if env.Flags&FlagContext != 0 {
+		env.Context = string(r.prefixed())
+	}
+	if env.Flags&FlagPacked != 0 {
+		env.Compression = CompressionID(r.byte())
+		env.Padding = PaddingID(r.byte())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := (Packing{Compression: env.Compression, Padding: env.Padding}).Validate(); err != nil {
+		return nil, err
+	}
+
+	if (env.KDF.ID == KDFX25519) != (env.Flags&FlagRecipients != 0) {
+		return nil, fmt.Errorf("%w: kdf %s with flags %#02x", ErrUnsupportedKDF, env.KDF.ID, env.Flags)
+	}
+
+	env.Ciphertext = r.rest()
+	return env, nil
+}
+
+type headerReader struct {
+	data []byte
+	err  error
+}
+
+func (r *headerReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 1 {
+		r.err = ErrTruncatedHeader
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *headerReader) prefixed() []byte {
+	n := int(r.byte())
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = ErrTruncatedHeader
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *headerReader) skip(n int) {
+	r.data = r.data[n:]
+}
+
+func (r *headerReader) rest() []byte {
+	return r.data
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrKeyfile           = errors.New("unusable keyfile")
+	ErrChallengeResponse = errors.New("challenge-response failed")
+)
+
+const secretFactorsLabel = "TEDC secret factors v1"
+
+// ChallengeResponder answers a challenge with a keyed response, as a
+// hardware token in HMAC challenge-response mode does.
+type ChallengeResponder interface {
+	Respond(challenge []byte) ([]byte, error)
+}
+
+// ChallengeProvider opens a responder from the argument of a "name:arg"
+// specification, for example "hmac-sha1:/media/usb/token.hex".
+type ChallengeProvider struct {
+	Name string
+	Open func(arg string) (ChallengeResponder, error)
+}
+
+var (
+	challengeProvidersMu sync.RWMutex
+	challengeProviders   = []ChallengeProvider{
+		{Name: "hmac-sha1", Open: openHMACResponder},
+	}
+)
+
+func RegisterChallengeProvider(p ChallengeProvider) error {
+	challengeProvidersMu.Lock()
+	defer challengeProvidersMu.Unlock()
+
+	for _, existing := range challengeProviders {
+		if strings.EqualFold(existing.Name, p.Name) {
+			return fmt.Errorf("challenge provider %s is already registered", p.Name)
+		}
+	}
+	challengeProviders = append(challengeProviders, p)
+	return nil
+}
+
+func ChallengeProviders() []ChallengeProvider {
+	challengeProvidersMu.RLock()
+	defer challengeProvidersMu.RUnlock()
+	return append([]ChallengeProvider(nil), challengeProviders...)
+}
+
+// OpenChallengeResponder resolves a "name:arg" specification against the
+// registered providers.
+func OpenChallengeResponder(spec string) (ChallengeResponder, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	for _, p := range ChallengeProviders() {
+		if strings.EqualFold(p.Name, name) {
+			r, err := p.Open(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrChallengeResponse, p.Name, err)
+			}
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown provider %q", ErrChallengeResponse, name)
+}
+
+// HMACResponder is a software stand-in for a token slot programmed with
+// an HMAC-SHA1 secret.
+type HMACResponder struct {
+	Key []byte
+}
+
+func (r HMACResponder) Respond(challenge []byte) ([]byte, error) {
+	mac := hmac.New(sha1.New, r.Key)
+	mac.Write(challenge)
+	return mac.Sum(nil), nil
+}
+
+// openHMACResponder reads a hex secret, in the form token personalization
+// tools print, from the file at path.
+func openHMACResponder(path string) (ChallengeResponder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a hex secret", path)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%s: empty secret", path)
+	}
+	return HMACResponder{Key: key}, nil
+}
+
+// SecretFactors are combined with a typed passphrase so that the passphrase
+// alone cannot decrypt. Keyfiles may be given in any order.
+type SecretFactors struct {
+	Keyfiles  []string
+	Responder ChallengeResponder
+}
+
+func (f SecretFactors) Empty() bool {
+	return len(f.Keyfiles) == 0 && f.Responder == nil
+}
+
+// Compose returns the passphrase unchanged when there are no factors, so
+// existing ciphertexts keep decrypting. Otherwise it returns a hex digest
+// of the passphrase, the keyfile hashes and the token's response to a
+// challenge derived from both; the KDF stretches it like any secret.
+func (f SecretFactors) Compose(passphrase string) (string, error) {
+	if f.Empty() {
+		return passphrase, nil
+	}
+
+	hashes := make([][]byte, len(f.Keyfiles))
+	for i, path := range f.Keyfiles {
+		sum, err := HashKeyfile(path)
+		if err != nil {
+			return "", err
+		}
+		hashes[i] = sum
+	}
+	slices.SortFunc(hashes, bytes.Compare)
+
+	h := sha256.New()
+	writePrefixed(h, []byte(secretFactorsLabel))
+	writePrefixed(h, []byte(passphrase))
+	for _, sum := range hashes {
+		writePrefixed(h, sum)
+	}
+
+	if f.Responder != nil {
+		response, err := f.Responder.Respond(h.Sum(nil))
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrChallengeResponse, err)
+		}
+		writePrefixed(h, response)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashKeyfile returns the SHA-256 of the file at path. Any file will do,
+// but it must not be empty.
+func HashKeyfile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeyfile, err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrKeyfile, path, err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: %s is empty", ErrKeyfile, path)
+	}
+	return h.Sum(nil), nil
+}
+
+func writePrefixed(h hash.Hash, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	h.Write(n[:])
+	h.Write(data)
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHMACResponder(t *testing.T) {
+	// RFC 2202, test case 2.
+	got, _ := HMACResponder{Key: []byte("Jefe")}.Respond([]byte("what do ya want for nothing?"))
+	if want := "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"; hex.EncodeToString(got) != want {
+		t.Fatalf("Respond = %x, want %s", got, want)
+	}
+}
+
+func TestSecretFactors(t *testing.T) {
+	a := writeTestFile(t, "a.key", "first keyfile")
+	b := writeTestFile(t, "b.png", "second keyfile")
+	token := writeTestFile(t, "token.hex", "4a 65 66 65\n")
+
+	if got, _ := (SecretFactors{}).Compose("pw"); got != "pw" {
+		t.Fatalf("Compose without factors = %q, want the passphrase", got)
+	}
+
+	ab, err := SecretFactors{Keyfiles: []string{a, b}}.Compose("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ba, _ := (SecretFactors{Keyfiles: []string{b, a}}).Compose("pw"); ba != ab {
+		t.Fatal("keyfile order changed the composed secret")
+	}
+	if onlyA, _ := (SecretFactors{Keyfiles: []string{a}}).Compose("pw"); onlyA == ab {
+		t.Fatal("dropping a keyfile did not change the composed secret")
+	}
+
+	responder, err := OpenChallengeResponder("hmac-sha1:" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withToken, err := SecretFactors{Keyfiles: []string{a, b}, Responder: responder}.Compose("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withToken == ab {
+		t.Fatal("challenge-response did not change the composed secret")
+	}
+
+	c := NewCryptor(withToken, AlgAES256GCM, testKDF)
+	encoded, err := c.Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCryptor(ab, AlgAES256GCM, testKDF).Decrypt(encoded); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("Decrypt without the token = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestSecretFactorErrors(t *testing.T) {
+	empty := writeTestFile(t, "empty", "")
+	if _, err := (SecretFactors{Keyfiles: []string{empty}}).Compose("pw"); !errors.Is(err, ErrKeyfile) {
+		t.Errorf("Compose with empty keyfile = %v, want %v", err, ErrKeyfile)
+	}
+	if _, err := (SecretFactors{Keyfiles: []string{empty + ".missing"}}).Compose("pw"); !errors.Is(err, ErrKeyfile) {
+		t.Errorf("Compose with missing keyfile = %v, want %v", err, ErrKeyfile)
+	}
+	for _, spec := range []string{"yubikey:2", "hmac-sha1:" + writeTestFile(t, "bad.hex", "not hex")} {
+		if _, err := OpenChallengeResponder(spec); !errors.Is(err, ErrChallengeResponse) {
+			t.Errorf("OpenChallengeResponder(%q) = %v, want %v", spec, err, ErrChallengeResponse)
+		}
+	}
+}
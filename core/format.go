@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"filippo.io/age/armor"
+)
+
+type Format int
+
+const (
+	FormatNative Format = iota
+	FormatAge
+	FormatOpenSSL
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatNative:
+		return "native"
+	case FormatAge:
+		return "age"
+	case FormatOpenSSL:
+		return "openssl"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(f))
+	}
+}
+
+func FormatByName(name string) (Format, error) {
+	for _, f := range []Format{FormatNative, FormatAge, FormatOpenSSL} {
+		if strings.EqualFold(f.String(), name) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q", name)
+}
+
+// DetectFormat reports FormatAge for armored or binary age files,
+// FormatOpenSSL for base64 `openssl enc -salt` output and FormatNative for
+// everything else.
+func DetectFormat(ciphertext string) Format {
+	ciphertext = strings.TrimSpace(ciphertext)
+	switch {
+	case strings.HasPrefix(ciphertext, armor.Header) || strings.HasPrefix(ciphertext, ageMagic):
+		return FormatAge
+	case strings.HasPrefix(ciphertext, opensslBase64Magic):
+		return FormatOpenSSL
+	default:
+		return FormatNative
+	}
+}
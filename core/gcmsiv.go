@@ -0,0 +1,228 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+
+	gcmSIVMaxPlaintext = 1 << 36
+)
+
+var errGCMSIVOpen = errors.New("cipher: message authentication failed")
+
+// gcmSIV implements AEAD_AES_256_GCM_SIV (RFC 8452). A repeated nonce only
+// reveals whether two messages were identical.
+type gcmSIV struct {
+	block cipher.Block
+}
+
+func newGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, aes.KeySizeError(len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmSIV{block: block}, nil
+}
+
+func (g *gcmSIV) NonceSize() int { return gcmSIVNonceSize }
+
+func (g *gcmSIV) Overhead() int { return gcmSIVTagSize }
+
+func (g *gcmSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("gcmsiv: incorrect nonce length given to GCM-SIV")
+	}
+	if uint64(len(plaintext)) > gcmSIVMaxPlaintext {
+		panic("gcmsiv: message too large for GCM-SIV")
+	}
+
+	authKey, encBlock := g.deriveKeys(nonce)
+	tag := gcmSIVTag(authKey, encBlock, nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSIVTagSize)
+	gcmSIVCTR(encBlock, tag, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (g *gcmSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("gcmsiv: incorrect nonce length given to GCM-SIV")
+	}
+	if len(ciphertext) < gcmSIVTagSize || uint64(len(ciphertext)) > gcmSIVMaxPlaintext+gcmSIVTagSize {
+		return nil, errGCMSIVOpen
+	}
+
+	var tag [16]byte
+	copy(tag[:], ciphertext[len(ciphertext)-gcmSIVTagSize:])
+	ciphertext = ciphertext[:len(ciphertext)-gcmSIVTagSize]
+
+	authKey, encBlock := g.deriveKeys(nonce)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	gcmSIVCTR(encBlock, tag, out, ciphertext)
+
+	expected := gcmSIVTag(authKey, encBlock, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag[:]) != 1 {
+		clear(out)
+		return nil, errGCMSIVOpen
+	}
+
+	return ret, nil
+}
+
+func (g *gcmSIV) deriveKeys(nonce []byte) ([16]byte, cipher.Block) {
+	var input, output [16]byte
+	var derived [48]byte
+
+	copy(input[4:], nonce)
+	for i := 0; i < 6; i++ {
+		binary.LittleEndian.PutUint32(input[:4], uint32(i))
+		g.block.Encrypt(output[:], input[:])
+		copy(derived[i*8:], output[:8])
+	}
+
+	var authKey [16]byte
+	copy(authKey[:], derived[:16])
+
+	encBlock, err := aes.NewCipher(derived[16:48])
+	if err != nil {
+		panic(err)
+	}
+
+	clear(derived[:])
+	return authKey, encBlock
+}
+
+func gcmSIVTag(authKey [16]byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) [16]byte {
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	s := p.sum()
+	for i := 0; i < gcmSIVNonceSize; i++ {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+
+	var tag [16]byte
+	encBlock.Encrypt(tag[:], s[:])
+	return tag
+}
+
+func gcmSIVCTR(encBlock cipher.Block, tag [16]byte, dst, src []byte) {
+	counter := tag
+	counter[15] |= 0x80
+
+	var keystream [16]byte
+	for len(src) > 0 {
+		encBlock.Encrypt(keystream[:], counter[:])
+		n := subtle.XORBytes(dst, src, keystream[:])
+		dst, src = dst[n:], src[n:]
+
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+// polyval computes POLYVAL through its GHASH equivalence (RFC 8452,
+// Appendix A): byte-reversed inputs hashed under mulX_GHASH(ByteReverse(H)).
+type polyval struct {
+	h   fieldElement
+	acc fieldElement
+}
+
+type fieldElement struct {
+	hi, lo uint64
+}
+
+func newPolyval(key [16]byte) *polyval {
+	reverseBytes(key[:])
+	h := fieldElement{
+		hi: binary.BigEndian.Uint64(key[:8]),
+		lo: binary.BigEndian.Uint64(key[8:]),
+	}
+	return &polyval{h: h.mulX()}
+}
+
+func (p *polyval) update(data []byte) {
+	for len(data) > 0 {
+		var block [16]byte
+		n := copy(block[:], data)
+		data = data[n:]
+
+		reverseBytes(block[:])
+		p.acc.hi ^= binary.BigEndian.Uint64(block[:8])
+		p.acc.lo ^= binary.BigEndian.Uint64(block[8:])
+		p.acc = p.acc.mul(p.h)
+	}
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.BigEndian.PutUint64(out[:8], p.acc.hi)
+	binary.BigEndian.PutUint64(out[8:], p.acc.lo)
+	reverseBytes(out[:])
+	return out
+}
+
+const ghashReduction = 0xe1 << 56
+
+func (x fieldElement) mulX() fieldElement {
+	mask := -(x.lo & 1)
+	return fieldElement{
+		hi: x.hi>>1 ^ ghashReduction&mask,
+		lo: x.lo>>1 | x.hi<<63,
+	}
+}
+
+func (x fieldElement) mul(y fieldElement) fieldElement {
+	var z fieldElement
+	v := y
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = x.hi >> (63 - i) & 1
+		} else {
+			bit = x.lo >> (127 - i) & 1
+		}
+		mask := -bit
+		z.hi ^= v.hi & mask
+		z.lo ^= v.lo & mask
+		v = v.mulX()
+	}
+	return z
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestGCMSIVVectors checks the AEAD_AES_256_GCM_SIV vectors of RFC 8452
+// appendix C.2 and the counter wrap vectors of C.3.
+func TestGCMSIVVectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		nonce     string
+		aad       string
+		plaintext string
+		want      string
+	}{
+		{
+			name:  "empty",
+			key:   "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce: "030000000000000000000000",
+			want:  "07f5f4169bbf55a8400cd47ea6fd400f",
+		},
+		{
+			name:      "8 bytes",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "0100000000000000",
+			want:      "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28",
+		},
+		{
+			name:      "12 bytes",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "010000000000000000000000",
+			want:      "9aab2aeb3faa0a34aea8e2b18ca50da9ae6559e48fd10f6e5c9ca17e",
+		},
+		{
+			name:      "two blocks",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "0100000000000000000000000000000002000000000000000000000000000000",
+			want:      "4a6a9db4c8c6549201b9edb53006cba821ec9cf850948a7c86c68ac7539d027fe819e63abcd020b006a976397632eb5d",
+		},
+		{
+			name:      "three blocks",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "010000000000000000000000000000000200000000000000000000000000000003000000000000000000000000000000",
+			want:      "c00d121893a9fa603f48ccc1ca3c57ce7499245ea0046db16c53c7c66fe717e39cf6c748837b61f6ee3adcee17534ed5790bc96880a99ba804bd12c0e6a22cc4",
+		},
+		{
+			name:      "aad, 8 bytes",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			aad:       "01",
+			plaintext: "0200000000000000",
+			want:      "1de22967237a813291213f267e3b452f02d01ae33e4ec854",
+		},
+		{
+			name:      "aad, 12 bytes",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			aad:       "01",
+			plaintext: "020000000000000000000000",
+			want:      "163d6f9cc1b346cd453a2e4cc1a4a19ae800941ccdc57cc8413c277f",
+		},
+		{
+			name:      "aad, two blocks",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			aad:       "01",
+			plaintext: "0200000000000000000000000000000003000000000000000000000000000000",
+			want:      "07dad364bfc2b9da89116d7bef6daaaf6f255510aa654f920ac81b94e8bad365aea1bad12702e1965604374aab96dbbc",
+		},
+		{
+			name:      "long aad, 4 bytes",
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			aad:       "010000000000000000000000",
+			plaintext: "02000000",
+			want:      "22b3f4cd1835e517741dfddccfa07fa4661b74cf",
+		},
+		{
+			name:      "counter wrap",
+			key:       "0000000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "000000000000000000000000",
+			plaintext: "000000000000000000000000000000004db923dc793ee6497c76dcc03a98e108",
+			want:      "f3f80f2cf0cb2dd9c5984fcda908456cc537703b5ba70324a6793a7bf218d3eaffffffff000000000000000000000000",
+		},
+		{
+			name:      "counter wrap, partial block",
+			key:       "0000000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "000000000000000000000000",
+			plaintext: "eb3640277c7ffd1303c7a542d02d3e4c0000000000000000",
+			want:      "18ce4f0b8cb4d0cac65fea8f79257b20888e53e72299e56dffffffff000000000000000000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aead, err := newGCMSIV(mustHex(t, tt.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonce := mustHex(t, tt.nonce)
+			aad := mustHex(t, tt.aad)
+			plaintext := mustHex(t, tt.plaintext)
+
+			sealed := aead.Seal(nil, nonce, plaintext, aad)
+			if got := hex.EncodeToString(sealed); got != tt.want {
+				t.Fatalf("Seal = %s, want %s", got, tt.want)
+			}
+
+			opened, err := aead.Open(nil, nonce, sealed, aad)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Fatalf("Open = %x, want %x", opened, plaintext)
+			}
+		})
+	}
+}
+
+func TestGCMSIVRejectsTampering(t *testing.T) {
+	aead, err := newGCMSIV(make([]byte, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	aad := []byte("header")
+
+	sealed := aead.Seal(nil, nonce, []byte("a message longer than one block"), aad)
+
+	for i := range sealed {
+		tampered := bytes.Clone(sealed)
+		tampered[i] ^= 1
+		if _, err := aead.Open(nil, nonce, tampered, aad); err == nil {
+			t.Fatalf("Open accepted ciphertext with byte %d flipped", i)
+		}
+	}
+
+	if _, err := aead.Open(nil, nonce, sealed, []byte("other")); err == nil {
+		t.Fatal("Open accepted mismatched additional data")
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KeySize  = 32
+	SaltSize = 16
+
+	kdfParamsSize = 9
+
+	maxArgon2Time    = 16
+	maxArgon2Memory  = 1024 * 1024
+	maxArgon2Threads = 64
+	maxScryptLogN    = 22
+	maxScryptR       = 32
+	maxScryptP       = 16
+)
+
+var (
+	ErrUnsupportedKDF = errors.New("unsupported key derivation function")
+	ErrInvalidKDF     = errors.New("invalid key derivation parameters")
+)
+
+type KDFID byte
+
+const (
+	KDFLegacySHA256 KDFID = iota
+	KDFArgon2id
+	KDFScrypt
+	// KDFX25519 marks envelopes whose key is wrapped to recipients instead
+	// of derived from a secret.
+	KDFX25519
+)
+
+func (id KDFID) String() string {
+	switch id {
+	case KDFLegacySHA256:
+		return "sha256"
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	case KDFX25519:
+		return "x25519"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(id))
+	}
+}
+
+type KDFParams struct {
+	ID KDFID
+
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	LogN uint8
+	R    uint32
+	P    uint32
+}
+
+func DefaultArgon2idParams() KDFParams {
+	return KDFParams{
+		ID:      KDFArgon2id,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+}
+
+func DefaultScryptParams() KDFParams {
+	return KDFParams{
+		ID:   KDFScrypt,
+		LogN: 17,
+		R:    8,
+		P:    1,
+	}
+}
+
+func (p KDFParams) Validate() error {
+	switch p.ID {
+	case KDFLegacySHA256, KDFX25519:
+		return nil
+	case KDFArgon2id:
+		if p.Time == 0 || p.Time > maxArgon2Time {
+			return fmt.Errorf("%w: argon2id time %d", ErrInvalidKDF, p.Time)
+		}
+		if p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgon2Memory {
+			return fmt.Errorf("%w: argon2id memory %d KiB", ErrInvalidKDF, p.Memory)
+		}
+		if p.Threads == 0 || p.Threads > maxArgon2Threads {
+			return fmt.Errorf("%w: argon2id threads %d", ErrInvalidKDF, p.Threads)
+		}
+		return nil
+	case KDFScrypt:
+		if p.LogN < 10 || p.LogN > maxScryptLogN {
+			return fmt.Errorf("%w: scrypt logN %d", ErrInvalidKDF, p.LogN)
+		}
+		if p.R == 0 || p.R > maxScryptR {
+			return fmt.Errorf("%w: scrypt r %d", ErrInvalidKDF, p.R)
+		}
+		if p.P == 0 || p.P > maxScryptP {
+			return fmt.Errorf("%w: scrypt p %d", ErrInvalidKDF, p.P)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedKDF, p.ID)
+	}
+}
+
+func (p KDFParams) DeriveKey(secret string, salt []byte) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch p.ID {
+	case KDFLegacySHA256:
+		return deriveKey(secret), nil
+	case KDFX25519:
+		return nil, ErrRecipientEnvelope
+	case KDFArgon2id:
+		return argon2.IDKey([]byte(secret), salt, p.Time, p.Memory, p.Threads, KeySize), nil
+	case KDFScrypt:
+		key, err := scrypt.Key([]byte(secret), salt, 1<<p.LogN, int(p.R), int(p.P), KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKDF, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKDF, p.ID)
+	}
+}
+
+func (p KDFParams) marshal() []byte {
+	buf := make([]byte, 1+kdfParamsSize)
+	buf[0] = byte(p.ID)
+
+	switch p.ID {
+	case KDFArgon2id:
+		binary.BigEndian.PutUint32(buf[1:5], p.Time)
+		binary.BigEndian.PutUint32(buf[5:9], p.Memory)
+		buf[9] = p.Threads
+	case KDFScrypt:
+		buf[1] = p.LogN
+		binary.BigEndian.PutUint32(buf[2:6], p.R)
+		binary.BigEndian.PutUint32(buf[6:10], p.P)
+	}
+
+	return buf
+}
+
+func unmarshalKDFParams(data []byte) (KDFParams, int, error) {
+	if len(data) < 1+kdfParamsSize {
+		return KDFParams{}, 0, ErrInvalidCiphertext
+	}
+
+	p := KDFParams{ID: KDFID(data[0])}
+	switch p.ID {
+	case KDFArgon2id:
+		p.Time = binary.BigEndian.Uint32(data[1:5])
+		p.Memory = binary.BigEndian.Uint32(data[5:9])
+		p.Threads = data[9]
+	case KDFScrypt:
+		p.LogN = data[1]
+		p.R = binary.BigEndian.Uint32(data[2:6])
+		p.P = binary.BigEndian.Uint32(data[6:10])
+	case KDFX25519:
+	default:
+		return KDFParams{}, 0, fmt.Errorf("%w: %s", ErrUnsupportedKDF, p.ID)
+	}
+
+	if err := p.Validate(); err != nil {
+		return KDFParams{}, 0, err
+	}
+
+	return p, 1 + kdfParamsSize, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+func deriveKey(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// cheapArgon2id keeps Argon2id tests fast; decrypt takes the cost from the
+// header, so any valid parameters round trip.
+var cheapArgon2id = KDFParams{ID: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	encoded, err := NewCryptor("secret", AlgAES256GCM, cheapArgon2id).Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := InspectCiphertext(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.KDF != cheapArgon2id {
+		t.Fatalf("envelope KDF = %+v, want %+v", env.KDF, cheapArgon2id)
+	}
+
+	decoded, err := NewCryptor("secret", AlgAES256GCM, testKDF).Decrypt(encoded)
+	if err != nil || decoded != "hello" {
+		t.Fatalf("Decrypt = %q, %v", decoded, err)
+	}
+	if _, err := NewCryptor("wrong", AlgAES256GCM, testKDF).Decrypt(encoded); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("Decrypt with wrong secret = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+// TestDeriveKeyVectors checks Argon2id against the reference
+// implementation's test vector and scrypt against RFC 7914, section 12,
+// each cut to KeySize.
+func TestDeriveKeyVectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		params KDFParams
+		secret string
+		salt   string
+		want   string
+	}{
+		{"argon2id", KDFParams{ID: KDFArgon2id, Time: 2, Memory: 64 * 1024, Threads: 1}, "password", "somesalt",
+			"09316115d5cf24ed5a15a31a3ba326e5cf32edc24702987c02b6566f61913cf7"},
+		{"scrypt", KDFParams{ID: KDFScrypt, LogN: 10, R: 8, P: 16}, "password", "NaCl",
+			"fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.params.DeriveKey(tt.secret, []byte(tt.salt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(key); got != tt.want {
+				t.Fatalf("key = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKDFParamsBounds(t *testing.T) {
+	argon := func(time, memory uint32, threads uint8) KDFParams {
+		return KDFParams{ID: KDFArgon2id, Time: time, Memory: memory, Threads: threads}
+	}
+	scrypt := func(logN uint8, r, p uint32) KDFParams {
+		return KDFParams{ID: KDFScrypt, LogN: logN, R: r, P: p}
+	}
+
+	tests := []struct {
+		name   string
+		params KDFParams
+		want   error
+	}{
+		{"argon2id default", DefaultArgon2idParams(), nil},
+		{"argon2id maximum", argon(16, 1024*1024, 64), nil},
+		{"argon2id zero time", argon(0, 64, 1), ErrInvalidKDF},
+		{"argon2id time 17", argon(17, 64, 1), ErrInvalidKDF},
+		{"argon2id zero memory", argon(1, 0, 1), ErrInvalidKDF},
+		{"argon2id memory under 8 KiB a thread", argon(1, 31, 4), ErrInvalidKDF},
+		{"argon2id memory over 1 GiB", argon(1, 1024*1024+1, 1), ErrInvalidKDF},
+		{"argon2id zero threads", argon(1, 64, 0), ErrInvalidKDF},
+		{"argon2id 65 threads", argon(1, 1024, 65), ErrInvalidKDF},
+		{"scrypt default", DefaultScryptParams(), nil},
+		{"scrypt maximum", scrypt(22, 32, 16), nil},
+		{"scrypt zero", scrypt(0, 0, 0), ErrInvalidKDF},
+		{"scrypt logN 9", scrypt(9, 8, 1), ErrInvalidKDF},
+		{"scrypt logN 23", scrypt(23, 8, 1), ErrInvalidKDF},
+		{"scrypt zero r", scrypt(10, 0, 1), ErrInvalidKDF},
+		{"scrypt r 33", scrypt(10, 33, 1), ErrInvalidKDF},
+		{"scrypt zero p", scrypt(10, 8, 0), ErrInvalidKDF},
+		{"scrypt p 17", scrypt(10, 8, 17), ErrInvalidKDF},
+		{"unknown", KDFParams{ID: 9}, ErrUnsupportedKDF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.Validate(); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate = %v, want %v", err, tt.want)
+			}
+			p, n, err := unmarshalKDFParams(tt.params.marshal())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("unmarshal = %v, want %v", err, tt.want)
+			}
+			if err == nil && (p != tt.params || n != 1+kdfParamsSize) {
+				t.Fatalf("unmarshal = %+v, %d, want %+v", p, n, tt.params)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	opensslMagic    = "Salted__"
+	opensslSaltSize = 8
+	opensslLineSize = 64
+
+	// opensslBase64Magic is how "Salted__" starts once base64-encoded.
+	opensslBase64Magic = "U2FsdGVkX1"
+
+	maxOpenSSLIterations = 10_000_000
+)
+
+var (
+	ErrNotOpenSSL     = errors.New("ciphertext is not in openssl enc format")
+	ErrInvalidOpenSSL = errors.New("invalid openssl enc parameters")
+)
+
+type opensslCipher struct {
+	keySize int
+	ctr     bool
+}
+
+var opensslCiphers = map[string]opensslCipher{
+	"aes-128-cbc": {keySize: 16},
+	"aes-192-cbc": {keySize: 24},
+	"aes-256-cbc": {keySize: 32},
+	"aes-128-ctr": {keySize: 16, ctr: true},
+	"aes-192-ctr": {keySize: 24, ctr: true},
+	"aes-256-ctr": {keySize: 32, ctr: true},
+}
+
+var opensslDigests = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// OpenSSLParams mirrors the openssl enc options that change the key:
+// -aes-256-cbc, -pbkdf2, -iter and -md. Without PBKDF2 the key comes from
+// EVP_BytesToKey, what openssl enc used before 1.1.1.
+type OpenSSLParams struct {
+	Cipher     string
+	PBKDF2     bool
+	Iterations int
+	Digest     string
+}
+
+// DefaultOpenSSLParams matches `openssl enc -aes-256-cbc -pbkdf2` on
+// OpenSSL 1.1.1 and later.
+func DefaultOpenSSLParams() OpenSSLParams {
+	return OpenSSLParams{
+		Cipher:     "aes-256-cbc",
+		PBKDF2:     true,
+		Iterations: 10000,
+		Digest:     "sha256",
+	}
+}
+
+func OpenSSLCiphers() []string {
+	return sortedKeys(opensslCiphers)
+}
+
+func OpenSSLDigests() []string {
+	return sortedKeys(opensslDigests)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (p OpenSSLParams) Validate() error {
+	if _, ok := opensslCiphers[p.Cipher]; !ok {
+		return fmt.Errorf("%w: cipher %q (want one of %s)", ErrInvalidOpenSSL, p.Cipher, strings.Join(OpenSSLCiphers(), ", "))
+	}
+	if _, ok := opensslDigests[p.Digest]; !ok {
+		return fmt.Errorf("%w: digest %q (want one of %s)", ErrInvalidOpenSSL, p.Digest, strings.Join(OpenSSLDigests(), ", "))
+	}
+	if p.PBKDF2 && (p.Iterations < 1 || p.Iterations > maxOpenSSLIterations) {
+		return fmt.Errorf("%w: iterations must be between 1 and %d", ErrInvalidOpenSSL, maxOpenSSLIterations)
+	}
+	return nil
+}
+
+func (p OpenSSLParams) String() string {
+	if p.PBKDF2 {
+		return fmt.Sprintf("%s with pbkdf2-%s (%d iterations)", p.Cipher, p.Digest, p.Iterations)
+	}
+	return fmt.Sprintf("%s with EVP_BytesToKey-%s", p.Cipher, p.Digest)
+}
+
+// deriveKeyIV produces the key and IV from one KDF output, as openssl enc
+// does.
+func (p OpenSSLParams) deriveKeyIV(secret string, salt []byte) (key, iv []byte, err error) {
+	c := opensslCiphers[p.Cipher]
+	digest := opensslDigests[p.Digest]
+	size := c.keySize + aes.BlockSize
+
+	var material []byte
+	if p.PBKDF2 {
+		if material, err = pbkdf2.Key(digest, secret, salt, p.Iterations, size); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		material = evpBytesToKey(digest, []byte(secret), salt, size)
+	}
+
+	return material[:c.keySize], material[c.keySize:], nil
+}
+
+func evpBytesToKey(digest func() hash.Hash, secret, salt []byte, size int) []byte {
+	var out, prev []byte
+	h := digest()
+	for len(out) < size {
+		h.Reset()
+		h.Write(prev)
+		h.Write(secret)
+		h.Write(salt)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:size]
+}
+
+// OpenSSLCryptor reads and writes `openssl enc -salt -base64` output. These
+// ciphertexts are not authenticated: a wrong secret is only caught by the
+// CBC padding check or by the result not being UTF-8 text, and tampering
+// may go unnoticed. It exists to read old blobs, not to write new ones.
+type OpenSSLCryptor struct {
+	secret string
+	params OpenSSLParams
+}
+
+func NewOpenSSLCryptor(secret string, params OpenSSLParams) *OpenSSLCryptor {
+	return &OpenSSLCryptor{secret: secret, params: params}
+}
+
+func (c *OpenSSLCryptor) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if err := c.params.Validate(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, opensslSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, iv, err := c.params.deriveKeyIV(c.secret, salt)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	data := []byte(plaintext)
+	if opensslCiphers[c.params.Cipher].ctr {
+		cipher.NewCTR(block, iv).XORKeyStream(data, data)
+	} else {
+		data = pkcs7Pad(data, aes.BlockSize)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	}
+
+	out := append([]byte(opensslMagic), salt...)
+	return wrapLines(base64.StdEncoding.EncodeToString(append(out, data...)), opensslLineSize), nil
+}
+
+func (c *OpenSSLCryptor) Decrypt(encoded string) (string, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+	if !bytes.HasPrefix(data, []byte(opensslMagic)) {
+		return "", ErrNotOpenSSL
+	}
+	if err := c.params.Validate(); err != nil {
+		return "", err
+	}
+
+	data = data[len(opensslMagic):]
+	if len(data) < opensslSaltSize {
+		return "", ErrInvalidCiphertext
+	}
+	salt, data := data[:opensslSaltSize], data[opensslSaltSize:]
+
+	key, iv, err := c.params.deriveKeyIV(c.secret, salt)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	plaintext := make([]byte, len(data))
+	if opensslCiphers[c.params.Cipher].ctr {
+		cipher.NewCTR(block, iv).XORKeyStream(plaintext, data)
+	} else {
+		if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return "", ErrInvalidCiphertext
+		}
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+		if plaintext, err = pkcs7Unpad(plaintext, aes.BlockSize); err != nil {
+			return "", err
+		}
+	}
+
+	if !utf8.Valid(plaintext) {
+		return "", fmt.Errorf("%w: result is not text", ErrDecryptionFailed)
+	}
+	return string(plaintext), nil
+}
+
+func pkcs7Pad(data []byte, size int) []byte {
+	n := size - len(data)%size
+	return append(data, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs7Unpad(data []byte, size int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > size || n > len(data) {
+		return nil, fmt.Errorf("%w: bad padding", ErrDecryptionFailed)
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, fmt.Errorf("%w: bad padding", ErrDecryptionFailed)
+		}
+	}
+	return data[:len(data)-n], nil
+}
+
+func wrapLines(s string, width int) string {
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteByte('\n')
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Produced with `printf ... | openssl enc -<cipher> ... -salt -base64
+// -pass pass:secret` (OpenSSL 3.0).
+var opensslVectors = []struct {
+	name       string
+	params     OpenSSLParams
+	ciphertext string
+	plaintext  string
+}{
+	{
+		name:       "aes-256-cbc pbkdf2",
+		params:     DefaultOpenSSLParams(),
+		ciphertext: "U2FsdGVkX19Y3DFxcYk1lIi3rQEUeb7K++fK/rTZ970=",
+		plaintext:  "hello openssl",
+	},
+	{
+		name:       "aes-256-cbc EVP_BytesToKey md5",
+		params:     OpenSSLParams{Cipher: "aes-256-cbc", Digest: "md5"},
+		ciphertext: "U2FsdGVkX1/pU5s3Ss3gKqKI9dqiYV1tmRalEAwee1c=",
+		plaintext:  "hello openssl",
+	},
+	{
+		name:       "aes-128-ctr pbkdf2 sha512",
+		params:     OpenSSLParams{Cipher: "aes-128-ctr", PBKDF2: true, Iterations: 1000, Digest: "sha512"},
+		ciphertext: "U2FsdGVkX187VwpFvmJwG6T+Zf8cAZLsnYhdljQ=",
+		plaintext:  "hello openssl",
+	},
+	{
+		name:   "aes-192-cbc pbkdf2 sha1 multiline",
+		params: OpenSSLParams{Cipher: "aes-192-cbc", PBKDF2: true, Iterations: 2000, Digest: "sha1"},
+		ciphertext: "U2FsdGVkX1/zjP0TKEXkmm4Wg4WpLl2AWlq+kwbty8AuH4BxCM0IXfrbazWCd335\n" +
+			"W4PUE2eMfbpc2bkjQB58BU7tmz+wTrL1zJC2X6XuCW9qFDWkGNC/VTVPzaeH6+NG\n" +
+			"q4eL4M3suVvG8sWtNJwtoA==",
+		plaintext: "The quick brown fox jumps over the lazy dog. The quick brown fox jumps over the lazy dog.",
+	},
+}
+
+func TestOpenSSLVectors(t *testing.T) {
+	for _, v := range opensslVectors {
+		t.Run(v.name, func(t *testing.T) {
+			if DetectFormat(v.ciphertext) != FormatOpenSSL {
+				t.Fatal("DetectFormat did not recognise openssl output")
+			}
+
+			plaintext, err := NewOpenSSLCryptor("secret", v.params).Decrypt(v.ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plaintext != v.plaintext {
+				t.Fatalf("Decrypt = %q, want %q", plaintext, v.plaintext)
+			}
+
+			if _, err := NewOpenSSLCryptor("wrong", v.params).Decrypt(v.ciphertext); !errors.Is(err, ErrDecryptionFailed) {
+				t.Fatalf("Decrypt with wrong secret = %v, want %v", err, ErrDecryptionFailed)
+			}
+		})
+	}
+}
+
+func TestOpenSSLRoundTrip(t *testing.T) {
+	plaintext := strings.Repeat("runbook line\n", 20)
+
+	for _, name := range OpenSSLCiphers() {
+		t.Run(name, func(t *testing.T) {
+			params := DefaultOpenSSLParams()
+			params.Cipher = name
+			c := NewOpenSSLCryptor("secret", params)
+
+			encoded, err := c.Encrypt(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(encoded, "\n") {
+				if len(line) > opensslLineSize {
+					t.Fatalf("line longer than %d characters: %q", opensslLineSize, line)
+				}
+			}
+
+			decoded, err := c.Decrypt(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != plaintext {
+				t.Fatalf("Decrypt = %q", decoded)
+			}
+		})
+	}
+}
+
+func TestOpenSSLRejects(t *testing.T) {
+	c := NewOpenSSLCryptor("secret", DefaultOpenSSLParams())
+
+	native, err := NewCryptor("secret", AlgAES256GCM, testKDF).Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Decrypt(native); !errors.Is(err, ErrNotOpenSSL) {
+		t.Fatalf("Decrypt native ciphertext = %v, want %v", err, ErrNotOpenSSL)
+	}
+
+	if _, err := c.Decrypt("U2FsdGVkX18="); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("Decrypt truncated = %v, want %v", err, ErrInvalidCiphertext)
+	}
+
+	bad := OpenSSLParams{Cipher: "des-ede3-cbc", Digest: "sha256"}
+	if _, err := NewOpenSSLCryptor("secret", bad).Encrypt("hello"); !errors.Is(err, ErrInvalidOpenSSL) {
+		t.Fatalf("Encrypt with %s = %v, want %v", bad.Cipher, err, ErrInvalidOpenSSL)
+	}
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// MinPaddedSize is the smallest payload any padding scheme produces, so
+	// short secrets all encrypt to the same length.
+	MinPaddedSize = 64
+
+	// MaxUnpackedSize bounds decompression of messages, which are pasted
+	// text, so a small ciphertext cannot expand without limit.
+	MaxUnpackedSize = 16 << 20
+
+	// DefaultMinCompressSize keeps compression away from short secrets,
+	// where output length would act as an oracle on their content.
+	DefaultMinCompressSize = 1024
+)
+
+var ErrUnsupportedPacking = errors.New("unsupported compression or padding")
+
+type CompressionID byte
+
+const (
+	CompressNone CompressionID = iota
+	CompressDeflate
+)
+
+func (id CompressionID) String() string {
+	switch id {
+	case CompressNone:
+		return "none"
+	case CompressDeflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(id))
+	}
+}
+
+func CompressionByName(name string) (CompressionID, error) {
+	for _, id := range []CompressionID{CompressNone, CompressDeflate} {
+		if strings.EqualFold(id.String(), name) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown compression %q", ErrUnsupportedPacking, name)
+}
+
+type PaddingID byte
+
+const (
+	PadNone PaddingID = iota
+	// PadPadme rounds lengths as PADMÉ does, leaking O(log log n) bits of
+	// the length for at most 12% overhead.
+	PadPadme
+	// PadBucket rounds lengths up to the next power of two.
+	PadBucket
+)
+
+func (id PaddingID) String() string {
+	switch id {
+	case PadNone:
+		return "none"
+	case PadPadme:
+		return "padme"
+	case PadBucket:
+		return "bucket"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(id))
+	}
+}
+
+func PaddingByName(name string) (PaddingID, error) {
+	for _, id := range []PaddingID{PadNone, PadPadme, PadBucket} {
+		if strings.EqualFold(id.String(), name) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown padding %q", ErrUnsupportedPacking, name)
+}
+
+// Packing is applied to message plaintext inside the AEAD. The zero value
+// leaves plaintext as it is and writes no packing field.
+type Packing struct {
+	Compression CompressionID
+	Padding     PaddingID
+
+	// MinCompressSize is the plaintext length below which compression is
+	// skipped; zero means DefaultMinCompressSize.
+	MinCompressSize int
+}
+
+func DefaultPacking() Packing {
+	return Packing{
+		Compression:     CompressNone,
+		Padding:         PadPadme,
+		MinCompressSize: DefaultMinCompressSize,
+	}
+}
+
+func (p Packing) Validate() error {
+	if p.Compression > CompressDeflate {
+		return fmt.Errorf("%w: compression %s", ErrUnsupportedPacking, p.Compression)
+	}
+	if p.Padding > PadBucket {
+		return fmt.Errorf("%w: padding %s", ErrUnsupportedPacking, p.Padding)
+	}
+	if p.MinCompressSize < 0 {
+		return fmt.Errorf("%w: negative minimum compression size", ErrUnsupportedPacking)
+	}
+	return nil
+}
+
+func (p Packing) String() string {
+	return fmt.Sprintf("compression %s , padding %s", p.Compression, p.Padding)
+}
+
+// pack compresses and pads plaintext, recording in e what was actually
+// applied. It must run before e.Header() is used as AAD.
+func (e *Envelope) pack(p Packing, plaintext []byte) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if p.Compression == CompressNone && p.Padding == PadNone {
+		return plaintext, nil
+	}
+
+	minCompress := p.MinCompressSize
+	if minCompress == 0 {
+		minCompress = DefaultMinCompressSize
+	}
+
+	payload := plaintext
+	compression := CompressNone
+	if p.Compression == CompressDeflate && len(plaintext) >= minCompress {
+		compressed, err := deflate(plaintext)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(plaintext) {
+			payload, compression = compressed, CompressDeflate
+		}
+	}
+	if p.Padding != PadNone {
+		payload = pad(payload, p.Padding)
+	}
+
+	e.Flags |= FlagPacked
+	e.Compression = compression
+	e.Padding = p.Padding
+	return payload, nil
+}
+
+// unpack reverses pack on authenticated plaintext.
+func (e *Envelope) unpack(payload []byte) ([]byte, error) {
+	if e.Flags&FlagPacked == 0 {
+		return payload, nil
+	}
+
+	if e.Padding != PadNone {
+		// Byte-wise: the marker must not be read as part of a UTF-8
+		// sequence begun by the last plaintext byte.
+		t := bytes.TrimRight(payload, "\x00")
+		if len(t) == 0 || t[len(t)-1] != 0x80 {
+			return nil, fmt.Errorf("%w: bad padding", ErrInvalidCiphertext)
+		}
+		payload = t[:len(t)-1]
+	}
+
+	if e.Compression == CompressDeflate {
+		return inflate(payload)
+	}
+	return payload, nil
+}
+
+// pad appends the ISO/IEC 7816-4 marker 0x80 and zeros up to the length
+// the scheme allows for.
+func pad(payload []byte, id PaddingID) []byte {
+	n := max(len(payload)+1, MinPaddedSize)
+	switch id {
+	case PadPadme:
+		n = padme(n)
+	case PadBucket:
+		n = 1 << bits.Len(uint(n-1))
+	}
+
+	out := make([]byte, n)
+	copy(out, payload)
+	out[len(payload)] = 0x80
+	return out
+}
+
+// padme is the PADMÉ length from "Reducing Metadata Leakage from Encrypted
+// Files and Communication with PURBs" (Nikitin et al., 2019).
+func padme(n int) int {
+	e := bits.Len(uint(n)) - 1
+	s := bits.Len(uint(e))
+	mask := 1<<(e-s) - 1
+	return (n + mask) &^ mask
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, MaxUnpackedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	if len(out) > MaxUnpackedSize {
+		return nil, fmt.Errorf("%w: decompresses to more than %d bytes", ErrInvalidCiphertext, MaxUnpackedSize)
+	}
+	return out, nil
+}
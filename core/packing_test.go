@@ -0,0 +1,110 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPadme(t *testing.T) {
+	for n, want := range map[int]int{64: 64, 65: 72, 100: 104, 1000: 1024, 1025: 1088, 100000: 100352} {
+		if got := padme(n); got != want {
+			t.Errorf("padme(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestPackingRoundTrip(t *testing.T) {
+	long := strings.Repeat("all work and no play makes jack a dull boy\n", 100)
+
+	for _, compression := range []CompressionID{CompressNone, CompressDeflate} {
+		for _, padding := range []PaddingID{PadNone, PadPadme, PadBucket} {
+			p := Packing{Compression: compression, Padding: padding}
+			t.Run(p.String(), func(t *testing.T) {
+				for _, plaintext := range []string{"x", "hunter2\x00", "abc\xc3", "\xe2\x82", "tail\x80\x00", long} {
+					c := NewCryptor("secret", AlgAES256GCM, testKDF).WithPacking(p)
+					encoded, err := c.Encrypt(plaintext)
+					if err != nil {
+						t.Fatal(err)
+					}
+					decoded, err := NewCryptor("secret", AlgAES256GCM, testKDF).Decrypt(encoded)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if decoded != plaintext {
+						t.Fatalf("Decrypt = %q, want %q", decoded, plaintext)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPaddingHidesShortLengths(t *testing.T) {
+	identity := newTestIdentity(t)
+	c := NewRecipientCryptor(AlgAES256GCM, []*Recipient{identity.Recipient()}, []*Identity{identity}).WithPacking(DefaultPacking())
+
+	var lengths []int
+	for _, secret := range []string{"hunter22", "correct horse battery staple"} {
+		encoded, err := c.Encrypt(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := InspectCiphertext(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Padding != PadPadme || env.Compression != CompressNone {
+			t.Fatalf("envelope packing = %s/%s, want padme without compression", env.Compression, env.Padding)
+		}
+		if decoded, err := c.Decrypt(encoded); err != nil || decoded != secret {
+			t.Fatalf("Decrypt = %q, %v", decoded, err)
+		}
+		lengths = append(lengths, len(encoded))
+	}
+	if lengths[0] != lengths[1] {
+		t.Fatalf("ciphertext lengths %v differ for short secrets", lengths)
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	p := Packing{Compression: CompressDeflate, Padding: PadNone, MinCompressSize: 100}
+	for plaintext, want := range map[string]CompressionID{
+		strings.Repeat("a", 99):  CompressNone,
+		strings.Repeat("a", 100): CompressDeflate,
+	} {
+		env := &Envelope{}
+		if _, err := env.pack(p, []byte(plaintext)); err != nil {
+			t.Fatal(err)
+		}
+		if env.Compression != want {
+			t.Errorf("%d bytes packed with %s, want %s", len(plaintext), env.Compression, want)
+		}
+	}
+}
+
+func TestUnpackBinaryTails(t *testing.T) {
+	for _, padding := range []PaddingID{PadPadme, PadBucket} {
+		env := &Envelope{Flags: FlagPacked, Padding: padding}
+		for b := range 256 {
+			// Lead bytes 0xc0-0xdf would pair with the 0x80 marker as a
+			// two-byte UTF-8 sequence.
+			for _, payload := range [][]byte{{byte(b)}, {'a', 'b', byte(b)}, {0xe2, 0x82, byte(b)}} {
+				got, err := env.unpack(pad(payload, padding))
+				if err != nil || !bytes.Equal(got, payload) {
+					t.Fatalf("%s unpack(pad(%x)) = %x, %v", padding, payload, got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestUnpackRejectsBadPadding(t *testing.T) {
+	env := &Envelope{Flags: FlagPacked, Padding: PadPadme}
+	for _, payload := range [][]byte{{}, {0, 0, 0}, []byte("no marker\x01\x00")} {
+		if _, err := env.unpack(payload); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("unpack(%q) = %v, want %v", payload, err, ErrInvalidCiphertext)
+		}
+	}
+}
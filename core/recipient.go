@@ -0,0 +1,381 @@
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	RecipientPrefix = "tedc-pub-"
+	IdentityPrefix  = "TEDC-SECRET-KEY-"
+
+	AgeRecipientHRP = "age"
+	AgeIdentityHRP  = "age-secret-key-"
+
+	MaxRecipients = 255
+
+	x25519KeySize = 32
+
+	wrapInfo    = "txt-encdec-cli x25519 wrap"
+	payloadInfo = "txt-encdec-cli payload"
+)
+
+var (
+	ErrInvalidRecipient   = errors.New("invalid recipient public key")
+	ErrInvalidIdentity    = errors.New("invalid identity")
+	ErrNoRecipients       = errors.New("no recipients given")
+	ErrTooManyRecipients  = errors.New("too many recipients")
+	ErrNoMatchingIdentity = errors.New("ciphertext is not encrypted to this identity")
+	ErrRecipientEnvelope  = errors.New("ciphertext is encrypted to recipients; decrypt it with an identity")
+	ErrPassphraseEnvelope = errors.New("ciphertext is passphrase-encrypted; decrypt it with the secret key")
+)
+
+// Recipient is an X25519 public key that file keys can be wrapped to.
+type Recipient struct {
+	key *ecdh.PublicKey
+}
+
+// Identity is an X25519 private key that unwraps file keys addressed to its
+// Recipient.
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseRecipient accepts both tedc-pub- and age1 public keys.
+func ParseRecipient(s string) (*Recipient, error) {
+	raw, err := decodeKey(strings.TrimSpace(s), RecipientPrefix, AgeRecipientHRP)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+	return &Recipient{key: key}, nil
+}
+
+// ParseIdentity reads the first non-comment line of an identity file, so
+// age-keygen output can be used as is.
+func ParseIdentity(s string) (*Identity, error) {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		raw, err := decodeKey(line, IdentityPrefix, AgeIdentityHRP)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIdentity, err)
+		}
+
+		key, err := ecdh.X25519().NewPrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIdentity, err)
+		}
+		return &Identity{key: key}, nil
+	}
+	return nil, fmt.Errorf("%w: no key found", ErrInvalidIdentity)
+}
+
+func decodeKey(s, prefix, ageHRP string) ([]byte, error) {
+	var raw []byte
+	if encoded, ok := strings.CutPrefix(s, prefix); ok {
+		var err error
+		if raw, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, err
+		}
+	} else if strings.HasPrefix(strings.ToLower(s), ageHRP+"1") {
+		hrp, data, err := bech32Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != ageHRP {
+			return nil, fmt.Errorf("unexpected bech32 prefix %q", hrp)
+		}
+		raw = data
+	} else {
+		return nil, fmt.Errorf("missing %q prefix", prefix)
+	}
+
+	if len(raw) != x25519KeySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(raw), x25519KeySize)
+	}
+	return raw, nil
+}
+
+func (r *Recipient) String() string {
+	return RecipientPrefix + base64.RawURLEncoding.EncodeToString(r.key.Bytes())
+}
+
+func (i *Identity) String() string {
+	return IdentityPrefix + base64.RawURLEncoding.EncodeToString(i.key.Bytes())
+}
+
+// AgeString returns the key in age's age1... encoding.
+func (r *Recipient) AgeString() string {
+	s, _ := bech32Encode(AgeRecipientHRP, r.key.Bytes())
+	return s
+}
+
+// AgeString returns the key in age's AGE-SECRET-KEY-1... encoding.
+func (i *Identity) AgeString() string {
+	s, _ := bech32Encode(AgeIdentityHRP, i.key.Bytes())
+	return strings.ToUpper(s)
+}
+
+func (i *Identity) Recipient() *Recipient {
+	return &Recipient{key: i.key.PublicKey()}
+}
+
+// Stanza carries the file key wrapped to one recipient: an ephemeral X25519
+// share and the file key sealed under a key derived from the shared secret.
+type Stanza struct {
+	Share      []byte
+	WrappedKey []byte
+}
+
+func (r *Recipient) wrap(fileKey []byte) (Stanza, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return Stanza{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	share := ephemeral.PublicKey().Bytes()
+	aead, err := wrapAEAD(ephemeral, r.key, share, r.key.Bytes())
+	if err != nil {
+		return Stanza{}, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	return Stanza{Share: share, WrappedKey: aead.Seal(nil, nonce, fileKey, nil)}, nil
+}
+
+func (i *Identity) unwrap(s Stanza) ([]byte, error) {
+	share, err := ecdh.X25519().NewPublicKey(s.Share)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	aead, err := wrapAEAD(i.key, share, s.Share, i.key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, s.WrappedKey, nil)
+}
+
+// wrapAEAD derives the per-stanza wrapping key. The wrapping key is unique
+// to each ephemeral share, so a fixed zero nonce is safe.
+func wrapAEAD(priv *ecdh.PrivateKey, pub *ecdh.PublicKey, share, recipient []byte) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+
+	salt := append(append([]byte(nil), share...), recipient...)
+	key, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+// RecipientCryptor encrypts to a set of recipients and decrypts with any of
+// a set of identities. Each message gets a fresh file key, wrapped once per
+// recipient in the envelope header.
+type RecipientCryptor struct {
+	recipients []*Recipient
+	identities []*Identity
+	algorithm  AlgorithmID
+	packing    Packing
+}
+
+func NewRecipientCryptor(algorithm AlgorithmID, recipients []*Recipient, identities []*Identity) *RecipientCryptor {
+	return &RecipientCryptor{
+		recipients: recipients,
+		identities: identities,
+		algorithm:  algorithm,
+	}
+}
+
+// WithPacking sets the compression and padding applied to messages
+// encrypted from now on. Streams are never packed.
+func (c *RecipientCryptor) WithPacking(p Packing) *RecipientCryptor {
+	c.packing = p
+	return c
+}
+
+func (c *RecipientCryptor) Encrypt(plaintext string) (string, error) {
+	return c.EncryptWithContext(plaintext, "")
+}
+
+func (c *RecipientCryptor) EncryptWithContext(plaintext, context string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if err := ValidateContext(context); err != nil {
+		return "", err
+	}
+
+	aead, env, err := c.newEnvelope(0)
+	if err != nil {
+		return "", err
+	}
+	env.setContext(context)
+	payload, err := env.pack(c.packing, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	env.Nonce = nonce
+	env.Ciphertext = aead.Seal(nil, nonce, payload, env.Header())
+	return base64.StdEncoding.EncodeToString(env.Marshal()), nil
+}
+
+func (c *RecipientCryptor) Decrypt(encoded string) (string, error) {
+	return c.DecryptWithContext(encoded, "")
+}
+
+func (c *RecipientCryptor) DecryptWithContext(encoded, context string) (string, error) {
+	data, err := decodeCiphertext(encoded)
+	if err != nil || len(data) == 0 {
+		return "", err
+	}
+
+	env, err := ParseEnvelope(data)
+	if errors.Is(err, ErrNotEnvelope) {
+		return "", ErrPassphraseEnvelope
+	}
+	if err != nil {
+		return "", err
+	}
+	if env.Flags&FlagStream != 0 {
+		return "", ErrStreamEnvelope
+	}
+
+	aead, err := c.envelopeAEAD(env)
+	if err != nil {
+		return "", err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+
+	payload, err := aead.Open(nil, env.Nonce, env.Ciphertext, env.Header())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+	if err := env.checkContext(context); err != nil {
+		return "", err
+	}
+	plaintext, err := env.unpack(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+func (c *RecipientCryptor) newEnvelope(flags byte) (cipher.AEAD, *Envelope, error) {
+	if len(c.recipients) == 0 {
+		return nil, nil, ErrNoRecipients
+	}
+	if len(c.recipients) > MaxRecipients {
+		return nil, nil, fmt.Errorf("%w: %d (max %d)", ErrTooManyRecipients, len(c.recipients), MaxRecipients)
+	}
+
+	suite, err := SuiteByID(c.algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate file key: %w", err)
+	}
+	defer clear(fileKey)
+
+	salt, err := newSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stanzas := make([]Stanza, len(c.recipients))
+	for i, r := range c.recipients {
+		if stanzas[i], err = r.wrap(fileKey); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	aead, err := payloadAEAD(suite, fileKey, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := &Envelope{
+		Version:    CurrentEnvelopeVersion,
+		Flags:      flags | FlagRecipients,
+		Algorithm:  suite.ID,
+		KDF:        KDFParams{ID: KDFX25519},
+		Salt:       salt,
+		Recipients: stanzas,
+	}
+	return aead, env, nil
+}
+
+func (c *RecipientCryptor) envelopeAEAD(env *Envelope) (cipher.AEAD, error) {
+	if env.Flags&FlagRecipients == 0 {
+		return nil, ErrPassphraseEnvelope
+	}
+
+	suite, err := SuiteByID(env.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identity := range c.identities {
+		for _, stanza := range env.Recipients {
+			fileKey, err := identity.unwrap(stanza)
+			if err != nil {
+				continue
+			}
+			defer clear(fileKey)
+			return payloadAEAD(suite, fileKey, env.Salt)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrNoMatchingIdentity)
+}
+
+func payloadAEAD(suite Suite, fileKey, salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, salt, payloadInfo, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	return suite.New(key)
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newTestIdentity(t *testing.T) *Identity {
+	t.Helper()
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func TestKeyEncodingRoundTrip(t *testing.T) {
+	identity := newTestIdentity(t)
+
+	parsed, err := ParseIdentity("# created by test\n" + identity.String() + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != identity.String() {
+		t.Fatalf("ParseIdentity = %s, want %s", parsed, identity)
+	}
+
+	recipient, err := ParseRecipient(identity.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.String() != identity.Recipient().String() {
+		t.Fatalf("ParseRecipient = %s, want %s", recipient, identity.Recipient())
+	}
+
+	if _, err := ParseRecipient(identity.String()); !errors.Is(err, ErrInvalidRecipient) {
+		t.Fatalf("ParseRecipient(identity) = %v, want %v", err, ErrInvalidRecipient)
+	}
+	if _, err := ParseIdentity(recipient.String()); !errors.Is(err, ErrInvalidIdentity) {
+		t.Fatalf("ParseIdentity(recipient) = %v, want %v", err, ErrInvalidIdentity)
+	}
+}
+
+func TestRecipientRoundTrip(t *testing.T) {
+	alice, bob, eve := newTestIdentity(t), newTestIdentity(t), newTestIdentity(t)
+	recipients := []*Recipient{alice.Recipient(), bob.Recipient()}
+
+	for _, suite := range Suites() {
+		t.Run(suite.ID.String(), func(t *testing.T) {
+			encoded, err := NewRecipientCryptor(suite.ID, recipients, nil).Encrypt("hello\nteam")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env, err := InspectCiphertext(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.KDF.ID != KDFX25519 || len(env.Recipients) != len(recipients) {
+				t.Fatalf("envelope kdf = %s with %d stanzas, want %s with %d", env.KDF.ID, len(env.Recipients), KDFX25519, len(recipients))
+			}
+
+			for _, identity := range []*Identity{alice, bob} {
+				decoded, err := NewRecipientCryptor(AlgAES256GCM, nil, []*Identity{eve, identity}).Decrypt(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded != "hello\nteam" {
+					t.Fatalf("Decrypt = %q", decoded)
+				}
+			}
+
+			_, err = NewRecipientCryptor(AlgAES256GCM, nil, []*Identity{eve}).Decrypt(encoded)
+			if !errors.Is(err, ErrNoMatchingIdentity) {
+				t.Fatalf("Decrypt with other identity = %v, want %v", err, ErrNoMatchingIdentity)
+			}
+
+			_, err = NewCryptor("secret", AlgAES256GCM, testKDF).Decrypt(encoded)
+			if !errors.Is(err, ErrRecipientEnvelope) {
+				t.Fatalf("Decrypt with secret = %v, want %v", err, ErrRecipientEnvelope)
+			}
+		})
+	}
+}
+
+func TestRecipientHeaderIsAuthenticated(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+	c := NewRecipientCryptor(AlgAES256GCM, []*Recipient{alice.Recipient(), bob.Recipient()}, []*Identity{alice})
+
+	encoded, err := c.Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := InspectCiphertext(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.Recipients = env.Recipients[:1]
+	if _, err := c.envelopeAEAD(env); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Decrypt(base64.StdEncoding.EncodeToString(env.Marshal()))
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("Decrypt with a stanza removed = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestRecipientRejectsPassphraseCiphertext(t *testing.T) {
+	encoded, err := NewCryptor("secret", AlgAES256GCM, testKDF).Encrypt("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewRecipientCryptor(AlgAES256GCM, nil, []*Identity{newTestIdentity(t)}).Decrypt(encoded)
+	if !errors.Is(err, ErrPassphraseEnvelope) {
+		t.Fatalf("Decrypt = %v, want %v", err, ErrPassphraseEnvelope)
+	}
+
+	if _, err := NewRecipientCryptor(AlgAES256GCM, nil, nil).Encrypt("hello"); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("Encrypt without recipients = %v, want %v", err, ErrNoRecipients)
+	}
+}
+
+func TestRecipientStreamRoundTrip(t *testing.T) {
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+	plaintext := bytes.Repeat([]byte("0123456789abcdef"), StreamChunkSize/16+3)
+
+	var sealed bytes.Buffer
+	c := NewRecipientCryptor(AlgXChaCha20Poly1305, []*Recipient{alice.Recipient(), bob.Recipient()}, nil)
+	if err := c.EncryptStream(&sealed, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened bytes.Buffer
+	d := NewRecipientCryptor(AlgAES256GCM, nil, []*Identity{bob})
+	if err := d.DecryptStream(&opened, bytes.NewReader(sealed.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened.Bytes(), plaintext) {
+		t.Fatal("stream round trip mismatch")
+	}
+}
@@ -0,0 +1,399 @@
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	StreamChunkSize = 64 * 1024
+
+	streamNonceSuffixSize = 5
+	streamFixedHeaderSize = len(EnvelopeMagic) + 3 + 1 + kdfParamsSize
+)
+
+var (
+	ErrTruncatedStream = errors.New("stream truncated: final chunk missing")
+	ErrStreamClosed    = errors.New("stream already closed")
+	ErrStreamTooLarge  = errors.New("stream exceeds maximum chunk count")
+	ErrNotStream       = errors.New("envelope is not a stream envelope")
+)
+
+type StreamCryptor interface {
+	EncryptStream(dst io.Writer, src io.Reader) error
+	DecryptStream(dst io.Writer, src io.Reader) error
+}
+
+func (c *AEADCryptor) EncryptStream(dst io.Writer, src io.Reader) error {
+	return encryptStream(c, dst, src)
+}
+
+func (c *AEADCryptor) DecryptStream(dst io.Writer, src io.Reader) error {
+	return decryptStream(c, dst, src)
+}
+
+func (c *AEADCryptor) NewEncryptWriter(dst io.Writer) (io.WriteCloser, error) {
+	aead, env, err := c.newEnvelope(FlagStream)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(dst, aead, env)
+}
+
+func (c *AEADCryptor) NewDecryptReader(src io.Reader) (io.Reader, error) {
+	env, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.envelopeAEAD(env)
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptReader(src, aead, env)
+}
+
+func (c *RecipientCryptor) EncryptStream(dst io.Writer, src io.Reader) error {
+	return encryptStream(c, dst, src)
+}
+
+func (c *RecipientCryptor) DecryptStream(dst io.Writer, src io.Reader) error {
+	return decryptStream(c, dst, src)
+}
+
+func (c *RecipientCryptor) NewEncryptWriter(dst io.Writer) (io.WriteCloser, error) {
+	aead, env, err := c.newEnvelope(FlagStream)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(dst, aead, env)
+}
+
+func (c *RecipientCryptor) NewDecryptReader(src io.Reader) (io.Reader, error) {
+	env, err := ReadStreamHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.envelopeAEAD(env)
+	if err != nil {
+		return nil, err
+	}
+	return newDecryptReader(src, aead, env)
+}
+
+type streamOpener interface {
+	NewEncryptWriter(dst io.Writer) (io.WriteCloser, error)
+	NewDecryptReader(src io.Reader) (io.Reader, error)
+}
+
+func encryptStream(c streamOpener, dst io.Writer, src io.Reader) error {
+	w, err := c.NewEncryptWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func decryptStream(c streamOpener, dst io.Writer, src io.Reader) error {
+	r, err := c.NewDecryptReader(src)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+func newEncryptWriter(dst io.Writer, aead cipher.AEAD, env *Envelope) (io.WriteCloser, error) {
+	prefix := make([]byte, aead.NonceSize()-streamNonceSuffixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	env.Nonce = prefix
+
+	header := env.Header()
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		dst:    dst,
+		stream: newStreamState(aead, prefix, header),
+		buf:    make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+func newDecryptReader(src io.Reader, aead cipher.AEAD, env *Envelope) (io.Reader, error) {
+	if len(env.Nonce) != aead.NonceSize()-streamNonceSuffixSize {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return &decryptReader{
+		src:    src,
+		stream: newStreamState(aead, env.Nonce, env.Header()),
+		buf:    make([]byte, StreamChunkSize+aead.Overhead()+1),
+	}, nil
+}
+
+func ReadStreamHeader(r io.Reader) (*Envelope, error) {
+	header := make([]byte, streamFixedHeaderSize, streamFixedHeaderSize+64)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, streamHeaderError(err)
+	}
+
+	if !IsEnvelope(header) {
+		return nil, ErrNotEnvelope
+	}
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if header, err = readPrefixed(r, header); err != nil {
+			return nil, err
+		}
+	}
+
+	if header[len(EnvelopeMagic)+1]&FlagRecipients != 0 {
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, streamHeaderError(err)
+		}
+		header = append(header, n[0])
+
+		for i := 0; i < 2*int(n[0]); i++ {
+			if header, err = readPrefixed(r, header); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if header[len(EnvelopeMagic)+1]&FlagContext != 0 {
+		if header, err = readPrefixed(r, header); err != nil {
+			return nil, err
+		}
+	}
+
+	env, err := ParseEnvelope(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if env.Flags&FlagStream == 0 {
+		return nil, ErrNotStream
+	}
+	return env, nil
+}
+
+func readPrefixed(r io.Reader, header []byte) ([]byte, error) {
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, streamHeaderError(err)
+	}
+	field := make([]byte, n[0])
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, streamHeaderError(err)
+	}
+	header = append(header, n[0])
+	return append(header, field...), nil
+}
+
+func streamHeaderError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncatedHeader
+	}
+	return err
+}
+
+type streamState struct {
+	aead    cipher.AEAD
+	nonce   []byte
+	header  []byte
+	counter uint32
+	done    bool
+}
+
+func newStreamState(aead cipher.AEAD, prefix, header []byte) *streamState {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	return &streamState{
+		aead:   aead,
+		nonce:  nonce,
+		header: header,
+	}
+}
+
+func (s *streamState) next(last bool) ([]byte, error) {
+	if s.done {
+		return nil, ErrStreamClosed
+	}
+	if s.counter == math.MaxUint32 {
+		return nil, ErrStreamTooLarge
+	}
+
+	binary.BigEndian.PutUint32(s.nonce[len(s.nonce)-streamNonceSuffixSize:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+		s.done = true
+	}
+	s.counter++
+
+	return s.nonce, nil
+}
+
+func (s *streamState) seal(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.next(last)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(dst, nonce, chunk, s.header), nil
+}
+
+func (s *streamState) open(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.next(last)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.aead.Open(dst, nonce, chunk, s.header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d: %v", ErrDecryptionFailed, s.counter-1, err)
+	}
+	return plaintext, nil
+}
+
+type encryptWriter struct {
+	dst    io.Writer
+	stream *streamState
+	buf    []byte
+	err    error
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == StreamChunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):StreamChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.err = ErrStreamClosed
+	return nil
+}
+
+func (w *encryptWriter) flush(last bool) error {
+	sealed, err := w.stream.seal(nil, w.buf, last)
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	if _, err := w.dst.Write(sealed); err != nil {
+		w.err = err
+		return err
+	}
+
+	w.buf = w.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	src    io.Reader
+	stream *streamState
+	buf    []byte
+	carry  int
+	out    []byte
+	err    error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readChunk()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// readChunk takes the short chunk at EOF as the final one. Chunks carry no
+// length, so data appended after the final chunk cannot be told apart from
+// a damaged chunk; both fail with ErrDecryptionFailed.
+func (r *decryptReader) readChunk() error {
+	if r.stream.done {
+		return io.EOF
+	}
+
+	sealedSize := StreamChunkSize + r.stream.aead.Overhead()
+
+	n, err := io.ReadFull(r.src, r.buf[r.carry:])
+	n += r.carry
+	r.carry = 0
+
+	switch {
+	case err == nil:
+		chunk := r.buf[:sealedSize]
+		plaintext, err := r.stream.open(nil, chunk, false)
+		if err != nil {
+			return err
+		}
+		r.buf[0] = r.buf[sealedSize]
+		r.carry = 1
+		r.out = plaintext
+		return nil
+
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		if n < r.stream.aead.Overhead() {
+			return ErrTruncatedStream
+		}
+		plaintext, err := r.stream.open(nil, r.buf[:n], true)
+		if err != nil {
+			if n == sealedSize {
+				return ErrTruncatedStream
+			}
+			return err
+		}
+		r.out = plaintext
+		if len(plaintext) == 0 {
+			return io.EOF
+		}
+		return nil
+
+	default:
+		return err
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// sealedStream encrypts chunks full chunks and a short one, returning the
+// header and each sealed chunk.
+func sealedStream(t *testing.T, c *AEADCryptor, chunks int) (header []byte, sealed [][]byte) {
+	t.Helper()
+	plaintext := bytes.Repeat([]byte{'x'}, chunks*StreamChunkSize+100)
+
+	var buf bytes.Buffer
+	if err := c.EncryptStream(&buf, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	if _, err := ReadStreamHeader(r); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	header, data = data[:len(data)-r.Len()], data[len(data)-r.Len():]
+
+	size := StreamChunkSize + 16
+	for len(data) > size {
+		sealed = append(sealed, data[:size])
+		data = data[size:]
+	}
+	return header, append(sealed, data)
+}
+
+func TestStreamTampering(t *testing.T) {
+	c := NewCryptor("secret", AlgAES256GCM, testKDF)
+	header, chunks := sealedStream(t, c, 3)
+	last := len(chunks) - 1
+
+	flipped := bytes.Clone(header)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		header []byte
+		chunks [][]byte
+		want   error
+	}{
+		{"intact", header, chunks, nil},
+		{"swapped chunks", header, [][]byte{chunks[1], chunks[0], chunks[2], chunks[last]}, ErrDecryptionFailed},
+		{"reordered final chunk", header, [][]byte{chunks[0], chunks[last], chunks[1], chunks[2]}, ErrDecryptionFailed},
+		{"duplicated chunk", header, slices.Insert(slices.Clone(chunks), 1, chunks[0]), ErrDecryptionFailed},
+		{"dropped chunk", header, slices.Delete(slices.Clone(chunks), 1, 2), ErrDecryptionFailed},
+		{"dropped final chunk", header, chunks[:last], ErrTruncatedStream},
+		{"appended byte", header, append(slices.Clone(chunks), []byte{0}), ErrDecryptionFailed},
+		{"appended chunk", header, append(slices.Clone(chunks), chunks[0]), ErrDecryptionFailed},
+		{"appended final chunk", header, append(slices.Clone(chunks), chunks[last]), ErrDecryptionFailed},
+		{"altered nonce prefix", flipped, chunks, ErrDecryptionFailed},
+		{"cut header", header[:len(header)-1], nil, ErrTruncatedHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := slices.Concat(append([][]byte{tt.header}, tt.chunks...)...)
+			err := c.DecryptStream(io.Discard, bytes.NewReader(stream))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("DecryptStream = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamFullFinalChunk(t *testing.T) {
+	c := NewCryptor("secret", AlgXChaCha20Poly1305, testKDF)
+	plaintext := bytes.Repeat([]byte{'y'}, 2*StreamChunkSize)
+
+	var sealed bytes.Buffer
+	if err := c.EncryptStream(&sealed, bytes.NewReader(plaintext)); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened bytes.Buffer
+	if err := c.DecryptStream(&opened, bytes.NewReader(sealed.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened.Bytes(), plaintext) {
+		t.Fatal("stream round trip mismatch")
+	}
+
+	appended := append(bytes.Clone(sealed.Bytes()), 0)
+	if err := c.DecryptStream(io.Discard, bytes.NewReader(appended)); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("DecryptStream with a byte appended = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestStreamWriterClosed(t *testing.T) {
+	w, err := NewCryptor("secret", AlgAES256GCM, testKDF).NewEncryptWriter(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("late")); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Write after Close = %v, want %v", err, ErrStreamClosed)
+	}
+}
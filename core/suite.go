@@ -0,0 +1,64 @@
+package core
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+type Suite struct {
+	ID  AlgorithmID
+	New func(key []byte) (cipher.AEAD, error)
+}
+
+var (
+	suitesMu sync.RWMutex
+	suites   = []Suite{
+		{ID: AlgAES256GCM, New: newGCM},
+		{ID: AlgXChaCha20Poly1305, New: chacha20poly1305.NewX},
+		{ID: AlgAES256GCMSIV, New: newGCMSIV},
+	}
+)
+
+func RegisterSuite(s Suite) error {
+	suitesMu.Lock()
+	defer suitesMu.Unlock()
+
+	for _, existing := range suites {
+		if existing.ID == s.ID {
+			return fmt.Errorf("suite %s is already registered", s.ID)
+		}
+	}
+	suites = append(suites, s)
+	return nil
+}
+
+func Suites() []Suite {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+	return append([]Suite(nil), suites...)
+}
+
+func SuiteByID(id AlgorithmID) (Suite, error) {
+	suitesMu.RLock()
+	defer suitesMu.RUnlock()
+
+	for _, s := range suites {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Suite{}, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, id)
+}
+
+func AlgorithmByName(name string) (AlgorithmID, error) {
+	for _, s := range Suites() {
+		if strings.EqualFold(s.ID.String(), name) {
+			return s.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, name)
+}
@@ -0,0 +1,379 @@
+// Package filecrypt encrypts files and directory trees through the
+// streaming engine. The plaintext is always a tar archive holding one
+// top-level entry, so permissions and modification times survive the
+// round trip whether a single file or a whole directory was encrypted.
+package filecrypt
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"txt-encdec-cli/core"
+)
+
+const Ext = ".tedc"
+
+var (
+	ErrExists          = errors.New("output already exists")
+	ErrOutputInInput   = errors.New("output is inside the input")
+	ErrUnsupportedFile = errors.New("unsupported file type")
+	ErrInvalidArchive  = errors.New("invalid archive")
+)
+
+// Progress reports how many of total bytes have been processed. Decrypt
+// calls it on its own goroutine, but Encrypt calls it from the goroutine
+// that writes the archive, so it must not assume the caller's.
+type Progress func(done, total int64)
+
+type Options struct {
+	Overwrite bool
+	Progress  Progress
+}
+
+// DefaultOutput suggests where Encrypt or Decrypt should write src.
+func DefaultOutput(src string, encrypt bool) string {
+	src = filepath.Clean(src)
+	switch {
+	case encrypt:
+		return src + Ext
+	case strings.HasSuffix(src, Ext) && len(src) > len(Ext):
+		return strings.TrimSuffix(src, Ext)
+	default:
+		return src + ".out"
+	}
+}
+
+// Encrypt archives the file or directory src and writes it, encrypted, to
+// dst. A symlink src is followed, and what it points to is archived.
+// Progress counts the bytes of file content read.
+func Encrypt(c core.StreamCryptor, src, dst string, opts Options) error {
+	link := filepath.Clean(src)
+	src, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return err
+	}
+	if within(dst, link) || within(dst, src) {
+		return fmt.Errorf("%w: %s", ErrOutputInInput, dst)
+	}
+	if err := checkOutput(dst, opts.Overwrite); err != nil {
+		return err
+	}
+
+	total, err := contentSize(src)
+	if err != nil {
+		return err
+	}
+	progress := &counter{total: total, report: opts.Progress}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeArchive(pw, src, progress))
+	}()
+	defer pr.Close()
+
+	return writeFile(dst, func(f *os.File) error {
+		return c.EncryptStream(f, pr)
+	})
+}
+
+// Decrypt writes the file or directory encrypted in src to dst. Every chunk
+// is authenticated into a private temporary file first, and nothing is
+// extracted until the final chunk has verified, so a damaged or truncated
+// src never leaves partial plaintext at dst. Progress counts the bytes of
+// src read.
+func Decrypt(c core.StreamCryptor, src, dst string, opts Options) error {
+	if err := checkOutput(dst, opts.Overwrite); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	progress := &counter{total: info.Size(), report: opts.Progress}
+
+	dir := filepath.Dir(dst)
+	plain, err := os.CreateTemp(dir, ".tedc-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(plain.Name())
+	defer plain.Close()
+
+	if err := c.DecryptStream(plain, &countingReader{r: in, counter: progress}); err != nil {
+		return err
+	}
+	if _, err := plain.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	stage, err := os.MkdirTemp(dir, ".tedc-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	name, err := extract(tar.NewReader(plain), stage)
+	if err != nil {
+		return err
+	}
+
+	// A rename replaces an existing file atomically, but not a directory,
+	// nor a file with a directory; those go first.
+	extracted := filepath.Join(stage, name)
+	if old, err := os.Lstat(dst); err == nil {
+		if info, err := os.Lstat(extracted); err != nil {
+			return err
+		} else if old.IsDir() || info.IsDir() {
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(extracted, dst)
+}
+
+func checkOutput(dst string, overwrite bool) error {
+	if _, err := os.Lstat(dst); err == nil && !overwrite {
+		return fmt.Errorf("%w: %s", ErrExists, dst)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+func contentSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+func writeArchive(w io.Writer, root string, progress *counter) error {
+	tw := tar.NewWriter(w)
+	parent := filepath.Dir(root)
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch mode := info.Mode(); {
+		case mode.IsRegular(), mode.IsDir():
+		case mode&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedFile, p)
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(parent, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, &countingReader{r: f, counter: progress})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extract unpacks an archive below stage and returns its top-level name.
+// Every write goes through an os.Root, so neither ".." nor a symlink in
+// the archive can reach outside stage.
+func extract(tr *tar.Reader, stage string) (string, error) {
+	root, err := os.OpenRoot(stage)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	var top string
+	var dirs []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		name := path.Clean(hdr.Name)
+		first, _, _ := strings.Cut(name, "/")
+		switch {
+		case !filepath.IsLocal(filepath.FromSlash(name)):
+			return "", fmt.Errorf("%w: unsafe path %q", ErrInvalidArchive, hdr.Name)
+		case top == "":
+			top = first
+		case first != top:
+			return "", fmt.Errorf("%w: more than one top-level entry", ErrInvalidArchive)
+		}
+		name = filepath.FromSlash(name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(name, 0o700); err != nil {
+				return "", err
+			}
+			dirs = append(dirs, hdr)
+		case tar.TypeReg:
+			if err := writeEntry(root, name, tr, hdr); err != nil {
+				return "", err
+			}
+		case tar.TypeSymlink:
+			if err := root.Symlink(hdr.Linkname, name); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("%w: %s has unsupported type %q", ErrInvalidArchive, hdr.Name, hdr.Typeflag)
+		}
+	}
+	if top == "" {
+		return "", fmt.Errorf("%w: empty", ErrInvalidArchive)
+	}
+
+	// Directories get their modes and times last: a read-only directory
+	// could not be filled, and filling one changes its mtime.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name := filepath.FromSlash(path.Clean(dirs[i].Name))
+		if err := restoreMetadata(root, name, dirs[i]); err != nil {
+			return "", err
+		}
+	}
+	return top, nil
+}
+
+func writeEntry(root *os.Root, name string, r io.Reader, hdr *tar.Header) error {
+	if err := root.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return restoreMetadata(root, name, hdr)
+}
+
+func restoreMetadata(root *os.Root, name string, hdr *tar.Header) error {
+	if err := root.Chmod(name, hdr.FileInfo().Mode().Perm()); err != nil {
+		return err
+	}
+	return root.Chtimes(name, hdr.ModTime, hdr.ModTime)
+}
+
+// writeFile fills a temporary file next to path with write and renames
+// it into place only when write succeeds.
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tedc-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+type counter struct {
+	done   int64
+	total  int64
+	report Progress
+}
+
+type countingReader struct {
+	r io.Reader
+	*counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.done += int64(n)
+	if r.report != nil && n > 0 {
+		r.report(r.done, r.total)
+	}
+	return n, err
+}
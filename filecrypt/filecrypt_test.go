@@ -0,0 +1,180 @@
+package filecrypt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"txt-encdec-cli/core"
+)
+
+var testKDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+
+func testCryptor(secret string) core.StreamCryptor {
+	return core.NewCryptor(secret, core.AlgAES256GCM, testKDF)
+}
+
+func writeTestFile(t *testing.T, path, content string, mode os.FileMode, mtime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func requireFile(t *testing.T, path, content string, mode os.FileMode, mtime time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("%s = %q, want %q", path, data, content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != mode {
+		t.Fatalf("%s mode = %v, want %v", path, info.Mode().Perm(), mode)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Fatalf("%s mtime = %v, want %v", path, info.ModTime(), mtime)
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	src := filepath.Join(dir, "notes.txt")
+	writeTestFile(t, src, "secret notes", 0o640, mtime)
+
+	var done, total int64
+	progress := func(d, t int64) { done, total = d, t }
+
+	enc := DefaultOutput(src, true)
+	if err := Encrypt(testCryptor("pw"), src, enc, Options{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+	if done != 12 || total != 12 {
+		t.Fatalf("progress = %d/%d, want 12/12", done, total)
+	}
+	if err := Encrypt(testCryptor("pw"), src, enc, Options{}); !errors.Is(err, ErrExists) {
+		t.Fatalf("Encrypt over existing output = %v, want %v", err, ErrExists)
+	}
+
+	if err := Decrypt(testCryptor("pw"), enc, src, Options{}); !errors.Is(err, ErrExists) {
+		t.Fatalf("Decrypt over existing output = %v, want %v", err, ErrExists)
+	}
+	if err := os.WriteFile(src, []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Decrypt(testCryptor("pw"), enc, DefaultOutput(enc, false), Options{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+	requireFile(t, src, "secret notes", 0o640, mtime)
+}
+
+func TestDirectoryRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	src := filepath.Join(dir, "project")
+	writeTestFile(t, filepath.Join(src, "README"), "read me", 0o644, mtime)
+	writeTestFile(t, filepath.Join(src, "bin", "run.sh"), "#!/bin/sh\n", 0o755, mtime)
+	if err := os.Symlink("README", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "bin"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	enc := filepath.Join(dir, "project.tedc")
+	if err := Encrypt(testCryptor("pw"), src, filepath.Join(src, "inside.tedc"), Options{}); !errors.Is(err, ErrOutputInInput) {
+		t.Fatalf("Encrypt into the input = %v, want %v", err, ErrOutputInInput)
+	}
+	if err := Encrypt(testCryptor("pw"), src, enc, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "restored")
+	if err := Decrypt(testCryptor("pw"), enc, out, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	requireFile(t, filepath.Join(out, "README"), "read me", 0o644, mtime)
+	requireFile(t, filepath.Join(out, "bin", "run.sh"), "#!/bin/sh\n", 0o755, mtime)
+	if link, err := os.Readlink(filepath.Join(out, "link")); err != nil || link != "README" {
+		t.Fatalf("link = %q, %v", link, err)
+	}
+	if info, err := os.Stat(filepath.Join(out, "bin")); err != nil || !info.ModTime().Equal(mtime) {
+		t.Fatalf("bin mtime = %v, %v", info.ModTime(), err)
+	}
+}
+
+func TestSymlinkRoot(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	target := filepath.Join(dir, "project")
+	writeTestFile(t, filepath.Join(target, "README"), "read me", 0o644, mtime)
+	src := filepath.Join(dir, "current")
+	if err := os.Symlink("project", src); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Encrypt(testCryptor("pw"), src, filepath.Join(target, "inside.tedc"), Options{}); !errors.Is(err, ErrOutputInInput) {
+		t.Fatalf("Encrypt into the link target = %v, want %v", err, ErrOutputInInput)
+	}
+	enc := DefaultOutput(src, true)
+	if err := Encrypt(testCryptor("pw"), src, enc, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "restored")
+	if err := Decrypt(testCryptor("pw"), enc, out, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	requireFile(t, filepath.Join(out, "README"), "read me", 0o644, mtime)
+}
+
+func TestDecryptFailureLeavesNoOutput(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "data.bin")
+	writeTestFile(t, src, string(make([]byte, 3*core.StreamChunkSize)), 0o600, time.Now())
+	enc := filepath.Join(dir, "data.tedc")
+	if err := Encrypt(testCryptor("pw"), src, enc, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+
+	if err := Decrypt(testCryptor("wrong"), enc, out, Options{}); !errors.Is(err, core.ErrDecryptionFailed) {
+		t.Fatalf("Decrypt with wrong secret = %v, want %v", err, core.ErrDecryptionFailed)
+	}
+
+	data, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.tedc")
+	if err := os.WriteFile(truncated, data[:len(data)-core.StreamChunkSize/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Decrypt(testCryptor("pw"), truncated, out, Options{}); err == nil {
+		t.Fatal("Decrypt of a truncated file succeeded")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("directory holds %d entries after failed decryptions, want 3", len(entries))
+	}
+}
@@ -0,0 +1,180 @@
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+)
+
+const (
+	IdentityExt  = ".key"
+	RecipientExt = ".pub"
+)
+
+var (
+	ErrInvalidName = errors.New("invalid key name")
+	ErrKeyExists   = errors.New("key already exists")
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// Store keeps identities as <name>.key (mode 0600) and recipients as
+// <name>.pub in one directory. Generating an identity writes both, so your
+// own public key is listed among the recipients. Keys are written in age's
+// encoding, so the files also work with age -i and age -R.
+type Store struct {
+	Dir string
+}
+
+type Entry struct {
+	Name string
+	Path string
+}
+
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) Identities() ([]Entry, error) {
+	return s.list(IdentityExt)
+}
+
+func (s *Store) Recipients() ([]Entry, error) {
+	return s.list(RecipientExt)
+}
+
+func (s *Store) list(ext string) ([]Entry, error) {
+	files, err := os.ReadDir(s.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ext)
+		if !ok || file.IsDir() || !validName.MatchString(name) {
+			continue
+		}
+		entries = append(entries, Entry{Name: name, Path: filepath.Join(s.Dir, file.Name())})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func (s *Store) Generate(name string) (*core.Identity, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	identity, err := core.GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	recipient := identity.Recipient()
+
+	contents := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient.AgeString(), identity.AgeString())
+	if err := s.create(name+IdentityExt, contents, 0o600); err != nil {
+		return nil, err
+	}
+	// A recipient added under the same name must not leave the identity
+	// behind, or every retry would stop at the identity instead.
+	if err := s.create(name+RecipientExt, recipient.AgeString()+"\n", 0o644); err != nil {
+		os.Remove(filepath.Join(s.Dir, name+IdentityExt))
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (s *Store) AddRecipient(name string, recipient *core.Recipient) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	return s.create(name+RecipientExt, recipient.AgeString()+"\n", 0o644)
+}
+
+func (s *Store) create(file, contents string, perm os.FileMode) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.Dir, file), os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%w: %s", ErrKeyExists, file)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Identity loads a stored identity by name, or reads an identity file when
+// name is a path.
+func (s *Store) Identity(name string) (*core.Identity, error) {
+	data, err := s.read(name, IdentityExt)
+	if err != nil {
+		return nil, err
+	}
+	return core.ParseIdentity(data)
+}
+
+// Recipient resolves a stored recipient name, a public key, or a path to a
+// public key file.
+func (s *Store) Recipient(name string) (*core.Recipient, error) {
+	if strings.HasPrefix(name, core.RecipientPrefix) || strings.HasPrefix(name, core.AgeRecipientHRP+"1") {
+		return core.ParseRecipient(name)
+	}
+
+	data, err := s.read(name, RecipientExt)
+	if err != nil {
+		return nil, err
+	}
+	return core.ParseRecipient(data)
+}
+
+func (s *Store) read(name, ext string) (string, error) {
+	path := name
+	if validName.MatchString(name) {
+		if stored := filepath.Join(s.Dir, name+ext); fileExists(stored) {
+			path = stored
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package keystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"txt-encdec-cli/core"
+)
+
+func TestGenerateAndLoad(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "keys"))
+
+	identity, err := store.Generate("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Generate("me"); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("Generate twice = %v, want %v", err, ErrKeyExists)
+	}
+
+	info, err := os.Stat(filepath.Join(store.Dir, "me"+IdentityExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("identity file mode = %v, want 0600", perm)
+	}
+
+	loaded, err := store.Identity("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.String() != identity.String() {
+		t.Fatal("loaded identity does not match generated one")
+	}
+
+	loadedByPath, err := store.Identity(filepath.Join(store.Dir, "me"+IdentityExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedByPath.String() != identity.String() {
+		t.Fatal("identity loaded by path does not match generated one")
+	}
+
+	recipient, err := store.Recipient("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.String() != identity.Recipient().String() {
+		t.Fatal("stored recipient does not match identity")
+	}
+}
+
+func TestGenerateOverRecipient(t *testing.T) {
+	store := New(t.TempDir())
+	other, err := core.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddRecipient("alice", other.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := store.Generate("alice"); !errors.Is(err, ErrKeyExists) {
+			t.Fatalf("Generate over a recipient = %v, want %v", err, ErrKeyExists)
+		}
+		if _, err := os.Stat(filepath.Join(store.Dir, "alice"+IdentityExt)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("failed Generate left an identity behind: %v", err)
+		}
+	}
+	if recipient, err := store.Recipient("alice"); err != nil || recipient.String() != other.Recipient().String() {
+		t.Fatalf("recipient after failed Generate = %v, %v", recipient, err)
+	}
+}
+
+func TestListAndResolve(t *testing.T) {
+	store := New(t.TempDir())
+
+	if _, err := store.Generate("me"); err != nil {
+		t.Fatal(err)
+	}
+	teammate, err := core.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddRecipient("alice", teammate.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddRecipient("../evil", teammate.Recipient()); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("AddRecipient with path = %v, want %v", err, ErrInvalidName)
+	}
+
+	identities, err := store.Identities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := store.Recipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].Name != "me" {
+		t.Fatalf("Identities = %v, want [me]", identities)
+	}
+	if len(recipients) != 2 || recipients[0].Name != "alice" || recipients[1].Name != "me" {
+		t.Fatalf("Recipients = %v, want [alice me]", recipients)
+	}
+
+	literal, err := store.Recipient(teammate.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if literal.String() != teammate.Recipient().String() {
+		t.Fatal("literal recipient was not parsed as given")
+	}
+
+	if _, err := store.Identity("nobody"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Identity(nobody) = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestMissingDirIsEmpty(t *testing.T) {
+	store := New(filepath.Join(t.TempDir(), "missing"))
+
+	entries, err := store.Recipients()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Recipients = %v, %v; want none", entries, err)
+	}
+}
@@ -3,6 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
+	"txt-encdec-cli/cli"
+	"txt-encdec-cli/config"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/keystore"
+	"txt-encdec-cli/platform"
 	"txt-encdec-cli/tui"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,10 +17,58 @@ import (
 const (
 	appName    = "Text Encryptor"
 	appVersion = "2.0.0"
+	cmdName    = "enc"
 )
 
 func main() {
-	model := tui.New()
+	if len(os.Args) == 2 && os.Args[1] == platform.ClipboardHelperArg {
+		os.Exit(platform.RunClipboardHelper(os.Stdin, os.Stdout))
+	}
+
+	configPath, args, err := splitConfigFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmdName, err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: config: %v\n", cmdName, err)
+		os.Exit(cli.ExitUsage)
+	}
+
+	if len(args) > 0 && cli.IsCommand(args[0]) {
+		kdf, _ := cfg.KDFParams()
+		packing, _ := cfg.PackingParams()
+		cipher, _ := core.AlgorithmByName(cfg.Cipher)
+		app := &cli.App{
+			Name:     cmdName,
+			Version:  appVersion,
+			Stdin:    os.Stdin,
+			Stdout:   os.Stdout,
+			Stderr:   os.Stderr,
+			Cipher:   cipher,
+			Armor:    cfg.Armor,
+			Encoding: cfg.Encoding,
+			KDF:      kdf,
+			OpenSSL:  cfg.OpenSSLParams(),
+			Packing:  packing,
+			Keys:     keystore.New(cfg.KeyStoreDir()),
+
+			Clipboard: cfg.ClipboardOptions(),
+
+			Keyfiles:  cfg.Secret.Keyfiles,
+			Challenge: cfg.Secret.Challenge,
+		}
+		os.Exit(app.Run(args))
+	}
+
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: unknown command %q (see '%s help')\n", cmdName, args[0], cmdName)
+		os.Exit(cli.ExitUsage)
+	}
+
+	model := tui.NewWithConfig(tui.AppConfigFrom(cfg))
 	program := tea.NewProgram(
 		model,
 		tea.WithAltScreen(),
@@ -26,3 +80,23 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func splitConfigFlag(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", args, nil
+	}
+
+	switch arg := args[0]; {
+	case arg == "--config" || arg == "-config":
+		if len(args) < 2 || args[1] == "" {
+			return "", nil, fmt.Errorf("%s requires a file argument", arg)
+		}
+		return args[1], args[2:], nil
+	case strings.HasPrefix(arg, "--config="):
+		return strings.TrimPrefix(arg, "--config="), args[1:], nil
+	case strings.HasPrefix(arg, "-config="):
+		return strings.TrimPrefix(arg, "-config="), args[1:], nil
+	}
+
+	return "", args, nil
+}
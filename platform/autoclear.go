@@ -0,0 +1,158 @@
+package platform
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const ClipboardHelperArg = "__clipboard-clear"
+
+var ErrClearHelper = errors.New("clipboard clear helper failed")
+
+type ClearOutcome int
+
+const (
+	ClearDone ClearOutcome = iota
+	ClearSkipped
+	ClearFailed
+)
+
+func (o ClearOutcome) String() string {
+	switch o {
+	case ClearDone:
+		return "cleared"
+	case ClearSkipped:
+		return "changed"
+	case ClearFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(o))
+	}
+}
+
+type ClearResult struct {
+	Outcome ClearOutcome
+	Err     error
+}
+
+type ClearReporter interface {
+	ClearResults() <-chan ClearResult
+}
+
+func (m *LinuxClipboardManager) startAutoClear(text string) {
+	sum := sha256.Sum256([]byte(text))
+
+	exe, err := os.Executable()
+	if err != nil {
+		m.report(ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: %v", ErrClearHelper, err)})
+		return
+	}
+
+	cmd := exec.Command(exe, ClipboardHelperArg)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		m.report(ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: %v", ErrClearHelper, err)})
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		m.report(ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: %v", ErrClearHelper, err)})
+		return
+	}
+
+	if err := cmd.Start(); err != nil {
+		m.report(ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: %v", ErrClearHelper, err)})
+		return
+	}
+
+	fmt.Fprintf(stdin, "%d %d %s %s\n", int64(m.clearAfter), int64(m.timeout), hex.EncodeToString(sum[:]), m.target)
+	stdin.Close()
+
+	go func() {
+		reply, _ := bufio.NewReader(stdout).ReadString('\n')
+		cmd.Wait()
+		m.report(parseClearReply(reply))
+	}()
+}
+
+func (m *LinuxClipboardManager) report(result ClearResult) {
+	select {
+	case m.results <- result:
+	default:
+	}
+}
+
+func parseClearReply(reply string) ClearResult {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case reply == ClearDone.String():
+		return ClearResult{Outcome: ClearDone}
+	case reply == ClearSkipped.String():
+		return ClearResult{Outcome: ClearSkipped}
+	case reply == "":
+		return ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: no reply", ErrClearHelper)}
+	default:
+		return ClearResult{Outcome: ClearFailed, Err: fmt.Errorf("%w: %s", ErrClearHelper, reply)}
+	}
+}
+
+// RunClipboardHelper waits, then clears whichever selections still hold
+// the text with the requested digest; see clearUnchanged. The request
+// carries the copying manager's timeout; its backend needs no passing on,
+// since only the system backend starts the helper.
+func RunClipboardHelper(in io.Reader, out io.Writer) int {
+	var after, timeout int64
+	var digest, target string
+	if _, err := fmt.Fscan(in, &after, &timeout, &digest, &target); err != nil {
+		fmt.Fprintf(out, "bad request: %v\n", err)
+		return 2
+	}
+
+	if timeout <= 0 {
+		fmt.Fprintf(out, "bad request: invalid timeout\n")
+		return 2
+	}
+
+	var want [sha256.Size]byte
+	if len(digest) != hex.EncodedLen(sha256.Size) {
+		fmt.Fprintf(out, "bad request: invalid digest\n")
+		return 2
+	}
+	if _, err := hex.Decode(want[:], []byte(digest)); err != nil {
+		fmt.Fprintf(out, "bad request: invalid digest\n")
+		return 2
+	}
+	switch ClipboardTarget(target) {
+	case TargetClipboard, TargetPrimary, TargetBoth:
+	default:
+		fmt.Fprintf(out, "bad request: invalid target %q\n", target)
+		return 2
+	}
+
+	time.Sleep(time.Duration(after))
+
+	m := NewLinuxClipboardManager(ClipboardOptions{Backend: ClipboardSystem, Target: ClipboardTarget(target), Timeout: time.Duration(timeout)})
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	result := m.clearUnchanged(ctx, want, ClipboardTarget(target))
+	if result.Outcome == ClearFailed {
+		fmt.Fprintf(out, "%v\n", result.Err)
+		return 1
+	}
+
+	fmt.Fprintln(out, result.Outcome)
+	return 0
+}
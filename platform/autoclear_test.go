@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClipboardHelper(t *testing.T) {
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", startFakeX(t))
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	owner := newX11Clipboard()
+	if err := owner.Copy(ctx, selClipboard, "copied secret"); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("copied secret"))
+	digest := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		request string
+		code    int
+		reply   string
+	}{
+		{"no timeout", fmt.Sprintf("0 %s clipboard\n", digest), 2, "bad request"},
+		{"zero timeout", fmt.Sprintf("0 0 %s clipboard\n", digest), 2, "bad request: invalid timeout"},
+		{"bad digest", "0 1000000000 abc clipboard\n", 2, "bad request: invalid digest"},
+		{"bad target", fmt.Sprintf("0 1000000000 %s secondary\n", digest), 2, "bad request: invalid target"},
+		{"other text", fmt.Sprintf("0 1000000000 %s clipboard\n", strings.Repeat("0", len(digest))), 0, "changed"},
+		{"clears", fmt.Sprintf("0 1000000000 %s clipboard\n", digest), 0, "cleared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if code := RunClipboardHelper(strings.NewReader(tt.request), &out); code != tt.code || !strings.HasPrefix(out.String(), tt.reply) {
+				t.Fatalf("RunClipboardHelper = %d, %q, want %d, %q", code, out.String(), tt.code, tt.reply)
+			}
+		})
+	}
+
+	if got, err := owner.Read(ctx, selClipboard); err != nil || got != "" {
+		t.Fatalf("clipboard after the helper = %q, %v, want it empty", got, err)
+	}
+}
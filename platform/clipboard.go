@@ -1,16 +1,27 @@
 package platform
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"os/exec"
-	"syscall"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
+// DefaultClipboardOptions starts from these; the managers only use the
+// options they are given.
+const (
+	DefaultClipboardTimeout    = 17 * time.Second
+	DefaultClipboardClearAfter = 2 * time.Second
+)
+
 var (
-	ClipboardTimeout   = 17 * time.Second
 	ErrNoClipboardTool = errors.New("no clipboard tool available")
 	ErrClipboardFailed = errors.New("clipboard operation failed")
 )
@@ -20,28 +31,157 @@ type ClipboardManager interface {
 	Read() (string, error)
 }
 
-type clipboardTool struct {
-	name     string
-	copyArgs []string
-	readArgs []string
+// selection is one of the two selections X11 and Wayland keep.
+type selection int
+
+const (
+	selClipboard selection = iota
+	selPrimary
+)
+
+func (s selection) String() string {
+	if s == selPrimary {
+		return "primary selection"
+	}
+	return "clipboard"
+}
+
+// SensitiveMimeType is offered alongside the text, with the value
+// SensitiveMimeValue, so clipboard managers that honour the convention
+// keep the copy out of their history.
+const (
+	SensitiveMimeType  = "x-kde-passwordManagerHint"
+	SensitiveMimeValue = "secret"
+)
+
+// A clipboardTool is one way of reaching the system selections: a display
+// protocol spoken in-process, or an external program.
+type clipboardTool interface {
+	Name() string
+	Copy(ctx context.Context, which selection, text string) error
+	Read(ctx context.Context, which selection) (string, error)
+}
+
+// A selectionOwner serves copied text from this process for as long as it
+// holds a selection, so it can give it up at an exact time instead of
+// leaving that to the clear helper.
+type selectionOwner interface {
+	clipboardTool
+	owned(which selection) *ownedSelection
+	// release gives up sel within ctx, reporting false when another
+	// client had already taken the selection.
+	release(ctx context.Context, sel *ownedSelection) (bool, error)
+}
+
+// A connectedTool keeps its connection to the display server open
+// between calls until close drops it, giving up any selection it owns.
+type connectedTool interface {
+	clipboardTool
+	close()
+}
+
+// errToolClosed is why a selection is lost when its tool is closed.
+var errToolClosed = fmt.Errorf("%w: connection closed", ErrClipboardFailed)
+
+func closeTool(tool clipboardTool) {
+	if t, ok := tool.(connectedTool); ok {
+		t.close()
+	}
+}
+
+// ownedSelection is text a selectionOwner is serving. lost is closed when
+// another client takes the selection or the connection to the display
+// drops, in which case err says why.
+type ownedSelection struct {
+	which selection
+	text  string
+	lost  chan struct{}
+	once  sync.Once
+	err   error
+}
+
+func newOwnedSelection(which selection, text string) *ownedSelection {
+	return &ownedSelection{which: which, text: text, lost: make(chan struct{})}
+}
+
+func (s *ownedSelection) lose(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.lost)
+	})
+}
+
+func (s *ownedSelection) isLost() bool {
+	select {
+	case <-s.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// execTool drives a clipboard program; selectionArgs picks the selection
+// and comes before copyArgs or readArgs.
+type execTool struct {
+	name          string
+	copyArgs      []string
+	readName      string
+	readArgs      []string
+	selectionArgs [2][]string
+	sensitiveFlag string
+
+	mu        sync.Mutex
+	sensitive *bool
 }
 
 type LinuxClipboardManager struct {
-	tools   []clipboardTool
-	timeout time.Duration
+	tools      []clipboardTool
+	target     ClipboardTarget
+	timeout    time.Duration
+	clearAfter time.Duration
+	results    chan ClearResult
+
+	mu   sync.Mutex
+	last [2]clipboardTool // the tool that last worked for each selection
 }
 
-func NewLinuxClipboardManager() *LinuxClipboardManager {
+func newWlCopy() clipboardTool {
+	return &execTool{name: "wl-copy", readName: "wl-paste", readArgs: []string{"--no-newline"}, selectionArgs: [2][]string{nil, {"--primary"}}, sensitiveFlag: "--sensitive"}
+}
+
+func newXclip() clipboardTool {
+	return &execTool{name: "xclip", readName: "xclip", readArgs: []string{"-o"}, selectionArgs: [2][]string{{"-selection", "clipboard"}, {"-selection", "primary"}}}
+}
+
+func newXsel() clipboardTool {
+	return &execTool{name: "xsel", copyArgs: []string{"--input"}, readName: "xsel", readArgs: []string{"--output"}, selectionArgs: [2][]string{{"--clipboard"}, {"--primary"}}}
+}
+
+// NewLinuxClipboardManager uses the system backends discovery finds
+// available, in its order: the in-process Wayland and X11 backends before
+// the wl-copy, xclip and xsel programs. opts.Backend is not consulted.
+func NewLinuxClipboardManager(opts ClipboardOptions) *LinuxClipboardManager {
+	var tools []clipboardTool
+	for _, c := range discoverClipboard() {
+		if c.Available && c.newTool != nil {
+			tools = append(tools, c.newTool())
+		}
+	}
 	return &LinuxClipboardManager{
-		tools: []clipboardTool{
-			{"wl-copy", nil, []string{"wl-paste"}},
-			{"xclip", []string{"-selection", "clipboard"}, []string{"-selection", "clipboard", "-o"}},
-			{"xsel", []string{"--clipboard", "--input"}, []string{"--clipboard", "--output"}},
-		},
-		timeout: ClipboardTimeout,
+		tools:      tools,
+		target:     opts.Target,
+		timeout:    opts.Timeout,
+		clearAfter: opts.ClearAfter,
+		results:    make(chan ClearResult, 1),
 	}
 }
 
+func (m *LinuxClipboardManager) ClearResults() <-chan ClearResult {
+	return m.results
+}
+
+// Copy puts text in every selection of the target. When one of them
+// fails the others keep the text, and are still cleared on time.
 func (m *LinuxClipboardManager) Copy(text string) error {
 	if text == "" {
 		return m.clearClipboard()
@@ -50,43 +190,181 @@ func (m *LinuxClipboardManager) Copy(text string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
 	defer cancel()
 
-	var lastErr error
+	var firstErr error
+	copied, owned := false, true
+	for _, which := range m.target.selections() {
+		tool, err := m.copySelection(ctx, which, text)
+		if err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		copied = true
+		if _, ok := tool.(selectionOwner); !ok {
+			owned = false
+		}
+	}
+
+	if copied && m.clearAfter > 0 {
+		m.scheduleClear(text, owned)
+	}
+	return firstErr
+}
+
+// ordered lists the tools to try for which, starting with the one that
+// worked last time.
+func (m *LinuxClipboardManager) ordered(which selection) []clipboardTool {
+	m.mu.Lock()
+	last := m.last[which]
+	m.mu.Unlock()
+
+	i := slices.Index(m.tools, last)
+	if i <= 0 {
+		return m.tools
+	}
+	return slices.Concat([]clipboardTool{last}, m.tools[:i], m.tools[i+1:])
+}
+
+func (m *LinuxClipboardManager) remember(which selection, tool clipboardTool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last[which] = tool
+}
+
+// toolErrors joins what every tool tried reported, each under its name.
+func toolErrors(which selection, errs []error) error {
+	if len(errs) == 0 {
+		return ErrNoClipboardTool
+	}
+	return fmt.Errorf("%w on the %s: %w", ErrClipboardFailed, which, errors.Join(errs...))
+}
+
+// copySelection copies with the first tool that manages to, and returns
+// that tool.
+func (m *LinuxClipboardManager) copySelection(ctx context.Context, which selection, text string) (clipboardTool, error) {
+	var errs []error
+	for _, tool := range m.ordered(which) {
+		err := tool.Copy(ctx, which, text)
+		if err == nil {
+			m.remember(which, tool)
+			return tool, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", tool.Name(), err))
+	}
+	return nil, toolErrors(which, errs)
+}
+
+// scheduleClear clears the selections when clearAfter has passed. When
+// this process owns everything it copied it does so itself; text handed
+// to a program outlives the process and is cleared by the helper.
+func (m *LinuxClipboardManager) scheduleClear(text string, owned bool) {
+	if !owned {
+		m.startAutoClear(text)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	go func() {
+		time.Sleep(m.clearAfter)
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		defer cancel()
+		m.report(m.clearUnchanged(ctx, sum, m.target))
+	}()
+}
+
+// clearUnchanged empties each selection that still holds the text whose
+// SHA-256 is sum. Both selections are checked whatever the target, since
+// selecting revealed text in a terminal puts it in PRIMARY as well; only
+// failures on the target's own selections are reported.
+func (m *LinuxClipboardManager) clearUnchanged(ctx context.Context, sum [sha256.Size]byte, target ClipboardTarget) ClearResult {
+	result := ClearResult{Outcome: ClearSkipped}
+	for _, which := range TargetBoth.selections() {
+		cleared, err := m.clearSelection(ctx, which, sum)
+		switch {
+		case err != nil && target.has(which):
+			if result.Outcome != ClearFailed {
+				result = ClearResult{Outcome: ClearFailed, Err: err}
+			}
+		case cleared && result.Outcome == ClearSkipped:
+			result.Outcome = ClearDone
+		}
+	}
+	return result
+}
+
+func (m *LinuxClipboardManager) clearSelection(ctx context.Context, which selection, sum [sha256.Size]byte) (bool, error) {
 	for _, tool := range m.tools {
-		if err := m.copyWithTool(ctx, tool, text); err == nil {
-			m.startBackgroundClear(text, 2*time.Second)
-			return nil
-		} else {
-			lastErr = err
+		owner, ok := tool.(selectionOwner)
+		if !ok {
+			continue
+		}
+		if sel := owner.owned(which); sel != nil && !sel.isLost() {
+			if !sameDigest(sel.text, sum) {
+				return false, nil
+			}
+			return owner.release(ctx, sel)
 		}
 	}
 
-	if lastErr != nil {
-		return fmt.Errorf("%w: %v", ErrClipboardFailed, lastErr)
+	current, err := m.readSelection(ctx, which)
+	if err != nil || !sameDigest(current, sum) {
+		return false, err
+	}
+	if _, err := m.copySelection(ctx, which, ""); err != nil {
+		return false, err
 	}
-	return ErrNoClipboardTool
+	return true, nil
+}
+
+func sameDigest(text string, sum [sha256.Size]byte) bool {
+	got := sha256.Sum256([]byte(text))
+	return subtle.ConstantTimeCompare(got[:], sum[:]) == 1
 }
 
 func (m *LinuxClipboardManager) clearClipboard() error {
 	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
 	defer cancel()
 
-	var lastErr error
-	for _, tool := range m.tools {
-		if err := m.copyWithTool(ctx, tool, ""); err == nil {
-			return nil
-		} else {
-			lastErr = err
+	var firstErr error
+	for _, which := range m.target.selections() {
+		if _, err := m.copySelection(ctx, which, ""); err != nil {
+			firstErr = cmp.Or(firstErr, err)
 		}
 	}
+	return firstErr
+}
+
+// Read returns the first selection of the target: the clipboard unless
+// the target is PRIMARY alone.
+func (m *LinuxClipboardManager) Read() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
 
-	if lastErr != nil {
-		return fmt.Errorf("%w: %v", ErrClipboardFailed, lastErr)
+	return m.readSelection(ctx, m.target.selections()[0])
+}
+
+func (m *LinuxClipboardManager) readSelection(ctx context.Context, which selection) (string, error) {
+	var errs []error
+	for _, tool := range m.ordered(which) {
+		content, err := tool.Read(ctx, which)
+		if err == nil {
+			m.remember(which, tool)
+			return content, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", tool.Name(), err))
 	}
-	return ErrNoClipboardTool
+	return "", toolErrors(which, errs)
 }
 
-func (m *LinuxClipboardManager) copyWithTool(ctx context.Context, tool clipboardTool, text string) error {
-	cmd := exec.CommandContext(ctx, tool.name, tool.copyArgs...)
+func (t *execTool) Name() string {
+	return t.name
+}
+
+func (t *execTool) Copy(ctx context.Context, which selection, text string) error {
+	args := slices.Concat(t.selectionArgs[which], t.copyArgs)
+	if text != "" && t.supportsSensitive(ctx) {
+		args = append([]string{t.sensitiveFlag}, args...)
+	}
+	cmd := exec.CommandContext(ctx, t.name, args...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -94,77 +372,44 @@ func (m *LinuxClipboardManager) copyWithTool(ctx context.Context, tool clipboard
 	}
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start %s: %w", tool.name, err)
+		return fmt.Errorf("failed to start %s: %w", t.name, err)
 	}
 
 	if _, err := stdin.Write([]byte(text)); err != nil {
 		stdin.Close()
-		return fmt.Errorf("failed to write to %s: %w", tool.name, err)
+		return fmt.Errorf("failed to write to %s: %w", t.name, err)
 	}
 	stdin.Close()
 
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("%s failed: %w", tool.name, err)
+		return fmt.Errorf("%s failed: %w", t.name, err)
 	}
 
 	return nil
 }
 
-func (m *LinuxClipboardManager) Read() (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
-	defer cancel()
-
-	var lastErr error
-	for _, tool := range m.tools {
-		if content, err := m.readWithTool(ctx, tool); err == nil {
-			return content, nil
-		} else {
-			lastErr = err
-		}
-	}
-
-	if lastErr != nil {
-		return "", fmt.Errorf("%w: %v", ErrClipboardFailed, lastErr)
-	}
-	return "", ErrNoClipboardTool
-}
-
-func (m *LinuxClipboardManager) readWithTool(ctx context.Context, tool clipboardTool) (string, error) {
-	var cmd *exec.Cmd
-	if tool.name == "wl-copy" {
-		cmd = exec.CommandContext(ctx, "wl-paste")
-	} else {
-		cmd = exec.CommandContext(ctx, tool.name, tool.readArgs...)
-	}
+func (t *execTool) Read(ctx context.Context, which selection) (string, error) {
+	cmd := exec.CommandContext(ctx, t.readName, slices.Concat(t.selectionArgs[which], t.readArgs)...)
 
 	output, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("%s failed: %w", tool.name, err)
+		return "", fmt.Errorf("%s failed: %w", t.readName, err)
 	}
 
 	return string(output), nil
 }
 
-func (m *LinuxClipboardManager) startBackgroundClear(originalText string, delay time.Duration) {
-	script := fmt.Sprintf(`(
-		sleep %d
-		current=$(wl-paste 2>/dev/null || xclip -selection clipboard -o 2>/dev/null || xsel --clipboard --output 2>/dev/null)
-		if [ "$current" = "%s" ]; then
-			echo "" | wl-copy 2>/dev/null || echo "" | xclip -selection clipboard 2>/dev/null || echo "" | xsel --clipboard --input 2>/dev/null
-		fi
-	) &`, int(delay.Seconds()), originalText)
-
-	cmd := exec.Command("sh", "-c", script)
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	cmd.Start()
-}
-
-var defaultClipboard ClipboardManager = NewLinuxClipboardManager()
-
-func CopyToClipboard(text string) error {
-	return defaultClipboard.Copy(text)
-}
+func (t *execTool) supportsSensitive(ctx context.Context) bool {
+	if t.sensitiveFlag == "" {
+		return false
+	}
 
-func ClearClipboard() error {
-	return defaultClipboard.Copy("")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sensitive == nil {
+		help, _ := exec.CommandContext(ctx, t.name, "--help").CombinedOutput()
+		supported := strings.Contains(string(help), t.sensitiveFlag)
+		t.sensitive = &supported
+	}
+	return *t.sensitive
 }
@@ -0,0 +1,291 @@
+package platform
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClipboardProbeTimeout bounds each step of a diagnosis, so a backend
+// that hangs is reported instead of stalling the others.
+var ClipboardProbeTimeout = 3 * time.Second
+
+// ClipboardEnv is what backend discovery looks at: the display servers,
+// whether the terminal is remote or inside tmux, and which clipboard
+// programs are on PATH.
+type ClipboardEnv struct {
+	WaylandDisplay string
+	Display        string
+	SSH            bool
+	Tmux           bool
+	Programs       map[string]string
+}
+
+var clipboardPrograms = []string{"wl-copy", "wl-paste", "xclip", "xsel"}
+
+func CurrentClipboardEnv() ClipboardEnv {
+	env := ClipboardEnv{
+		WaylandDisplay: os.Getenv("WAYLAND_DISPLAY"),
+		Display:        os.Getenv("DISPLAY"),
+		SSH:            os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "",
+		Tmux:           os.Getenv("TMUX") != "",
+		Programs:       make(map[string]string),
+	}
+	for _, name := range clipboardPrograms {
+		if path, err := exec.LookPath(name); err == nil {
+			env.Programs[name] = path
+		}
+	}
+	return env
+}
+
+func (e ClipboardEnv) String() string {
+	parts := []string{"WAYLAND_DISPLAY " + orNotSet(e.WaylandDisplay), "DISPLAY " + orNotSet(e.Display)}
+	if e.SSH {
+		parts = append(parts, "over SSH")
+	}
+	if e.Tmux {
+		parts = append(parts, "in tmux")
+	}
+	return strings.Join(parts, " , ")
+}
+
+func orNotSet(value string) string {
+	if value == "" {
+		return "not set"
+	}
+	return value
+}
+
+// A ClipboardCandidate is one backend discovery considered. One that
+// cannot work here has Available false and Detail saying why.
+type ClipboardCandidate struct {
+	Name      string
+	Backend   ClipboardBackend
+	Available bool
+	Detail    string
+
+	newTool func() clipboardTool // nil for OSC 52
+}
+
+// systemBackends lists the ways to the system clipboard in order of
+// preference: the in-process protocols before the programs that speak
+// them, and Wayland before X11.
+var systemBackends = []struct {
+	name     string
+	wayland  bool // needs WAYLAND_DISPLAY rather than DISPLAY
+	programs []string
+	newTool  func() clipboardTool
+}{
+	{"wayland", true, nil, func() clipboardTool { return newWaylandClipboard() }},
+	{"wl-copy", true, []string{"wl-copy", "wl-paste"}, newWlCopy},
+	{"x11", false, nil, func() clipboardTool { return newX11Clipboard() }},
+	{"xclip", false, []string{"xclip"}, newXclip},
+	{"xsel", false, []string{"xsel"}, newXsel},
+}
+
+// DiscoverClipboard ranks the backends env allows, best first, followed by
+// the ones it rules out. OSC 52 comes after the system clipboard, as most
+// terminals cannot read it back.
+func DiscoverClipboard(env ClipboardEnv) []ClipboardCandidate {
+	var available, ruledOut []ClipboardCandidate
+	for _, b := range systemBackends {
+		c := ClipboardCandidate{Name: b.name, Backend: ClipboardSystem, newTool: b.newTool}
+		variable, value := "DISPLAY", env.Display
+		if b.wayland {
+			variable, value = "WAYLAND_DISPLAY", env.WaylandDisplay
+		}
+		missing := slices.IndexFunc(b.programs, func(name string) bool { return env.Programs[name] == "" })
+		switch {
+		case value == "":
+			c.Detail = variable + " is not set"
+		case missing >= 0:
+			c.Detail = b.programs[missing] + " is not on PATH"
+		case len(b.programs) > 0:
+			c.Available, c.Detail = true, env.Programs[b.programs[0]]
+		default:
+			c.Available, c.Detail = true, variable+" "+value
+		}
+
+		if c.Available {
+			available = append(available, c)
+		} else {
+			ruledOut = append(ruledOut, c)
+		}
+	}
+
+	osc52 := ClipboardCandidate{Name: "osc52", Backend: ClipboardOSC52, Available: true, Detail: osc52Detail(env)}
+	return slices.Concat(available, []ClipboardCandidate{osc52}, ruledOut)
+}
+
+func osc52Detail(env ClipboardEnv) string {
+	detail := "terminal escape sequences"
+	if env.SSH {
+		detail += ", over SSH"
+	}
+	if env.Tmux {
+		detail += ", through tmux (needs allow-passthrough on)"
+	}
+	return detail
+}
+
+// discovery caches DiscoverClipboard for the environment it ran in, so
+// PATH is searched once rather than on every copy.
+var discovery struct {
+	sync.Mutex
+	key        string
+	candidates []ClipboardCandidate
+}
+
+func discoverClipboard() []ClipboardCandidate {
+	var key strings.Builder
+	for _, name := range []string{"WAYLAND_DISPLAY", "DISPLAY", "SSH_CONNECTION", "SSH_TTY", "TMUX", "PATH"} {
+		key.WriteString(os.Getenv(name) + "\x00")
+	}
+
+	discovery.Lock()
+	defer discovery.Unlock()
+	if discovery.candidates == nil || discovery.key != key.String() {
+		discovery.key = key.String()
+		discovery.candidates = DiscoverClipboard(CurrentClipboardEnv())
+	}
+	return discovery.candidates
+}
+
+// chosenBackend is the backend NewClipboardManager uses for backend.
+func chosenBackend(backend ClipboardBackend, candidates []ClipboardCandidate) string {
+	for _, c := range candidates {
+		if c.Available && (backend == ClipboardAuto || backend == "" || backend == c.Backend) {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// ClipboardCheck is what DiagnoseClipboard found out about one backend.
+// Copy and Read are how long those steps took; Verified means the text
+// read back matched what was copied on every selection tried.
+type ClipboardCheck struct {
+	ClipboardCandidate
+	Chosen   bool
+	Copied   bool
+	Verified bool
+	Copy     time.Duration
+	Read     time.Duration
+	Err      error
+}
+
+func (c ClipboardCheck) Status() string {
+	switch {
+	case !c.Available:
+		return "unavailable"
+	case c.Verified:
+		return "ok"
+	case c.Copied:
+		return "copy only"
+	default:
+		return "failed"
+	}
+}
+
+// Latency reports the copy and read times, the copy alone when it failed,
+// or nothing for a backend that was not tried.
+func (c ClipboardCheck) Latency() string {
+	const precision = 100 * time.Microsecond
+	switch {
+	case !c.Available:
+		return ""
+	case !c.Copied:
+		return fmt.Sprintf("copy %s", c.Copy.Round(precision))
+	default:
+		return fmt.Sprintf("copy %s , read %s", c.Copy.Round(precision), c.Read.Round(precision))
+	}
+}
+
+// DiagnoseClipboard tries every available backend, one at a time, on the
+// selections of opts.Target: it copies a random marker, reads it back
+// through a separate connection, and empties the selection again. Whatever
+// the selections held before is lost.
+func DiagnoseClipboard(opts ClipboardOptions) []ClipboardCheck {
+	return diagnose(opts, discoverClipboard())
+}
+
+func diagnose(opts ClipboardOptions, candidates []ClipboardCandidate) []ClipboardCheck {
+	chosen := chosenBackend(opts.Backend, candidates)
+
+	checks := make([]ClipboardCheck, len(candidates))
+	for i, c := range candidates {
+		checks[i] = ClipboardCheck{ClipboardCandidate: c, Chosen: c.Name == chosen}
+		if c.Available {
+			checks[i].probe(opts)
+		}
+	}
+	return checks
+}
+
+func (c *ClipboardCheck) probe(opts ClipboardOptions) {
+	var token [8]byte
+	rand.Read(token[:])
+	marker := "enc-doctor-" + hex.EncodeToString(token[:])
+
+	if c.newTool == nil {
+		m := NewOSC52ClipboardManager(opts)
+		c.time(&c.Copy, func() error { return m.Copy(marker) })
+		if c.Copied = c.Err == nil; c.Copied {
+			c.compare(marker, func() (string, error) { return m.Read() })
+			m.Copy("")
+		}
+		return
+	}
+
+	// An in-process owner answers reads of its own selection locally, so
+	// the read goes through a second instance to cross the display server.
+	writer, reader := c.newTool(), c.newTool()
+	defer closeTool(writer)
+	defer closeTool(reader)
+	for _, which := range opts.Target.selections() {
+		c.Verified = false
+		ctx, cancel := context.WithTimeout(context.Background(), ClipboardProbeTimeout)
+		c.time(&c.Copy, func() error { return writer.Copy(ctx, which, marker) })
+		if c.Copied = c.Err == nil; c.Copied {
+			c.compare(marker, func() (string, error) { return reader.Read(ctx, which) })
+			writer.Copy(ctx, which, "")
+		}
+		cancel()
+		if c.Err != nil {
+			c.Err = fmt.Errorf("%s: %w", which, c.Err)
+			return
+		}
+	}
+}
+
+// time adds how long step took to total, recording its error.
+func (c *ClipboardCheck) time(total *time.Duration, step func() error) {
+	start := time.Now()
+	c.Err = step()
+	*total += time.Since(start)
+}
+
+func (c *ClipboardCheck) compare(marker string, read func() (string, error)) {
+	var got string
+	c.time(&c.Read, func() (err error) {
+		got, err = read()
+		return err
+	})
+	switch {
+	case c.Err != nil:
+		c.Verified = false
+	case strings.TrimRight(got, "\r\n") != marker:
+		c.Verified = false
+		c.Err = fmt.Errorf("%w: read back %d bytes that differ from the %d copied", ErrClipboardFailed, len(got), len(marker))
+	default:
+		c.Verified = true
+	}
+}
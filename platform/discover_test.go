@@ -0,0 +1,183 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiscoverClipboard(t *testing.T) {
+	programs := map[string]string{"wl-copy": "/usr/bin/wl-copy", "wl-paste": "/usr/bin/wl-paste", "xsel": "/usr/bin/xsel"}
+	for _, tc := range []struct {
+		name      string
+		env       ClipboardEnv
+		available []string
+		chosen    string
+	}{
+		{"wayland with xwayland", ClipboardEnv{WaylandDisplay: "wayland-0", Display: ":0", Programs: programs}, []string{"wayland", "wl-copy", "x11", "xsel", "osc52"}, "wayland"},
+		{"x11 only", ClipboardEnv{Display: ":0", Programs: programs}, []string{"x11", "xsel", "osc52"}, "x11"},
+		{"ssh without display", ClipboardEnv{SSH: true, Tmux: true, Programs: programs}, []string{"osc52"}, "osc52"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			candidates := DiscoverClipboard(tc.env)
+			var available []string
+			for _, c := range candidates {
+				if c.Available {
+					available = append(available, c.Name)
+				} else if c.Detail == "" {
+					t.Errorf("%s is unavailable without a reason", c.Name)
+				}
+			}
+			if !slices.Equal(available, tc.available) || len(candidates) != len(systemBackends)+1 {
+				t.Fatalf("available = %q of %d, want %q of %d", available, len(candidates), tc.available, len(systemBackends)+1)
+			}
+			if got := chosenBackend(ClipboardAuto, candidates); got != tc.chosen {
+				t.Errorf("chosen = %q, want %q", got, tc.chosen)
+			}
+		})
+	}
+
+	candidates := DiscoverClipboard(ClipboardEnv{Display: ":0"})
+	xclip := candidates[slices.IndexFunc(candidates, func(c ClipboardCandidate) bool { return c.Name == "xclip" })]
+	if xclip.Available || xclip.Detail != "xclip is not on PATH" {
+		t.Errorf("xclip = %v, %q, want it ruled out for not being on PATH", xclip.Available, xclip.Detail)
+	}
+	if got := chosenBackend(ClipboardOSC52, candidates); got != "osc52" {
+		t.Errorf("chosen with the osc52 backend = %q", got)
+	}
+}
+
+func TestDiagnoseClipboard(t *testing.T) {
+	t.Setenv("DISPLAY", startFakeX(t))
+	t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+	candidates := slices.DeleteFunc(DiscoverClipboard(ClipboardEnv{Display: ":0"}), func(c ClipboardCandidate) bool {
+		return c.Backend == ClipboardOSC52
+	})
+
+	checks := diagnose(ClipboardOptions{Backend: ClipboardSystem, Target: TargetBoth}, candidates)
+	x11 := checks[0]
+	if x11.Name != "x11" || !x11.Chosen || x11.Status() != "ok" || x11.Err != nil {
+		t.Fatalf("first check = %s chosen %v status %q, %v; want x11 chosen and ok", x11.Name, x11.Chosen, x11.Status(), x11.Err)
+	}
+	if x11.Copy <= 0 || x11.Read <= 0 || x11.Latency() == "" {
+		t.Errorf("latency = %v, %v", x11.Copy, x11.Read)
+	}
+	for _, c := range checks[1:] {
+		if c.Status() != "unavailable" || c.Latency() != "" {
+			t.Errorf("%s = %q %q, want unavailable and untried", c.Name, c.Status(), c.Latency())
+		}
+	}
+}
+
+// sharedStub is a display server of its own: every tool newTool makes
+// sees the same selections, and copies to a failing one are refused.
+type sharedStub struct {
+	sels    [2]string
+	failing selection
+	tools   int
+	closed  int
+}
+
+type sharedStubTool struct {
+	*sharedStub
+}
+
+func (s *sharedStub) newTool() clipboardTool {
+	s.tools++
+	return sharedStubTool{s}
+}
+
+func (t sharedStubTool) Name() string { return "stub" }
+
+func (t sharedStubTool) Copy(ctx context.Context, which selection, text string) error {
+	if which == t.failing {
+		return errStubA
+	}
+	t.sels[which] = text
+	return nil
+}
+
+func (t sharedStubTool) Read(ctx context.Context, which selection) (string, error) {
+	return t.sels[which], nil
+}
+
+func (t sharedStubTool) close() { t.closed++ }
+
+func TestDiagnoseEverySelection(t *testing.T) {
+	stub := &sharedStub{failing: selPrimary}
+	candidate := ClipboardCandidate{Name: "stub", Backend: ClipboardSystem, Available: true, newTool: stub.newTool}
+
+	check := diagnose(ClipboardOptions{Backend: ClipboardSystem, Target: TargetBoth}, []ClipboardCandidate{candidate})[0]
+	if check.Status() != "failed" || !errors.Is(check.Err, errStubA) {
+		t.Fatalf("check = %q, %v; want the failed primary selection reported", check.Status(), check.Err)
+	}
+	if stub.closed != stub.tools {
+		t.Fatalf("closed %d of the %d tools the probe opened", stub.closed, stub.tools)
+	}
+
+	stub.failing = -1
+	if check := diagnose(ClipboardOptions{Backend: ClipboardSystem, Target: TargetBoth}, []ClipboardCandidate{candidate})[0]; check.Status() != "ok" {
+		t.Fatalf("check = %q, %v; want ok", check.Status(), check.Err)
+	}
+}
+
+func TestNewClipboardManagerOptions(t *testing.T) {
+	opts := ClipboardOptions{Target: TargetBoth, Timeout: 5 * time.Second, ClearAfter: time.Minute, OSC52Limit: 10}
+
+	opts.Backend = ClipboardSystem
+	system, ok := NewClipboardManager(opts).(*LinuxClipboardManager)
+	if !ok || system.target != opts.Target || system.timeout != opts.Timeout || system.clearAfter != opts.ClearAfter {
+		t.Fatalf("system manager = %+v, want the options' target, timeout and clear delay", system)
+	}
+
+	opts.Backend = ClipboardOSC52
+	osc52, ok := NewClipboardManager(opts).(*OSC52ClipboardManager)
+	if !ok || osc52.target != opts.Target || osc52.limit != opts.OSC52Limit {
+		t.Fatalf("OSC 52 manager = %+v, want the options' target and limit", osc52)
+	}
+}
+
+var (
+	errStubA = errors.New("stub a failed")
+	errStubB = errors.New("stub b failed")
+)
+
+type stubTool struct {
+	name string
+	err  error
+}
+
+func (s *stubTool) Name() string { return s.name }
+
+func (s *stubTool) Copy(ctx context.Context, which selection, text string) error { return s.err }
+
+func (s *stubTool) Read(ctx context.Context, which selection) (string, error) { return "", s.err }
+
+func TestCopyReportsEveryTool(t *testing.T) {
+	a, b := &stubTool{name: "a", err: errStubA}, &stubTool{name: "b", err: errStubB}
+	m := &LinuxClipboardManager{tools: []clipboardTool{a, b}, target: TargetClipboard, timeout: time.Second, results: make(chan ClearResult, 1)}
+
+	err := m.Copy("text")
+	for _, want := range []error{ErrClipboardFailed, errStubA, errStubB} {
+		if !errors.Is(err, want) {
+			t.Errorf("Copy = %v, want it to wrap %v", err, want)
+		}
+	}
+
+	b.err = nil
+	if err := m.Copy("text"); err != nil {
+		t.Fatal(err)
+	}
+	if first := m.ordered(selClipboard)[0]; first != b {
+		t.Errorf("first tool after b worked = %s, want b", first.Name())
+	}
+	if first := m.ordered(selPrimary)[0]; first != a {
+		t.Errorf("first primary tool = %s, want the discovery order", first.Name())
+	}
+	if _, err := (&LinuxClipboardManager{target: TargetClipboard, timeout: time.Second}).Read(); !errors.Is(err, ErrNoClipboardTool) {
+		t.Errorf("Read without tools = %v, want %v", err, ErrNoClipboardTool)
+	}
+}
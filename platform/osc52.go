@@ -0,0 +1,265 @@
+package platform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"golang.org/x/term"
+)
+
+const DefaultOSC52Limit = 100000
+
+var (
+	OSC52QueryTimeout = 500 * time.Millisecond
+	ErrClipboardLimit = errors.New("text exceeds the terminal clipboard limit")
+)
+
+type ClipboardBackend string
+
+const (
+	ClipboardAuto   ClipboardBackend = "auto"
+	ClipboardSystem ClipboardBackend = "system"
+	ClipboardOSC52  ClipboardBackend = "osc52"
+
+	ClipboardBackendEnv    = "ENC_CLIPBOARD"
+	ClipboardClearAfterEnv = "ENC_CLIPBOARD_CLEAR"
+	ClipboardTargetEnv     = "ENC_CLIPBOARD_TARGET"
+)
+
+// ClipboardTarget names the selections copied text goes to: the CLIPBOARD
+// that Ctrl+V pastes, the PRIMARY selection that middle-click pastes, or
+// both. Outside X11 and Wayland only the terminal's OSC 52 selections
+// exist, and they follow the same choice.
+type ClipboardTarget string
+
+const (
+	TargetClipboard ClipboardTarget = "clipboard"
+	TargetPrimary   ClipboardTarget = "primary"
+	TargetBoth      ClipboardTarget = "both"
+)
+
+func ClipboardTargetFromEnv() ClipboardTarget {
+	switch target := ClipboardTarget(os.Getenv(ClipboardTargetEnv)); target {
+	case TargetPrimary, TargetBoth:
+		return target
+	default:
+		return TargetClipboard
+	}
+}
+
+// Label describes the target for messages such as "copied to ...".
+func (t ClipboardTarget) Label() string {
+	switch t {
+	case TargetPrimary:
+		return "primary selection"
+	case TargetBoth:
+		return "clipboard and primary selection"
+	default:
+		return "clipboard"
+	}
+}
+
+// selections lists the selections t covers, the one reads come from first.
+func (t ClipboardTarget) selections() []selection {
+	switch t {
+	case TargetPrimary:
+		return []selection{selPrimary}
+	case TargetBoth:
+		return []selection{selClipboard, selPrimary}
+	default:
+		return []selection{selClipboard}
+	}
+}
+
+func (t ClipboardTarget) has(which selection) bool {
+	return slices.Contains(t.selections(), which)
+}
+
+func ClipboardBackendFromEnv() ClipboardBackend {
+	switch backend := ClipboardBackend(os.Getenv(ClipboardBackendEnv)); backend {
+	case ClipboardSystem, ClipboardOSC52:
+		return backend
+	default:
+		return ClipboardAuto
+	}
+}
+
+type ClipboardOptions struct {
+	Backend    ClipboardBackend
+	Target     ClipboardTarget
+	Timeout    time.Duration
+	ClearAfter time.Duration
+	OSC52Limit int
+}
+
+func DefaultClipboardOptions() ClipboardOptions {
+	return ClipboardOptions{
+		Backend:    ClipboardAuto,
+		Target:     TargetClipboard,
+		Timeout:    DefaultClipboardTimeout,
+		ClearAfter: DefaultClipboardClearAfter,
+		OSC52Limit: DefaultOSC52Limit,
+	}
+}
+
+func NewClipboardManager(opts ClipboardOptions) ClipboardManager {
+	backend := opts.Backend
+	if backend == ClipboardAuto || backend == "" {
+		backend = ClipboardOSC52
+		if chosenBackend(ClipboardAuto, discoverClipboard()) != "osc52" {
+			backend = ClipboardSystem
+		}
+	}
+
+	if backend == ClipboardOSC52 {
+		return NewOSC52ClipboardManager(opts)
+	}
+	return NewLinuxClipboardManager(opts)
+}
+
+func HasDisplayServer() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("DISPLAY") != ""
+}
+
+type OSC52ClipboardManager struct {
+	ttyPath string
+	mode    osc52.Mode
+	limit   int
+	target  ClipboardTarget
+	timeout time.Duration
+}
+
+// NewOSC52ClipboardManager writes to the terminal on /dev/tty, limited to
+// opts.OSC52Limit bytes, and ignores the options that concern the system
+// clipboard.
+func NewOSC52ClipboardManager(opts ClipboardOptions) *OSC52ClipboardManager {
+	return &OSC52ClipboardManager{
+		ttyPath: "/dev/tty",
+		mode:    detectOSC52Mode(),
+		limit:   opts.OSC52Limit,
+		target:  opts.Target,
+		timeout: OSC52QueryTimeout,
+	}
+}
+
+func detectOSC52Mode() osc52.Mode {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return osc52.TmuxMode
+	case os.Getenv("STY") != "", strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		return osc52.ScreenMode
+	default:
+		return osc52.DefaultMode
+	}
+}
+
+func (m *OSC52ClipboardManager) Copy(text string) error {
+	if m.limit > 0 && len(text) > m.limit {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrClipboardLimit, len(text), m.limit)
+	}
+
+	tty, err := os.OpenFile(m.ttyPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoClipboardTool, err)
+	}
+	defer tty.Close()
+
+	for _, which := range m.target.selections() {
+		seq := osc52.New(text)
+		if text == "" {
+			seq = seq.Clear()
+		}
+		if _, err := osc52Selection(seq, which).Mode(m.mode).WriteTo(tty); err != nil {
+			return fmt.Errorf("%w: %v", ErrClipboardFailed, err)
+		}
+	}
+
+	return nil
+}
+
+func osc52Selection(seq osc52.Sequence, which selection) osc52.Sequence {
+	if which == selPrimary {
+		return seq.Primary()
+	}
+	return seq
+}
+
+func (m *OSC52ClipboardManager) Read() (string, error) {
+	tty, err := os.OpenFile(m.ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoClipboardTool, err)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoClipboardTool, err)
+	}
+	defer term.Restore(fd, state)
+
+	if _, err := osc52Selection(osc52.Query(), m.target.selections()[0]).Mode(m.mode).WriteTo(tty); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrClipboardFailed, err)
+	}
+
+	reply, err := m.readReply(tty)
+	if err != nil {
+		return "", err
+	}
+
+	return parseOSC52Reply(reply)
+}
+
+func (m *OSC52ClipboardManager) readReply(tty *os.File) ([]byte, error) {
+	if err := tty.SetReadDeadline(time.Now().Add(m.timeout)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoClipboardTool, err)
+	}
+
+	var reply []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := tty.Read(buf)
+		reply = append(reply, buf[:n]...)
+
+		if end := osc52ReplyEnd(reply); end >= 0 {
+			return reply[:end], nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: terminal did not answer the OSC 52 query", ErrNoClipboardTool)
+		}
+	}
+}
+
+func osc52ReplyEnd(reply []byte) int {
+	if i := bytes.IndexByte(reply, '\a'); i >= 0 {
+		return i
+	}
+	return bytes.Index(reply, []byte("\x1b\\"))
+}
+
+func parseOSC52Reply(reply []byte) (string, error) {
+	start := bytes.Index(reply, []byte("\x1b]52;"))
+	if start < 0 {
+		return "", fmt.Errorf("%w: unexpected OSC 52 reply", ErrNoClipboardTool)
+	}
+
+	body := reply[start+len("\x1b]52;"):]
+	sep := bytes.IndexByte(body, ';')
+	if sep < 0 {
+		return "", fmt.Errorf("%w: unexpected OSC 52 reply", ErrNoClipboardTool)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(body[sep+1:]))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrClipboardFailed, err)
+	}
+
+	return string(data), nil
+}
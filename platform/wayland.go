@@ -0,0 +1,672 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// The Wayland backend uses the data-control protocol, in its standard
+// ext_data_control_v1 form or the older wlr one, which lets a client
+// without a surface own and read the selection. The primary selection
+// needs ext_data_control_v1 or version 2 of the wlr protocol. GNOME
+// offers neither, but its XWayland bridges the clipboard for the X11
+// backend.
+
+var ErrNoDataControl = errors.New("compositor does not offer data-control")
+
+const (
+	wlDisplayID = 1
+
+	wlDisplaySync        = 0
+	wlDisplayGetRegistry = 1
+	wlRegistryBind       = 0
+
+	wlDisplayError    = 0
+	wlRegistryGlobal  = 0
+	wlCallbackDone    = 0
+	wlManagerSource   = 0
+	wlManagerDevice   = 1
+	wlDeviceSelection = 0
+	wlDevicePrimary   = 2
+	wlSourceOffer     = 0
+	wlSourceDestroy   = 1
+	wlOfferReceive    = 0
+	wlOfferDestroy    = 1
+
+	wlEventDataOffer = 0
+	wlEventSelection = 1
+	wlEventFinished  = 2
+	wlEventPrimary   = 3
+	wlEventSend      = 0
+	wlEventCancelled = 1
+	wlEventOffer     = 0
+)
+
+// wlDataControl lists the data-control managers in order of preference.
+var wlDataControl = []string{"ext_data_control_manager_v1", "zwlr_data_control_manager_v1"}
+
+var wlTextTypes = []string{"text/plain;charset=utf-8", "UTF8_STRING", "text/plain", "STRING", "TEXT"}
+
+// wlSetSelection holds the data device request that sets each selection.
+var wlSetSelection = [...]uint16{selClipboard: wlDeviceSelection, selPrimary: wlDevicePrimary}
+
+type wlKind int
+
+const (
+	wlRegistry wlKind = iota + 1
+	wlCallback
+	wlSeat
+	wlManager
+	wlDevice
+	wlSource
+	wlOffer
+)
+
+type wlGlobal struct {
+	name    uint32
+	iface   string
+	version uint32
+}
+
+// wlConn is a connection to a Wayland compositor. Events are passed to
+// handle on the reading goroutine, with any file descriptors they carry.
+type wlConn struct {
+	conn *net.UnixConn
+
+	mu     sync.Mutex
+	nextID uint32
+
+	handle func(c *wlConn, object uint32, opcode uint16, args []byte, fds *[]int)
+	closed chan struct{}
+	err    error
+}
+
+func waylandSocket() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		return "", ErrNoDisplay
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("%w: XDG_RUNTIME_DIR is not set", ErrNoDisplay)
+	}
+	return filepath.Join(dir, display), nil
+}
+
+func dialWayland(ctx context.Context, handle func(*wlConn, uint32, uint16, []byte, *[]int)) (*wlConn, error) {
+	path, err := waylandSocket()
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &wlConn{conn: conn.(*net.UnixConn), nextID: wlDisplayID, handle: handle, closed: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *wlConn) newID() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return c.nextID
+}
+
+// send writes one request; fd, when not negative, travels with it.
+func (c *wlConn) send(object uint32, opcode uint16, args wlArgs, fd int) error {
+	msg := le.AppendUint32(nil, object)
+	msg = le.AppendUint32(msg, uint32(8+len(args))<<16|uint32(opcode))
+	msg = append(msg, args...)
+
+	var oob []byte
+	if fd >= 0 {
+		oob = syscall.UnixRights(fd)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, _, err := c.conn.WriteMsgUnix(msg, oob, nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrClipboardFailed, err)
+	}
+	return nil
+}
+
+func (c *wlConn) readLoop() {
+	var buf, pending []byte
+	var fds []int
+	buf = make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(28*4))
+
+	for {
+		n, oobn, _, _, err := c.conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			c.close(fmt.Errorf("%w: connection to the compositor lost: %v", ErrClipboardFailed, err))
+			break
+		}
+		if msgs, err := syscall.ParseSocketControlMessage(oob[:oobn]); err == nil {
+			for _, msg := range msgs {
+				if rights, err := syscall.ParseUnixRights(&msg); err == nil {
+					fds = append(fds, rights...)
+				}
+			}
+		}
+
+		pending = append(pending, buf[:n]...)
+		for len(pending) >= 8 {
+			size := int(le.Uint32(pending[4:]) >> 16)
+			if size < 8 {
+				c.close(fmt.Errorf("%w: malformed message from the compositor", ErrClipboardFailed))
+				break
+			}
+			if len(pending) < size {
+				break
+			}
+			c.handle(c, le.Uint32(pending), uint16(le.Uint32(pending[4:])), pending[8:size], &fds)
+			pending = pending[size:]
+		}
+	}
+
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+func (c *wlConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	c.err = err
+	close(c.closed)
+	c.conn.Close()
+}
+
+func (c *wlConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+type wlArgs []byte
+
+func (a wlArgs) uint(v uint32) wlArgs {
+	return le.AppendUint32(a, v)
+}
+
+func (a wlArgs) string(s string) wlArgs {
+	a = le.AppendUint32(a, uint32(len(s)+1))
+	return pad4(append(append(a, s...), 0))
+}
+
+// wlReader takes event arguments apart; a short message leaves it failed
+// with zero values.
+type wlReader struct {
+	b   []byte
+	bad bool
+}
+
+func (r *wlReader) uint() uint32 {
+	if len(r.b) < 4 {
+		r.bad = true
+		return 0
+	}
+	v := le.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *wlReader) string() string {
+	n := int(r.uint())
+	padded := (n + 3) &^ 3
+	if n == 0 || len(r.b) < padded {
+		r.bad = n != 0
+		return ""
+	}
+	s := string(r.b[:n-1])
+	r.b = r.b[padded:]
+	return s
+}
+
+// waylandClipboard owns the selections through data-control sources and
+// writes the copied text to whichever client asks for it.
+type waylandClipboard struct {
+	mu sync.Mutex // serializes Copy, Read and release
+
+	state     sync.Mutex // guards everything below
+	conn      *wlConn
+	objects   map[uint32]wlKind
+	globals   []wlGlobal
+	callbacks map[uint32]chan struct{}
+	device    uint32
+	manager   uint32
+	primary   bool
+	offers    map[uint32][]string
+	offer     [2]uint32
+	source    [2]uint32
+	sels      [2]*ownedSelection
+}
+
+func newWaylandClipboard() *waylandClipboard {
+	return &waylandClipboard{}
+}
+
+func (c *waylandClipboard) Name() string {
+	return "wayland"
+}
+
+func (c *waylandClipboard) connect(ctx context.Context) (*wlConn, error) {
+	c.state.Lock()
+	conn := c.conn
+	c.state.Unlock()
+	if conn != nil && !conn.isClosed() {
+		return conn, nil
+	}
+
+	c.state.Lock()
+	c.objects = make(map[uint32]wlKind)
+	c.callbacks = make(map[uint32]chan struct{})
+	c.offers = make(map[uint32][]string)
+	c.globals, c.offer, c.source = nil, [2]uint32{}, [2]uint32{}
+	c.state.Unlock()
+
+	conn, err := dialWayland(ctx, c.handleEvent)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-conn.closed
+		c.state.Lock()
+		defer c.state.Unlock()
+		if c.conn != conn {
+			return
+		}
+		for which, sel := range c.sels {
+			if sel != nil {
+				sel.lose(conn.err)
+				c.sels[which] = nil
+			}
+		}
+	}()
+	if err := c.bind(ctx, conn); err != nil {
+		conn.close(err)
+		return nil, err
+	}
+
+	c.state.Lock()
+	c.conn = conn
+	c.state.Unlock()
+	return conn, nil
+}
+
+func (c *waylandClipboard) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Lock()
+	conn := c.conn
+	c.state.Unlock()
+	if conn != nil {
+		conn.close(errToolClosed)
+	}
+}
+
+// bind finds the seat and a data-control manager and gets the seat's data
+// device, which reports the current selection right away.
+func (c *waylandClipboard) bind(ctx context.Context, conn *wlConn) error {
+	registry := c.create(conn, wlRegistry)
+	if err := conn.send(wlDisplayID, wlDisplayGetRegistry, wlArgs{}.uint(registry), -1); err != nil {
+		return err
+	}
+	if err := c.sync(ctx, conn); err != nil {
+		return err
+	}
+
+	c.state.Lock()
+	globals := c.globals
+	c.state.Unlock()
+	var seat, manager *wlGlobal
+	for i, g := range globals {
+		if g.iface == "wl_seat" && seat == nil {
+			seat = &globals[i]
+		}
+		if rank := slices.Index(wlDataControl, g.iface); rank >= 0 && (manager == nil || rank < slices.Index(wlDataControl, manager.iface)) {
+			manager = &globals[i]
+		}
+	}
+	if seat == nil || manager == nil {
+		return ErrNoDataControl
+	}
+
+	// Version 2 of the wlr manager adds the primary selection, which the
+	// ext one has from the start.
+	managerVersion := uint32(1)
+	if manager.iface == "zwlr_data_control_manager_v1" {
+		managerVersion = min(manager.version, 2)
+	}
+	seatID, managerID := c.create(conn, wlSeat), c.create(conn, wlManager)
+	for _, b := range []struct {
+		global  *wlGlobal
+		id      uint32
+		version uint32
+	}{{seat, seatID, 1}, {manager, managerID, managerVersion}} {
+		args := wlArgs{}.uint(b.global.name).string(b.global.iface).uint(b.version).uint(b.id)
+		if err := conn.send(registry, wlRegistryBind, args, -1); err != nil {
+			return err
+		}
+	}
+
+	device := c.create(conn, wlDevice)
+	if err := conn.send(managerID, wlManagerDevice, wlArgs{}.uint(device).uint(seatID), -1); err != nil {
+		return err
+	}
+	c.state.Lock()
+	c.manager, c.device = managerID, device
+	c.primary = manager.iface != "zwlr_data_control_manager_v1" || managerVersion >= 2
+	c.state.Unlock()
+	return c.sync(ctx, conn)
+}
+
+func (c *waylandClipboard) create(conn *wlConn, kind wlKind) uint32 {
+	id := conn.newID()
+	c.state.Lock()
+	c.objects[id] = kind
+	c.state.Unlock()
+	return id
+}
+
+// sync waits until the compositor has handled every request sent so far,
+// and the events they caused have been seen.
+func (c *waylandClipboard) sync(ctx context.Context, conn *wlConn) error {
+	id := c.create(conn, wlCallback)
+	done := make(chan struct{})
+	c.state.Lock()
+	c.callbacks[id] = done
+	c.state.Unlock()
+
+	if err := conn.send(wlDisplayID, wlDisplaySync, wlArgs{}.uint(id), -1); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-conn.closed:
+		return conn.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *waylandClipboard) owned(which selection) *ownedSelection {
+	c.state.Lock()
+	defer c.state.Unlock()
+	return c.sels[which]
+}
+
+// supports reports whether the compositor has the selection which.
+func (c *waylandClipboard) supports(which selection) error {
+	c.state.Lock()
+	defer c.state.Unlock()
+	if which == selPrimary && !c.primary {
+		return fmt.Errorf("%w: the compositor has no primary selection for data-control clients", ErrClipboardFailed)
+	}
+	return nil
+}
+
+func (c *waylandClipboard) Copy(ctx context.Context, which selection, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.supports(which); err != nil {
+		return err
+	}
+
+	var source uint32
+	if text != "" {
+		source = c.create(conn, wlSource)
+		if err := conn.send(c.manager, wlManagerSource, wlArgs{}.uint(source), -1); err != nil {
+			return err
+		}
+		for _, mime := range append(wlTextTypes, SensitiveMimeType) {
+			if err := conn.send(source, wlSourceOffer, wlArgs{}.string(mime), -1); err != nil {
+				return err
+			}
+		}
+	}
+	if err := conn.send(c.device, wlSetSelection[which], wlArgs{}.uint(source), -1); err != nil {
+		return err
+	}
+
+	var sel *ownedSelection
+	if text != "" {
+		sel = newOwnedSelection(which, text)
+	}
+	c.replaceSource(conn, which, source, sel)
+	return c.sync(ctx, conn)
+}
+
+// replaceSource makes source the one being served for which, destroying
+// the previous one, whose selection counts as lost.
+func (c *waylandClipboard) replaceSource(conn *wlConn, which selection, source uint32, sel *ownedSelection) {
+	c.state.Lock()
+	old, oldSel := c.source[which], c.sels[which]
+	c.source[which], c.sels[which] = source, sel
+	if old != 0 {
+		delete(c.objects, old)
+	}
+	c.state.Unlock()
+
+	if oldSel != nil {
+		oldSel.lose(nil)
+	}
+	if old != 0 {
+		conn.send(old, wlSourceDestroy, nil, -1)
+	}
+}
+
+func (c *waylandClipboard) release(ctx context.Context, sel *ownedSelection) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Lock()
+	conn, current := c.conn, c.sels[sel.which]
+	c.state.Unlock()
+	if current != sel || sel.isLost() {
+		return false, nil
+	}
+
+	c.replaceSource(conn, sel.which, 0, nil)
+	if err := conn.send(c.device, wlSetSelection[sel.which], wlArgs{}.uint(0), -1); err != nil {
+		return true, err
+	}
+	return true, c.sync(ctx, conn)
+}
+
+func (c *waylandClipboard) Read(ctx context.Context, which selection) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sel := c.owned(which); sel != nil && !sel.isLost() {
+		return sel.text, nil
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := c.supports(which); err != nil {
+		return "", err
+	}
+	if err := c.sync(ctx, conn); err != nil {
+		return "", err
+	}
+
+	c.state.Lock()
+	offer := c.offer[which]
+	mimes := c.offers[offer]
+	c.state.Unlock()
+	if offer == 0 {
+		return "", nil
+	}
+	i := slices.IndexFunc(wlTextTypes, func(mime string) bool { return slices.Contains(mimes, mime) })
+	if i < 0 {
+		return "", fmt.Errorf("%w: the %s holds no text", ErrClipboardFailed, which)
+	}
+
+	return c.receive(ctx, conn, offer, wlTextTypes[i])
+}
+
+// receive reads offer as the MIME type mime.
+func (c *waylandClipboard) receive(ctx context.Context, conn *wlConn, offer uint32, mime string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	err = conn.send(offer, wlOfferReceive, wlArgs{}.string(mime), int(w.Fd()))
+	w.Close()
+	if err != nil {
+		return "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		r.SetReadDeadline(deadline)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrClipboardFailed, err)
+	}
+	return string(data), nil
+}
+
+func (c *waylandClipboard) handleEvent(conn *wlConn, object uint32, opcode uint16, args []byte, fds *[]int) {
+	r := &wlReader{b: args}
+
+	c.state.Lock()
+	kind := c.objects[object]
+	c.state.Unlock()
+	if object == wlDisplayID && opcode == wlDisplayError {
+		id, code, message := r.uint(), r.uint(), r.string()
+		conn.close(fmt.Errorf("%w: compositor error %d on object %d: %s", ErrClipboardFailed, code, id, message))
+		return
+	}
+
+	switch {
+	case kind == wlRegistry && opcode == wlRegistryGlobal:
+		g := wlGlobal{name: r.uint(), iface: r.string(), version: r.uint()}
+		if !r.bad {
+			c.state.Lock()
+			c.globals = append(c.globals, g)
+			c.state.Unlock()
+		}
+
+	case kind == wlCallback && opcode == wlCallbackDone:
+		c.state.Lock()
+		done := c.callbacks[object]
+		delete(c.callbacks, object)
+		delete(c.objects, object)
+		c.state.Unlock()
+		if done != nil {
+			close(done)
+		}
+
+	case kind == wlDevice && opcode == wlEventDataOffer:
+		id := r.uint()
+		c.state.Lock()
+		c.objects[id] = wlOffer
+		c.offers[id] = nil
+		c.state.Unlock()
+
+	case kind == wlDevice && opcode == wlEventSelection:
+		c.setOffer(conn, selClipboard, r.uint())
+
+	case kind == wlDevice && opcode == wlEventPrimary:
+		c.setOffer(conn, selPrimary, r.uint())
+
+	case kind == wlDevice && opcode == wlEventFinished:
+		conn.close(fmt.Errorf("%w: the compositor withdrew the data device", ErrClipboardFailed))
+
+	case kind == wlOffer && opcode == wlEventOffer:
+		mime := r.string()
+		c.state.Lock()
+		c.offers[object] = append(c.offers[object], mime)
+		c.state.Unlock()
+
+	case kind == wlSource && opcode == wlEventSend:
+		mime := r.string()
+		if len(*fds) == 0 {
+			conn.close(fmt.Errorf("%w: send event without a file descriptor", ErrClipboardFailed))
+			return
+		}
+		fd := (*fds)[0]
+		*fds = (*fds)[1:]
+		c.serve(object, mime, os.NewFile(uintptr(fd), "selection"))
+
+	case kind == wlSource && opcode == wlEventCancelled:
+		c.state.Lock()
+		which := slices.Index(c.source[:], object)
+		c.state.Unlock()
+		if which >= 0 {
+			c.replaceSource(conn, selection(which), 0, nil)
+		}
+	}
+}
+
+// setOffer records the offer now holding which, destroying the one it
+// replaces.
+func (c *waylandClipboard) setOffer(conn *wlConn, which selection, id uint32) {
+	c.state.Lock()
+	old := c.offer[which]
+	c.offer[which] = id
+	stale := old != 0 && old != id && !slices.Contains(c.offer[:], old)
+	if stale {
+		delete(c.objects, old)
+		delete(c.offers, old)
+	}
+	c.state.Unlock()
+	if stale {
+		conn.send(old, wlOfferDestroy, nil, -1)
+	}
+}
+
+// serve writes the text of source, or the sensitivity hint, to a client
+// that pasted it. The write may block until the client reads, so it runs
+// on its own goroutine.
+func (c *waylandClipboard) serve(source uint32, mime string, f *os.File) {
+	c.state.Lock()
+	var text string
+	if which := slices.Index(c.source[:], source); which >= 0 && c.sels[which] != nil {
+		text = c.sels[which].text
+	}
+	c.state.Unlock()
+	if mime == SensitiveMimeType && text != "" {
+		text = SensitiveMimeValue
+	}
+
+	go func() {
+		defer f.Close()
+		io.WriteString(f, text)
+	}()
+}
@@ -0,0 +1,295 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeCompositor is a stand-in Wayland compositor with a seat and,
+// optionally, one data-control manager. It implements the registry and
+// the data-control selections, and nothing that needs a surface.
+type fakeCompositor struct {
+	manager string
+	version uint32
+
+	mu        sync.Mutex
+	selection [2]*fakeWlSource
+	devices   []fakeWlObject
+	nextOffer uint32
+}
+
+type fakeWlClient struct {
+	mu      sync.Mutex
+	conn    *net.UnixConn
+	version uint32
+	kinds   map[uint32]string
+	sources map[uint32]*fakeWlSource
+	offers  map[uint32]*fakeWlSource
+}
+
+type fakeWlObject struct {
+	client *fakeWlClient
+	id     uint32
+}
+
+type fakeWlSource struct {
+	fakeWlObject
+	mimes []string
+}
+
+func startFakeCompositor(t *testing.T, manager string, version uint32) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wayland-0")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	t.Setenv("WAYLAND_DISPLAY", path)
+
+	s := &fakeCompositor{manager: manager, version: version, nextOffer: 0xff000000}
+	go func() {
+		for {
+			conn, err := ln.AcceptUnix()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *fakeCompositor) serve(conn *net.UnixConn) {
+	c := &fakeWlClient{
+		conn:    conn,
+		kinds:   map[uint32]string{wlDisplayID: "wl_display"},
+		sources: make(map[uint32]*fakeWlSource),
+		offers:  make(map[uint32]*fakeWlSource),
+	}
+	defer s.disconnect(c)
+	defer conn.Close()
+
+	var pending []byte
+	var fds []int
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(4*4))
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+		msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+		for _, msg := range msgs {
+			rights, _ := syscall.ParseUnixRights(&msg)
+			fds = append(fds, rights...)
+		}
+
+		pending = append(pending, buf[:n]...)
+		for len(pending) >= 8 && len(pending) >= int(le.Uint32(pending[4:])>>16) {
+			size := int(le.Uint32(pending[4:]) >> 16)
+			s.handle(c, le.Uint32(pending), uint16(le.Uint32(pending[4:])), &wlReader{b: pending[8:size]}, &fds)
+			pending = pending[size:]
+		}
+	}
+}
+
+func (s *fakeCompositor) handle(c *fakeWlClient, object uint32, opcode uint16, r *wlReader, fds *[]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch kind := c.kinds[object]; {
+	case kind == "wl_display" && opcode == wlDisplayGetRegistry:
+		registry := r.uint()
+		c.kinds[registry] = "wl_registry"
+		c.send(registry, wlRegistryGlobal, wlArgs{}.uint(1).string("wl_seat").uint(7), -1)
+		if s.manager != "" {
+			c.send(registry, wlRegistryGlobal, wlArgs{}.uint(2).string(s.manager).uint(s.version), -1)
+		}
+	case kind == "wl_display" && opcode == wlDisplaySync:
+		callback := r.uint()
+		c.send(callback, wlCallbackDone, wlArgs{}.uint(0), -1)
+	case kind == "wl_registry" && opcode == wlRegistryBind:
+		r.uint()
+		iface := r.string()
+		version := r.uint()
+		if iface == s.manager {
+			c.version = version
+		}
+		c.kinds[r.uint()] = iface
+	case kind == s.manager && opcode == wlManagerSource:
+		id := r.uint()
+		c.kinds[id] = "source"
+		c.sources[id] = &fakeWlSource{fakeWlObject: fakeWlObject{c, id}}
+	case kind == s.manager && opcode == wlManagerDevice:
+		device := fakeWlObject{c, r.uint()}
+		c.kinds[device.id] = "device"
+		s.devices = append(s.devices, device)
+		s.announce(device)
+	case kind == "source" && opcode == wlSourceOffer:
+		c.sources[object].mimes = append(c.sources[object].mimes, r.string())
+	case kind == "source" && opcode == wlSourceDestroy:
+		for which, source := range s.selection {
+			if source == c.sources[object] {
+				s.setSelection(selection(which), nil)
+			}
+		}
+		delete(c.sources, object)
+	case kind == "device" && opcode == wlDeviceSelection:
+		s.setSelection(selClipboard, c.sources[r.uint()])
+	case kind == "device" && opcode == wlDevicePrimary:
+		s.setSelection(selPrimary, c.sources[r.uint()])
+	case kind == "offer" && opcode == wlOfferReceive:
+		mime := r.string()
+		fd := (*fds)[0]
+		*fds = (*fds)[1:]
+		if source := c.offers[object]; source != nil && slices.Contains(s.selection[:], source) {
+			source.client.send(source.id, wlEventSend, wlArgs{}.string(mime), fd)
+		}
+		syscall.Close(fd)
+	case kind == "offer" && opcode == wlOfferDestroy:
+		delete(c.offers, object)
+	}
+}
+
+// setSelection cancels the previous source and tells every device.
+func (s *fakeCompositor) setSelection(which selection, source *fakeWlSource) {
+	if old := s.selection[which]; old != nil && old != source {
+		old.client.send(old.id, wlEventCancelled, nil, -1)
+	}
+	s.selection[which] = source
+	for _, device := range s.devices {
+		s.announceSelection(device, which)
+	}
+}
+
+func (s *fakeCompositor) announce(device fakeWlObject) {
+	s.announceSelection(device, selClipboard)
+	s.announceSelection(device, selPrimary)
+}
+
+// announceSelection sends a fresh offer for which, skipping the primary
+// selection for clients of a wlr manager older than version 2.
+func (s *fakeCompositor) announceSelection(device fakeWlObject, which selection) {
+	c := device.client
+	event := uint16(wlEventSelection)
+	if which == selPrimary {
+		if s.manager == "zwlr_data_control_manager_v1" && c.version < 2 {
+			return
+		}
+		event = wlEventPrimary
+	}
+
+	source := s.selection[which]
+	if source == nil {
+		c.send(device.id, event, wlArgs{}.uint(0), -1)
+		return
+	}
+	s.nextOffer++
+	offer := s.nextOffer
+	c.kinds[offer] = "offer"
+	c.offers[offer] = source
+	c.send(device.id, wlEventDataOffer, wlArgs{}.uint(offer), -1)
+	for _, mime := range source.mimes {
+		c.send(offer, wlEventOffer, wlArgs{}.string(mime), -1)
+	}
+	c.send(device.id, event, wlArgs{}.uint(offer), -1)
+}
+
+func (s *fakeCompositor) disconnect(c *fakeWlClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var devices []fakeWlObject
+	for _, device := range s.devices {
+		if device.client != c {
+			devices = append(devices, device)
+		}
+	}
+	s.devices = devices
+	for which, source := range s.selection {
+		if source != nil && source.client == c {
+			s.setSelection(selection(which), nil)
+		}
+	}
+}
+
+func (c *fakeWlClient) send(object uint32, opcode uint16, args wlArgs, fd int) {
+	msg := le.AppendUint32(nil, object)
+	msg = le.AppendUint32(msg, uint32(8+len(args))<<16|uint32(opcode))
+	msg = append(msg, args...)
+	var oob []byte
+	if fd >= 0 {
+		oob = syscall.UnixRights(fd)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.WriteMsgUnix(msg, oob, nil)
+}
+
+func TestWaylandClipboard(t *testing.T) {
+	versions := map[string]uint32{"ext_data_control_manager_v1": 1, "zwlr_data_control_manager_v1": 2}
+	for _, manager := range wlDataControl {
+		t.Run(manager, func(t *testing.T) {
+			startFakeCompositor(t, manager, versions[manager])
+			testSelectionOwners(t, newWaylandClipboard(), newWaylandClipboard())
+		})
+	}
+}
+
+func TestWaylandSensitiveHint(t *testing.T) {
+	startFakeCompositor(t, "ext_data_control_manager_v1", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a, b := newWaylandClipboard(), newWaylandClipboard()
+	if err := a.Copy(ctx, selClipboard, "secret text"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := b.connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.sync(ctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	b.state.Lock()
+	offer := b.offer[selClipboard]
+	mimes := b.offers[offer]
+	b.state.Unlock()
+	if !slices.Contains(mimes, "text/plain;charset=utf-8") || !slices.Contains(mimes, SensitiveMimeType) {
+		t.Fatalf("offered types %q, want text/plain;charset=utf-8 and %s", mimes, SensitiveMimeType)
+	}
+	if hint, err := b.receive(ctx, conn, offer, SensitiveMimeType); err != nil || hint != SensitiveMimeValue {
+		t.Fatalf("%s = %q, %v, want %q", SensitiveMimeType, hint, err, SensitiveMimeValue)
+	}
+}
+
+func TestWaylandWithoutPrimary(t *testing.T) {
+	startFakeCompositor(t, "zwlr_data_control_manager_v1", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := newWaylandClipboard()
+	if err := c.Copy(ctx, selPrimary, "text"); !errors.Is(err, ErrClipboardFailed) {
+		t.Fatalf("Copy to the primary selection = %v, want %v", err, ErrClipboardFailed)
+	}
+	if err := c.Copy(ctx, selClipboard, "text"); err != nil {
+		t.Fatalf("Copy to the clipboard = %v", err)
+	}
+}
+
+func TestWaylandWithoutDataControl(t *testing.T) {
+	startFakeCompositor(t, "", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := newWaylandClipboard().Copy(ctx, selClipboard, "text"); !errors.Is(err, ErrNoDataControl) {
+		t.Fatalf("Copy = %v, want %v", err, ErrNoDataControl)
+	}
+}
@@ -0,0 +1,648 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The X11 backend speaks just enough of the core protocol to own the
+// CLIPBOARD and PRIMARY selections and to convert them, as ICCCM section
+// 2 describes. Incremental (INCR) transfers are not supported in either
+// direction; ciphertext is far below the size at which they start.
+
+var ErrNoDisplay = errors.New("no display server")
+
+const (
+	x11None          = 0
+	x11CurrentTime   = 0
+	x11AnyProperty   = 0
+	x11AtomAtom      = 4
+	x11AtomString    = 31
+	x11ClassInput    = 2
+	x11FamilyLocal   = 256
+	x11FamilyWild    = 65535
+	x11CookieName    = "MIT-MAGIC-COOKIE-1"
+	x11PropertyName  = "TXT_ENCDEC_SELECTION"
+	x11RequestHeader = 24
+
+	x11OpCreateWindow       = 1
+	x11OpInternAtom         = 16
+	x11OpChangeProperty     = 18
+	x11OpGetProperty        = 20
+	x11OpSetSelectionOwner  = 22
+	x11OpGetSelectionOwner  = 23
+	x11OpConvertSelection   = 24
+	x11OpSendEvent          = 25
+	x11EventSelectionClear  = 29
+	x11EventSelectionReq    = 30
+	x11EventSelectionNotify = 31
+)
+
+var x11AtomNames = []string{"CLIPBOARD", "PRIMARY", "UTF8_STRING", "TARGETS", "TEXT", "INCR", "text/plain;charset=utf-8", "text/plain", SensitiveMimeType, x11PropertyName}
+
+// x11SelectionNames holds the atom name of each selection.
+var x11SelectionNames = [...]string{selClipboard: "CLIPBOARD", selPrimary: "PRIMARY"}
+
+var le = binary.LittleEndian
+
+type x11Reply struct {
+	data []byte
+	err  error
+}
+
+// x11Conn is a connection to an X server with one InputOnly window to own
+// and receive selections with. Replies are matched to requests by sequence
+// number; events go to handle on the reading goroutine.
+type x11Conn struct {
+	conn       net.Conn
+	window     uint32
+	maxRequest int
+	atoms      map[string]uint32
+
+	mu      sync.Mutex
+	seq     uint16
+	pending map[uint16]chan x11Reply
+
+	handle func(conn *x11Conn, event []byte)
+	closed chan struct{}
+	err    error
+}
+
+// x11Address returns where the X server named by display listens, and
+// the display number its cookie is filed under. A display starting with
+// a slash names a socket path, as XQuartz uses.
+func x11Address(display string) (network, address, number string, err error) {
+	colon := strings.LastIndexByte(display, ':')
+	if colon < 0 {
+		return "", "", "", fmt.Errorf("%w: invalid DISPLAY %q", ErrNoDisplay, display)
+	}
+	host := display[:colon]
+	number, _, _ = strings.Cut(display[colon+1:], ".")
+	if _, err := strconv.Atoi(number); err != nil {
+		return "", "", "", fmt.Errorf("%w: invalid DISPLAY %q", ErrNoDisplay, display)
+	}
+
+	switch {
+	case strings.HasPrefix(host, "/"):
+		if _, err := os.Stat(display); err == nil {
+			return "unix", display, number, nil
+		}
+		return "unix", host, number, nil
+	case host == "" || host == "unix":
+		return "unix", "/tmp/.X11-unix/X" + number, number, nil
+	default:
+		n, _ := strconv.Atoi(number)
+		return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), number, nil
+	}
+}
+
+// x11Cookie finds the MIT-MAGIC-COOKIE-1 for a local display in the
+// Xauthority file, or returns nil when there is none.
+func x11Cookie(number string) []byte {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+
+	field := func() []byte {
+		if len(data) < 2 {
+			data = nil
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			data = nil
+			return nil
+		}
+		value := data[2 : 2+n]
+		data = data[2+n:]
+		return value
+	}
+	for len(data) >= 2 {
+		family := binary.BigEndian.Uint16(data)
+		data = data[2:]
+		address, num, name, cookie := field(), field(), field(), field()
+		local := family == x11FamilyWild || family == x11FamilyLocal && string(address) == hostname
+		if local && (len(num) == 0 || string(num) == number) && string(name) == x11CookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func dialX11(ctx context.Context, display string, handle func(*x11Conn, []byte)) (*x11Conn, error) {
+	network, address, number, err := x11Address(display)
+	if err != nil {
+		return nil, err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &x11Conn{conn: conn, pending: make(map[uint16]chan x11Reply), handle: handle, closed: make(chan struct{})}
+	if err := c.setup(x11Cookie(number)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// setup sends the connection setup and reads the server's resource ID
+// range, request size limit and first root window.
+func (c *x11Conn) setup(cookie []byte) error {
+	var name string
+	if cookie != nil {
+		name = x11CookieName
+	}
+	req := []byte{'l', 0}
+	req = le.AppendUint16(req, 11)
+	req = le.AppendUint16(req, 0)
+	req = le.AppendUint16(req, uint16(len(name)))
+	req = le.AppendUint16(req, uint16(len(cookie)))
+	req = append(req, 0, 0)
+	req = pad4(append(req, name...))
+	req = pad4(append(req, cookie...))
+	if _, err := c.conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, head); err != nil {
+		return err
+	}
+	body := make([]byte, 4*int(le.Uint16(head[6:])))
+	if _, err := io.ReadFull(c.conn, body); err != nil {
+		return err
+	}
+	if head[0] != 1 {
+		reason := body
+		if head[0] == 0 {
+			reason = body[:min(int(head[1]), len(body))]
+		}
+		return fmt.Errorf("%w: X server refused the connection: %s", ErrNoDisplay, bytes.TrimRight(reason, "\x00"))
+	}
+	if len(body) < 32 {
+		return fmt.Errorf("%w: short X setup reply", ErrNoDisplay)
+	}
+
+	base, mask := le.Uint32(body[4:]), le.Uint32(body[8:])
+	vendor := int(le.Uint16(body[16:]))
+	c.maxRequest = 4 * int(le.Uint16(body[18:]))
+	screens := 32 + (vendor+3)&^3 + 8*int(body[21])
+	if body[20] == 0 || len(body) < screens+4 {
+		return fmt.Errorf("%w: X server has no screens", ErrNoDisplay)
+	}
+	root := le.Uint32(body[screens:])
+	c.window = base | mask&-mask
+
+	go c.readLoop()
+
+	req = c.request(x11OpCreateWindow, 0, c.window, root)
+	req = le.AppendUint32(req, 0)                         // x, y
+	req = le.AppendUint32(req, 1|1<<16)                   // width, height
+	req = le.AppendUint32(req, uint32(x11ClassInput)<<16) // border width, class
+	req = le.AppendUint32(req, 0)                         // visual: CopyFromParent
+	req = le.AppendUint32(req, 0)                         // no attributes
+	c.send(req, false)
+
+	return c.internAtoms(x11AtomNames)
+}
+
+// internAtoms pipelines one InternAtom request per name.
+func (c *x11Conn) internAtoms(names []string) error {
+	replies := make([]chan x11Reply, len(names))
+	for i, name := range names {
+		req := c.request(x11OpInternAtom, 0, uint32(len(name)))
+		replies[i] = c.send(pad4(append(req, name...)), true)
+	}
+
+	c.atoms = make(map[string]uint32, len(names))
+	for i, name := range names {
+		reply, err := c.wait(context.Background(), replies[i])
+		if err != nil {
+			return err
+		}
+		c.atoms[name] = le.Uint32(reply[8:])
+	}
+	return nil
+}
+
+// request starts a request with fixed 32-bit fields; send fills in the
+// length once the rest has been appended.
+func (c *x11Conn) request(opcode, detail byte, fields ...uint32) []byte {
+	req := []byte{opcode, detail, 0, 0}
+	for _, f := range fields {
+		req = le.AppendUint32(req, f)
+	}
+	return req
+}
+
+func (c *x11Conn) send(req []byte, reply bool) chan x11Reply {
+	req = pad4(req)
+	le.PutUint16(req[2:], uint16(len(req)/4))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	ch := make(chan x11Reply, 1)
+	if reply {
+		c.pending[c.seq] = ch
+	}
+	if _, err := c.conn.Write(req); err != nil {
+		ch <- x11Reply{err: err}
+	}
+	return ch
+}
+
+func (c *x11Conn) wait(ctx context.Context, ch chan x11Reply) ([]byte, error) {
+	select {
+	case reply := <-ch:
+		return reply.data, reply.err
+	case <-c.closed:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *x11Conn) roundTrip(ctx context.Context, req []byte) ([]byte, error) {
+	return c.wait(ctx, c.send(req, true))
+}
+
+func (c *x11Conn) readLoop() {
+	buf := make([]byte, 32)
+	for {
+		if _, err := io.ReadFull(c.conn, buf); err != nil {
+			c.close(fmt.Errorf("%w: connection to the X server lost: %v", ErrClipboardFailed, err))
+			return
+		}
+
+		switch buf[0] {
+		case 0:
+			err := fmt.Errorf("%w: X error %d for request %d", ErrClipboardFailed, buf[1], buf[10])
+			c.deliver(le.Uint16(buf[2:]), x11Reply{err: err})
+		case 1:
+			reply := make([]byte, 32+4*int(le.Uint32(buf[4:])))
+			copy(reply, buf)
+			if _, err := io.ReadFull(c.conn, reply[32:]); err != nil {
+				c.close(fmt.Errorf("%w: connection to the X server lost: %v", ErrClipboardFailed, err))
+				return
+			}
+			c.deliver(le.Uint16(buf[2:]), x11Reply{data: reply})
+		default:
+			c.handle(c, bytes.Clone(buf))
+		}
+	}
+}
+
+func (c *x11Conn) deliver(seq uint16, reply x11Reply) {
+	c.mu.Lock()
+	ch, ok := c.pending[seq]
+	delete(c.pending, seq)
+	c.mu.Unlock()
+	if ok {
+		ch <- reply
+	}
+}
+
+func (c *x11Conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	c.err = err
+	close(c.closed)
+	c.conn.Close()
+}
+
+func (c *x11Conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *x11Conn) selectionOwner(ctx context.Context, which selection) (uint32, error) {
+	reply, err := c.roundTrip(ctx, c.request(x11OpGetSelectionOwner, 0, c.atoms[x11SelectionNames[which]]))
+	if err != nil {
+		return 0, err
+	}
+	return le.Uint32(reply[8:]), nil
+}
+
+func (c *x11Conn) setSelectionOwner(ctx context.Context, which selection, owner uint32) error {
+	c.send(c.request(x11OpSetSelectionOwner, 0, owner, c.atoms[x11SelectionNames[which]], x11CurrentTime), false)
+	got, err := c.selectionOwner(ctx, which)
+	if err == nil && got != owner {
+		err = fmt.Errorf("%w: another X client holds the %s", ErrClipboardFailed, which)
+	}
+	return err
+}
+
+// selectionOf tells which selection an atom names.
+func (c *x11Conn) selectionOf(atom uint32) (selection, bool) {
+	for which, name := range x11SelectionNames {
+		if c.atoms[name] == atom {
+			return selection(which), true
+		}
+	}
+	return 0, false
+}
+
+// x11Clipboard owns the CLIPBOARD and PRIMARY selections from this
+// process and serves copied text to any client that converts them.
+type x11Clipboard struct {
+	mu sync.Mutex // serializes Copy, Read and release
+
+	state  sync.Mutex // guards conn and sels; never held across a round trip
+	conn   *x11Conn
+	sels   [2]*ownedSelection
+	notify chan []byte
+}
+
+func newX11Clipboard() *x11Clipboard {
+	return &x11Clipboard{notify: make(chan []byte, 4)}
+}
+
+func (c *x11Clipboard) Name() string {
+	return "x11"
+}
+
+func (c *x11Clipboard) connect(ctx context.Context) (*x11Conn, error) {
+	c.state.Lock()
+	conn := c.conn
+	c.state.Unlock()
+	if conn != nil && !conn.isClosed() {
+		return conn, nil
+	}
+
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return nil, ErrNoDisplay
+	}
+	conn, err := dialX11(ctx, display, c.handleEvent)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-conn.closed
+		c.state.Lock()
+		defer c.state.Unlock()
+		if c.conn != conn {
+			return
+		}
+		for which, sel := range c.sels {
+			if sel != nil {
+				sel.lose(conn.err)
+				c.sels[which] = nil
+			}
+		}
+	}()
+
+	c.state.Lock()
+	c.conn = conn
+	c.state.Unlock()
+	return conn, nil
+}
+
+func (c *x11Clipboard) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Lock()
+	conn := c.conn
+	c.state.Unlock()
+	if conn != nil {
+		conn.close(errToolClosed)
+	}
+}
+
+// setSelection replaces the text being served for which; the one it
+// replaces counts as lost with err.
+func (c *x11Clipboard) setSelection(which selection, sel *ownedSelection, err error) {
+	c.state.Lock()
+	defer c.state.Unlock()
+	if old := c.sels[which]; old != nil && old != sel {
+		old.lose(err)
+	}
+	c.sels[which] = sel
+}
+
+func (c *x11Clipboard) owned(which selection) *ownedSelection {
+	c.state.Lock()
+	defer c.state.Unlock()
+	return c.sels[which]
+}
+
+func (c *x11Clipboard) Copy(ctx context.Context, which selection, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if text == "" {
+		c.setSelection(which, nil, nil)
+		return conn.setSelectionOwner(ctx, which, x11None)
+	}
+
+	if len(text)+x11RequestHeader > conn.maxRequest {
+		return fmt.Errorf("%w: text exceeds the X server request size", ErrClipboardFailed)
+	}
+	sel := newOwnedSelection(which, text)
+	c.setSelection(which, sel, nil)
+	if err := conn.setSelectionOwner(ctx, which, conn.window); err != nil {
+		c.setSelection(which, nil, err)
+		return err
+	}
+	return nil
+}
+
+func (c *x11Clipboard) release(ctx context.Context, sel *ownedSelection) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Lock()
+	conn, current := c.conn, c.sels[sel.which]
+	c.state.Unlock()
+	if current != sel || sel.isLost() {
+		return false, nil
+	}
+
+	if owner, err := conn.selectionOwner(ctx, sel.which); err != nil {
+		return false, err
+	} else if owner != conn.window {
+		c.setSelection(sel.which, nil, nil)
+		return false, nil
+	}
+	c.setSelection(sel.which, nil, nil)
+	return true, conn.setSelectionOwner(ctx, sel.which, x11None)
+}
+
+func (c *x11Clipboard) Read(ctx context.Context, which selection) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sel := c.owned(which); sel != nil && !sel.isLost() {
+		return sel.text, nil
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	if owner, err := conn.selectionOwner(ctx, which); err != nil || owner == x11None {
+		return "", err
+	}
+
+	for _, target := range []string{"UTF8_STRING", "STRING"} {
+		property, err := c.convert(ctx, conn, which, conn.atoms[target])
+		if err != nil {
+			return "", err
+		}
+		if property == x11None {
+			continue
+		}
+
+		req := conn.request(x11OpGetProperty, 1, conn.window, property, x11AnyProperty, 0, 1<<28)
+		reply, err := conn.roundTrip(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		if le.Uint32(reply[8:]) == conn.atoms["INCR"] {
+			return "", fmt.Errorf("%w: incremental selection transfers are not supported", ErrClipboardFailed)
+		}
+		n := int(le.Uint32(reply[16:])) * int(reply[1]) / 8
+		return string(reply[32 : 32+min(n, len(reply)-32)]), nil
+	}
+	return "", fmt.Errorf("%w: the %s holds no text", ErrClipboardFailed, which)
+}
+
+// convert asks the owner of which to store it as target on our window,
+// and returns the property it used, or None if it refused.
+func (c *x11Clipboard) convert(ctx context.Context, conn *x11Conn, which selection, target uint32) (uint32, error) {
+	for len(c.notify) > 0 {
+		<-c.notify
+	}
+	property := conn.atoms[x11PropertyName]
+	conn.send(conn.request(x11OpConvertSelection, 0, conn.window, conn.atoms[x11SelectionNames[which]], target, property, x11CurrentTime), false)
+
+	for {
+		select {
+		case event := <-c.notify:
+			if le.Uint32(event[16:]) == target {
+				return le.Uint32(event[20:]), nil
+			}
+		case <-conn.closed:
+			return 0, conn.err
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (c *x11Clipboard) handleEvent(conn *x11Conn, event []byte) {
+	switch event[0] & 0x7f {
+	case x11EventSelectionClear:
+		if which, ok := conn.selectionOf(le.Uint32(event[12:])); ok {
+			c.setSelection(which, nil, nil)
+		}
+	case x11EventSelectionNotify:
+		if le.Uint32(event[8:]) == conn.window {
+			select {
+			case c.notify <- event:
+			default:
+			}
+		}
+	case x11EventSelectionReq:
+		c.serve(conn, event)
+	}
+}
+
+// serve answers a SelectionRequest with the owned text, or refuses it.
+func (c *x11Clipboard) serve(conn *x11Conn, event []byte) {
+	timestamp := le.Uint32(event[4:])
+	requestor, selection := le.Uint32(event[12:]), le.Uint32(event[16:])
+	target, property := le.Uint32(event[20:]), le.Uint32(event[24:])
+	if property == x11None {
+		property = target
+	}
+
+	atoms := conn.atoms
+	var sel *ownedSelection
+	if which, ok := conn.selectionOf(selection); ok {
+		sel = c.owned(which)
+	}
+	if sel == nil {
+		property = x11None
+	}
+
+	switch {
+	case property == x11None:
+	case target == atoms["TARGETS"]:
+		targets := []uint32{atoms["TARGETS"], atoms["UTF8_STRING"], x11AtomString, atoms["TEXT"], atoms["text/plain;charset=utf-8"], atoms["text/plain"], atoms[SensitiveMimeType]}
+		req := conn.request(x11OpChangeProperty, 0, requestor, property, x11AtomAtom, 32, uint32(len(targets)))
+		for _, atom := range targets {
+			req = le.AppendUint32(req, atom)
+		}
+		conn.send(req, false)
+	case target == atoms["UTF8_STRING"], target == x11AtomString, target == atoms["TEXT"],
+		target == atoms["text/plain;charset=utf-8"], target == atoms["text/plain"]:
+		kind := target
+		if target == atoms["TEXT"] {
+			kind = atoms["UTF8_STRING"]
+		}
+		req := conn.request(x11OpChangeProperty, 0, requestor, property, kind, 8, uint32(len(sel.text)))
+		conn.send(append(req, sel.text...), false)
+	case target == atoms[SensitiveMimeType]:
+		req := conn.request(x11OpChangeProperty, 0, requestor, property, atoms[SensitiveMimeType], 8, uint32(len(SensitiveMimeValue)))
+		conn.send(append(req, SensitiveMimeValue...), false)
+	default:
+		property = x11None
+	}
+
+	notify := []byte{x11EventSelectionNotify, 0, 0, 0}
+	for _, field := range []uint32{timestamp, requestor, selection, target, property} {
+		notify = le.AppendUint32(notify, field)
+	}
+	notify = append(notify, make([]byte, 32-len(notify))...)
+	conn.send(append(conn.request(x11OpSendEvent, 0, requestor, 0), notify...), false)
+}
+
+func pad4(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
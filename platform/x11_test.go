@@ -0,0 +1,403 @@
+package platform
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeXServer is a stand-in X server that implements only what selection
+// transfers need: atoms, windows, properties, selection ownership and
+// SendEvent, with no error checking.
+type fakeXServer struct {
+	mu      sync.Mutex
+	atoms   map[string]uint32
+	windows map[uint32]*fakeXClient
+	props   map[[2]uint32][]byte
+	owner   map[uint32]uint32
+	clients uint32
+}
+
+type fakeXClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+	seq  uint16
+}
+
+func startFakeX(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "X0")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeXServer{
+		atoms:   map[string]uint32{"ATOM": x11AtomAtom, "STRING": x11AtomString},
+		windows: make(map[uint32]*fakeXClient),
+		props:   make(map[[2]uint32][]byte),
+		owner:   make(map[uint32]uint32),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return path + ":0"
+}
+
+// startXvfb runs a headless X server when one is installed.
+func startXvfb(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cmd := exec.Command("Xvfb", "-displayfd", "3", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	number, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Xvfb did not report its display: %v", err)
+	}
+	return ":" + strings.TrimSpace(number)
+}
+
+func (s *fakeXServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &fakeXClient{conn: conn}
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	auth := (int(le.Uint16(head[6:]))+3)&^3 + (int(le.Uint16(head[8:]))+3)&^3
+	if _, err := io.ReadFull(conn, make([]byte, auth)); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.clients++
+	base := s.clients << 21
+	s.mu.Unlock()
+
+	body := le.AppendUint32(nil, 0)
+	body = le.AppendUint32(body, base)
+	body = le.AppendUint32(body, 0x1fffff)
+	body = le.AppendUint32(body, 0)
+	body = le.AppendUint16(body, 4)
+	body = le.AppendUint16(body, 0xffff)
+	body = append(body, 1, 0, 0, 0, 32, 32, 8, 255, 0, 0, 0, 0)
+	body = append(body, "fake"...)
+	body = le.AppendUint32(body, 0x100)
+	body = append(body, make([]byte, 36)...)
+	reply := []byte{1, 0, 11, 0, 0, 0}
+	reply = le.AppendUint16(reply, uint16(len(body)/4))
+	c.write(append(reply, body...))
+
+	defer s.disconnect(c)
+	for {
+		hdr := make([]byte, 4)
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			return
+		}
+		req := make([]byte, 4*int(le.Uint16(hdr[2:])))
+		copy(req, hdr)
+		if _, err := io.ReadFull(conn, req[4:]); err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.seq++
+		c.mu.Unlock()
+		s.handle(c, req)
+	}
+}
+
+func (s *fakeXServer) handle(c *fakeXClient, req []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u32 := func(off int) uint32 { return le.Uint32(req[off:]) }
+	switch req[0] {
+	case x11OpCreateWindow:
+		s.windows[u32(4)] = c
+	case x11OpInternAtom:
+		name := string(req[8 : 8+le.Uint16(req[4:])])
+		atom, ok := s.atoms[name]
+		if !ok {
+			atom = uint32(100 + len(s.atoms))
+			s.atoms[name] = atom
+		}
+		c.reply(0, le.AppendUint32(nil, atom))
+	case x11OpChangeProperty:
+		n := int(u32(20)) * int(req[16]) / 8
+		value := le.AppendUint32(nil, u32(12))
+		value = append(value, req[16])
+		s.props[[2]uint32{u32(4), u32(8)}] = append(value, req[24:24+n]...)
+	case x11OpGetProperty:
+		key := [2]uint32{u32(4), u32(8)}
+		value, ok := s.props[key]
+		if !ok {
+			c.reply(0, make([]byte, 24))
+			return
+		}
+		if req[1] != 0 {
+			delete(s.props, key)
+		}
+		format, data := value[4], value[5:]
+		body := le.AppendUint32(nil, le.Uint32(value))
+		body = le.AppendUint32(body, 0)
+		body = le.AppendUint32(body, uint32(len(data)*8/int(format)))
+		body = append(body, make([]byte, 12)...)
+		c.reply(format, append(body, data...))
+	case x11OpSetSelectionOwner:
+		selection, old := u32(8), s.owner[u32(8)]
+		s.owner[selection] = u32(4)
+		if old != 0 && old != u32(4) {
+			if owner := s.windows[old]; owner != nil {
+				owner.event(x11EventSelectionClear, 0, old, selection)
+			}
+		}
+	case x11OpGetSelectionOwner:
+		c.reply(0, le.AppendUint32(nil, s.owner[u32(4)]))
+	case x11OpConvertSelection:
+		requestor, selection, target, property := u32(4), u32(8), u32(12), u32(16)
+		owner := s.windows[s.owner[selection]]
+		if owner == nil {
+			c.event(x11EventSelectionNotify, 0, requestor, selection, target, x11None)
+			return
+		}
+		owner.event(x11EventSelectionReq, 0, s.owner[selection], requestor, selection, target, property)
+	case x11OpSendEvent:
+		if dest := s.windows[u32(4)]; dest != nil {
+			event := append([]byte(nil), req[12:44]...)
+			event[0] |= 0x80
+			dest.write(event)
+		}
+	}
+}
+
+func (s *fakeXServer) disconnect(c *fakeXClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, owner := range s.windows {
+		if owner != c {
+			continue
+		}
+		delete(s.windows, id)
+		for selection, window := range s.owner {
+			if window == id {
+				delete(s.owner, selection)
+			}
+		}
+	}
+}
+
+func (c *fakeXClient) write(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write(b)
+}
+
+func (c *fakeXClient) reply(detail byte, body []byte) {
+	body = pad4(body)
+	msg := []byte{1, detail}
+	c.mu.Lock()
+	msg = le.AppendUint16(msg, c.seq)
+	c.mu.Unlock()
+	extra := max(len(body)-24, 0)
+	msg = le.AppendUint32(msg, uint32(extra/4))
+	msg = append(msg, body...)
+	msg = append(msg, make([]byte, 32+extra-len(msg))...)
+	c.write(msg)
+}
+
+func (c *fakeXClient) event(code byte, fields ...uint32) {
+	event := []byte{code, 0}
+	c.mu.Lock()
+	event = le.AppendUint16(event, c.seq)
+	c.mu.Unlock()
+	for _, f := range fields {
+		event = le.AppendUint32(event, f)
+	}
+	c.write(append(event, make([]byte, 32-len(event))...))
+}
+
+func TestX11Clipboard(t *testing.T) {
+	for name, start := range map[string]func(*testing.T) string{"standin": startFakeX, "xvfb": startXvfb} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("DISPLAY", start(t))
+			t.Setenv("XAUTHORITY", filepath.Join(t.TempDir(), "none"))
+			testSelectionOwners(t, newX11Clipboard(), newX11Clipboard())
+		})
+	}
+}
+
+func TestX11Address(t *testing.T) {
+	for display, want := range map[string]string{
+		":0":             "unix /tmp/.X11-unix/X0 0",
+		"unix:1.0":       "unix /tmp/.X11-unix/X1 1",
+		"localhost:10.0": "tcp localhost:6010 10",
+		"/tmp/xq/X0:0":   "unix /tmp/xq/X0 0",
+	} {
+		network, address, number, err := x11Address(display)
+		if got := strings.Join([]string{network, address, number}, " "); err != nil || got != want {
+			t.Errorf("x11Address(%q) = %q, %v, want %q", display, got, err, want)
+		}
+	}
+	if _, _, _, err := x11Address("nodisplay"); !errors.Is(err, ErrNoDisplay) {
+		t.Errorf("x11Address without a number = %v, want %v", err, ErrNoDisplay)
+	}
+}
+
+// testSelectionOwners runs a and b, two clients of the same display,
+// through copying, taking over, reading and releasing each selection,
+// then checks that timed clears empty both selections.
+func testSelectionOwners(t *testing.T, a, b selectionOwner) {
+	t.Helper()
+	for _, which := range TargetBoth.selections() {
+		t.Run(which.String(), func(t *testing.T) {
+			testSelectionOwner(t, a, b, which)
+		})
+	}
+	t.Run("stale primary", func(t *testing.T) {
+		testStalePrimary(t, a, b)
+	})
+	t.Run("close", func(t *testing.T) {
+		testClose(t, a)
+	})
+}
+
+func testSelectionOwner(t *testing.T, a, b selectionOwner, which selection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	requireRead := func(tool clipboardTool, want string) {
+		t.Helper()
+		if got, err := tool.Read(ctx, which); err != nil || got != want {
+			t.Fatalf("%s read %q, %v, want %q", tool.Name(), got, err, want)
+		}
+	}
+
+	if err := a.Copy(ctx, which, "first secret"); err != nil {
+		t.Fatal(err)
+	}
+	first := a.owned(which)
+	requireRead(b, "first secret")
+
+	if err := b.Copy(ctx, which, "second secret"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-first.lost:
+	case <-ctx.Done():
+		t.Fatal("first owner was not told it lost the selection")
+	}
+	requireRead(a, "second secret")
+	if released, err := a.release(ctx, first); released || err != nil {
+		t.Fatalf("release of a lost selection = %v, %v", released, err)
+	}
+
+	if released, err := b.release(ctx, b.owned(which)); !released || err != nil {
+		t.Fatalf("release = %v, %v", released, err)
+	}
+	requireRead(a, "")
+
+	target := TargetClipboard
+	if which == selPrimary {
+		target = TargetPrimary
+	}
+	m := &LinuxClipboardManager{tools: []clipboardTool{a}, target: target, timeout: time.Second, clearAfter: 200 * time.Millisecond, results: make(chan ClearResult, 1)}
+	if err := m.Copy("cleared on time"); err != nil {
+		t.Fatal(err)
+	}
+	requireRead(b, "cleared on time")
+	if result := <-m.ClearResults(); result.Outcome != ClearDone {
+		t.Fatalf("clear = %v, %v, want %v", result.Outcome, result.Err, ClearDone)
+	}
+	requireRead(b, "")
+
+	if err := m.Copy("replaced"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Copy(ctx, which, "newer"); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-m.ClearResults(); result.Outcome != ClearSkipped {
+		t.Fatalf("clear = %v, %v, want %v", result.Outcome, result.Err, ClearSkipped)
+	}
+	requireRead(a, "newer")
+	if released, err := b.release(ctx, b.owned(which)); !released || err != nil {
+		t.Fatalf("release = %v, %v", released, err)
+	}
+}
+
+// testStalePrimary copies to the clipboard alone while another client
+// puts the same text in PRIMARY, as selecting it in a terminal would, and
+// expects the timed clear to empty both.
+func testStalePrimary(t *testing.T, a, b selectionOwner) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := &LinuxClipboardManager{tools: []clipboardTool{a}, target: TargetClipboard, timeout: time.Second, clearAfter: 200 * time.Millisecond, results: make(chan ClearResult, 1)}
+	if err := m.Copy("revealed secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Copy(ctx, selPrimary, "revealed secret"); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-m.ClearResults(); result.Outcome != ClearDone {
+		t.Fatalf("clear = %v, %v, want %v", result.Outcome, result.Err, ClearDone)
+	}
+	for _, which := range TargetBoth.selections() {
+		if got, err := b.Read(ctx, which); err != nil || got != "" {
+			t.Fatalf("%s after clear = %q, %v, want it empty", which, got, err)
+		}
+	}
+}
+
+// testClose expects closing an owner to give up what it was serving.
+func testClose(t *testing.T, a selectionOwner) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.Copy(ctx, selClipboard, "until closed"); err != nil {
+		t.Fatal(err)
+	}
+	sel := a.owned(selClipboard)
+	closeTool(a)
+	select {
+	case <-sel.lost:
+	case <-ctx.Done():
+		t.Fatal("closing did not give up the selection")
+	}
+	if !errors.Is(sel.err, errToolClosed) {
+		t.Fatalf("selection lost with %v, want %v", sel.err, errToolClosed)
+	}
+}
@@ -0,0 +1,72 @@
+package tui
+
+import (
+	"txt-encdec-cli/platform"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ClipboardDiagnoser inspects the environment and checks every clipboard
+// backend in it, as platform.DiagnoseClipboard does.
+type ClipboardDiagnoser func(opts platform.ClipboardOptions) (platform.ClipboardEnv, []platform.ClipboardCheck)
+
+func diagnoseClipboard(opts platform.ClipboardOptions) (platform.ClipboardEnv, []platform.ClipboardCheck) {
+	return platform.CurrentClipboardEnv(), platform.DiagnoseClipboard(opts)
+}
+
+// diagnosticsRun is a diagnosis in progress, or its findings once done.
+type diagnosticsRun struct {
+	env    platform.ClipboardEnv
+	checks []platform.ClipboardCheck
+	done   bool
+}
+
+// diagnosticsMsg carries the findings for run.
+type diagnosticsMsg struct {
+	run    *diagnosticsRun
+	env    platform.ClipboardEnv
+	checks []platform.ClipboardCheck
+}
+
+// runDiagnostics checks the backends off the UI goroutine; each one may
+// take up to platform.ClipboardProbeTimeout.
+func (m *Model) runDiagnostics() tea.Cmd {
+	m.state = StateDiagnostics
+	m.textInput.Blur()
+	run := &diagnosticsRun{}
+	m.diagnostics = run
+
+	diagnose, opts := m.diagnose, m.config.Clipboard
+	return func() tea.Msg {
+		env, checks := diagnose(opts)
+		return diagnosticsMsg{run: run, env: env, checks: checks}
+	}
+}
+
+// handleDiagnosticsDone shows findings unless the screen was left, or
+// run again, since they were asked for.
+func (m *Model) handleDiagnosticsDone(msg diagnosticsMsg) {
+	if m.state == StateDiagnostics && m.diagnostics == msg.run {
+		m.diagnostics = &diagnosticsRun{env: msg.env, checks: msg.checks, done: true}
+	}
+}
+
+func (m *Model) handleDiagnostics(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc", "enter", "q":
+		return m.resetToModeSelection()
+	case "r":
+		if m.diagnostics.done {
+			return m.runDiagnostics()
+		}
+	}
+	return nil
+}
+
+func (m *Model) viewDiagnostics() string {
+	run := m.diagnostics
+	if !run.done {
+		return m.layout.RenderDiagnostics("", m.clipboardTarget(), nil, true)
+	}
+	return m.layout.RenderDiagnostics(run.env.String(), m.clipboardTarget(), run.checks, false)
+}
@@ -0,0 +1,146 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/keystore"
+	"txt-encdec-cli/platform"
+	"unicode"
+)
+
+type fakeClipboard struct {
+	content string
+	copies  []string
+	err     error
+}
+
+func (c *fakeClipboard) Copy(text string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.copies = append(c.copies, text)
+	c.content = text
+	return nil
+}
+
+func (c *fakeClipboard) Read() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	return c.content, nil
+}
+
+// fakeDiagnoser returns canned findings and counts how often it ran.
+type fakeDiagnoser struct {
+	runs int
+}
+
+func (d *fakeDiagnoser) diagnose(opts platform.ClipboardOptions) (platform.ClipboardEnv, []platform.ClipboardCheck) {
+	d.runs++
+	system := func(name, detail string) platform.ClipboardCandidate {
+		return platform.ClipboardCandidate{Name: name, Backend: platform.ClipboardSystem, Available: true, Detail: detail}
+	}
+	return platform.ClipboardEnv{Display: ":0", SSH: true}, []platform.ClipboardCheck{
+		{ClipboardCandidate: system("x11", "DISPLAY :0"), Chosen: true, Copied: true, Verified: true, Copy: 1200 * time.Microsecond, Read: 3 * time.Millisecond},
+		{ClipboardCandidate: system("xclip", "/usr/bin/xclip"), Copy: 3 * time.Second, Err: fmt.Errorf("clipboard: %w", context.DeadlineExceeded)},
+		{ClipboardCandidate: platform.ClipboardCandidate{Name: "osc52", Backend: platform.ClipboardOSC52, Available: true, Detail: "terminal escape sequences, over SSH"},
+			Copied: true, Copy: 100 * time.Microsecond, Read: 500 * time.Millisecond, Err: errors.Join(platform.ErrNoClipboardTool, errors.New("terminal did not answer the OSC 52 query"))},
+		{ClipboardCandidate: platform.ClipboardCandidate{Name: "wayland", Backend: platform.ClipboardSystem, Detail: "WAYLAND_DISPLAY is not set"}},
+	}
+}
+
+type fakeDetector struct {
+	capsLock bool
+}
+
+func (d *fakeDetector) IsCapsLockOn() bool {
+	return d.capsLock
+}
+
+func (d *fakeDetector) IsKoreanInput(r rune) bool {
+	return unicode.Is(unicode.Hangul, r)
+}
+
+func (d *fakeDetector) IsLatinInput(r rune) bool {
+	return unicode.In(r, unicode.Latin)
+}
+
+type fakeCryptor struct {
+	secret string
+}
+
+func newFakeCryptor(secret string, _ core.AlgorithmID) core.Cryptor {
+	return &fakeCryptor{secret: secret}
+}
+
+func (c *fakeCryptor) Encrypt(plaintext string) (string, error) {
+	return fmt.Sprintf("ENC[%s:%s]", c.secret, plaintext), nil
+}
+
+func (c *fakeCryptor) Decrypt(ciphertext string) (string, error) {
+	prefix := fmt.Sprintf("ENC[%s:", c.secret)
+	if !strings.HasPrefix(ciphertext, "ENC[") || !strings.HasSuffix(ciphertext, "]") {
+		return "", core.ErrInvalidCiphertext
+	}
+	if !strings.HasPrefix(ciphertext, prefix) {
+		return "", fmt.Errorf("%w: wrong secret", core.ErrDecryptionFailed)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(ciphertext, prefix), "]"), nil
+}
+
+type fakeKeyStore struct {
+	identities map[string]*core.Identity
+	recipients map[string]*core.Recipient
+}
+
+func newFakeKeyStore(names ...string) *fakeKeyStore {
+	s := &fakeKeyStore{
+		identities: make(map[string]*core.Identity),
+		recipients: make(map[string]*core.Recipient),
+	}
+	for _, name := range names {
+		identity, err := core.GenerateIdentity()
+		if err != nil {
+			panic(err)
+		}
+		s.identities[name] = identity
+		s.recipients[name] = identity.Recipient()
+	}
+	return s
+}
+
+func (s *fakeKeyStore) Identities() ([]keystore.Entry, error) {
+	return sortedEntries(s.identities), nil
+}
+
+func (s *fakeKeyStore) Recipients() ([]keystore.Entry, error) {
+	return sortedEntries(s.recipients), nil
+}
+
+func (s *fakeKeyStore) Identity(name string) (*core.Identity, error) {
+	if identity, ok := s.identities[name]; ok {
+		return identity, nil
+	}
+	return nil, keystore.ErrKeyNotFound
+}
+
+func (s *fakeKeyStore) Recipient(name string) (*core.Recipient, error) {
+	if recipient, ok := s.recipients[name]; ok {
+		return recipient, nil
+	}
+	return nil, keystore.ErrKeyNotFound
+}
+
+func sortedEntries[T any](keys map[string]T) []keystore.Entry {
+	var entries []keystore.Entry
+	for _, name := range slices.Sorted(maps.Keys(keys)) {
+		entries = append(entries, keystore.Entry{Name: name})
+	}
+	return entries
+}
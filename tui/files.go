@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/filecrypt"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type fileProgressMsg struct {
+	done  int64
+	total int64
+}
+
+type fileDoneMsg struct {
+	err error
+}
+
+// fileJob is a running or finished file operation. Its goroutine reports
+// on updates; progress is dropped while the UI is behind, completion never.
+type fileJob struct {
+	src      string
+	dst      string
+	updates  chan tea.Msg
+	progress fileProgressMsg
+	finished bool
+}
+
+func (m *Model) transitionToFileSelection() tea.Cmd {
+	m.state = StateSelectFile
+	m.textInput.Blur()
+	m.filePicker.DirAllowed = m.mode == ModeEncryptFile
+	m.filePicker.SetHeight(m.layout.CalculateTextAreaHeight(m.terminalSize))
+	return m.filePicker.Init()
+}
+
+// handleFileSelection only handles leaving the picker; Update passes
+// every other message to it.
+func (m *Model) handleFileSelection(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == "esc" {
+		return m.resetToModeSelection()
+	}
+	return nil
+}
+
+func (m *Model) transitionToOutputEntry(src string) {
+	m.state = StateEnterOutput
+	m.filePath = src
+	m.overwrite = false
+	m.textInput.Prompt = ""
+	m.textInput.EchoMode = textinput.EchoNormal
+	m.textInput.SetValue(filecrypt.DefaultOutput(src, m.mode == ModeEncryptFile))
+	m.textInput.CursorEnd()
+	m.textInput.Focus()
+}
+
+// handleOutputEntry asks for a second enter before replacing an existing
+// path; editing the path disarms it again.
+func (m *Model) handleOutputEntry(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.state = StateSelectFile
+		return nil
+	case "enter":
+		dst := strings.TrimSpace(m.textInput.Value())
+		if dst == "" {
+			return nil
+		}
+		if _, err := os.Lstat(dst); err == nil && !m.overwrite {
+			m.overwrite = true
+			return nil
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			m.state = StateShowError
+			m.lastError = err
+			return nil
+		}
+		return m.startFileJob(dst)
+	default:
+		m.overwrite = false
+	}
+	return nil
+}
+
+func (m *Model) startFileJob(dst string) tea.Cmd {
+	stream, ok := m.cryptor.(core.StreamCryptor)
+	if !ok {
+		m.state = StateShowError
+		m.lastError = &AppError{Op: "file", Err: ErrInvalidOperation}
+		return nil
+	}
+
+	job := &fileJob{src: m.filePath, dst: dst, updates: make(chan tea.Msg, 1)}
+	opts := filecrypt.Options{
+		Overwrite: m.overwrite,
+		Progress: func(done, total int64) {
+			select {
+			case job.updates <- fileProgressMsg{done: done, total: total}:
+			default:
+			}
+		},
+	}
+
+	run := filecrypt.Decrypt
+	if m.mode == ModeEncryptFile {
+		run = filecrypt.Encrypt
+	}
+	go func() {
+		job.updates <- fileDoneMsg{err: run(stream, job.src, job.dst, opts)}
+	}()
+
+	m.state = StateFileProgress
+	m.textInput.Blur()
+	m.fileJob = job
+	return m.waitForFileUpdate()
+}
+
+func (m *Model) waitForFileUpdate() tea.Cmd {
+	updates := m.fileJob.updates
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+func (m *Model) handleFileDone(msg fileDoneMsg) {
+	if msg.err != nil {
+		m.state = StateShowError
+		m.lastError = msg.err
+		return
+	}
+	m.fileJob.finished = true
+}
+
+func (m *Model) handleFileProgress(msg tea.KeyMsg) tea.Cmd {
+	if m.fileJob.finished && msg.Type == tea.KeyEnter {
+		return m.resetToModeSelection()
+	}
+	return nil
+}
+
+func (m *Model) viewFiles() string {
+	switch m.state {
+	case StateSelectFile:
+		title := "Select File to Decrypt:"
+		helpText := "enter: select , left/right: directory , esc: back"
+		if m.mode == ModeEncryptFile {
+			title = "Select File or Directory to Encrypt:"
+			helpText = "enter: select , right: open directory , left: parent , esc: back"
+		}
+		return m.layout.RenderInputPrompt(title, m.filePicker.View(), helpText)
+
+	case StateEnterOutput:
+		inputWidth := m.layout.CalculateInputWidth(m.terminalSize)
+		m.textInput.Width = inputWidth
+		inputView := m.layout.CreateStyledInput(m.textInput.View(), inputWidth)
+		var warning string
+		if m.overwrite {
+			warning = "Already exists; press enter again to overwrite"
+		}
+		content := m.layout.RenderOutputPrompt(filepath.Base(m.filePath), inputView, warning)
+		return content + m.layout.RenderPasteStatus(m.notice, m.clipboardErr)
+	}
+
+	job := m.fileJob
+	running, finished := "Decrypting", "decrypted"
+	if m.mode == ModeEncryptFile {
+		running, finished = "Encrypting", "encrypted"
+	}
+	if !job.finished {
+		title := fmt.Sprintf("%s %s...", running, filepath.Base(job.src))
+		return m.layout.RenderProgress(title, job.progress.done, job.progress.total, m.layout.CalculateInputWidth(m.terminalSize))
+	}
+
+	message := fmt.Sprintf("%s %s to %s", filepath.Base(job.src), finished, filepath.Base(job.dst))
+	return m.layout.RenderResult(true, message, job.dst)
+}
@@ -1,16 +1,23 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
+	"txt-encdec-cli/platform"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
 )
 
 type LayoutManager struct {
 	config AppConfig
+	styles Styles
 }
 
 func NewLayoutManager(config AppConfig) *LayoutManager {
 	return &LayoutManager{
 		config: config,
+		styles: NewStyles(config.Theme),
 	}
 }
 
@@ -32,20 +39,64 @@ func (lm *LayoutManager) CalculateInputWidth(terminalSize TerminalSize) int {
 	return calculated
 }
 
+func (lm *LayoutManager) CalculateTextAreaHeight(terminalSize TerminalSize) int {
+	if !terminalSize.IsValid() {
+		return lm.config.MinTextAreaHeight
+	}
+
+	calculated := terminalSize.Height - 18
+
+	if calculated > lm.config.MaxTextAreaHeight {
+		return lm.config.MaxTextAreaHeight
+	}
+
+	if calculated < lm.config.MinTextAreaHeight {
+		return lm.config.MinTextAreaHeight
+	}
+
+	return calculated
+}
+
 func (lm *LayoutManager) RenderModeSelection(cursor int, modes []string) string {
 	var content strings.Builder
 
-	content.WriteString(ListPromptStyle.Render("Select encryption mode:") + "\n")
+	content.WriteString(lm.styles.ListPrompt.Render("Select encryption mode:") + "\n")
 
 	for i, mode := range modes {
 		if cursor == i {
-			content.WriteString(SelectedListItemStyle.Render("> "+mode) + "\n")
+			content.WriteString(lm.styles.SelectedListItem.Render("> "+mode) + "\n")
+		} else {
+			content.WriteString(lm.styles.ListItem.Render("  "+mode) + "\n")
+		}
+	}
+
+	content.WriteString("\n" + lm.styles.Help.Render("up/down: navigate , enter: select , q/ctrl+c: quit"))
+
+	return content.String()
+}
+
+func (lm *LayoutManager) RenderKeySelection(title string, names []string, cursor int, selected []bool, helpText string) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.ListPrompt.Render(title) + "\n")
+
+	for i, name := range names {
+		if selected != nil {
+			check := "[ ] "
+			if selected[i] {
+				check = "[x] "
+			}
+			name = check + name
+		}
+
+		if cursor == i {
+			content.WriteString(lm.styles.SelectedListItem.Render("> "+name) + "\n")
 		} else {
-			content.WriteString(ListItemStyle.Render("  "+mode) + "\n")
+			content.WriteString(lm.styles.ListItem.Render("  "+name) + "\n")
 		}
 	}
 
-	content.WriteString("\n" + HelpStyle.Render("up/down: navigate , enter: select , q/ctrl+c: quit"))
+	content.WriteString("\n" + lm.styles.Help.Render(helpText))
 
 	return content.String()
 }
@@ -53,31 +104,275 @@ func (lm *LayoutManager) RenderModeSelection(cursor int, modes []string) string
 func (lm *LayoutManager) RenderInputPrompt(title, inputView, helpText string) string {
 	var content strings.Builder
 
-	content.WriteString(ListPromptStyle.Render(title) + "\n")
+	content.WriteString(lm.styles.ListPrompt.Render(title) + "\n")
 	content.WriteString(inputView + "\n")
-	content.WriteString(HelpStyle.Render(helpText))
+	content.WriteString(lm.styles.Help.Render(helpText))
+
+	return content.String()
+}
+
+// RenderSecretFactors lists what the typed secret will be combined with.
+func (lm *LayoutManager) RenderSecretFactors(keyfiles []string, challenge string) string {
+	var factors []string
+	for _, name := range keyfiles {
+		factors = append(factors, "keyfile "+name)
+	}
+	if challenge != "" {
+		name, _, _ := strings.Cut(challenge, ":")
+		factors = append(factors, "challenge-response "+name)
+	}
+	if len(factors) == 0 {
+		return ""
+	}
+	return "\n" + lm.styles.Help.Render("+ "+strings.Join(factors, " , "))
+}
+
+// RenderClipboardOffer describes ciphertext found on the clipboard and the
+// key that pastes it.
+func (lm *LayoutManager) RenderClipboardOffer(format, preview string, length int) string {
+	var content strings.Builder
+
+	content.WriteString("\n" + lm.styles.Result.Render(fmt.Sprintf(" Clipboard holds %s ciphertext (%d characters)", format, length)) + "\n")
+	content.WriteString(lm.styles.Help.Render(fmt.Sprintf("  %s , %s: paste it", preview, lm.config.Keys.Paste)))
+
+	return content.String()
+}
+
+func (lm *LayoutManager) RenderPasteStatus(notice string, err error) string {
+	switch {
+	case err != nil:
+		return "\n" + lm.styles.Error.Render(" Clipboard: "+err.Error())
+	case notice != "":
+		return "\n" + lm.styles.Result.Render(" "+notice)
+	}
+	return ""
+}
+
+func (lm *LayoutManager) RenderVaultList(searchView string, items []string, cursor int, details, warning, notice string, err error) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.ListPrompt.Render("Vault (type to search):") + "\n")
+	content.WriteString(searchView + "\n")
+
+	if len(items) == 0 {
+		content.WriteString(lm.styles.Help.Render("  No entries") + "\n")
+	}
+	for i, item := range items {
+		if cursor == i {
+			content.WriteString(lm.styles.SelectedListItem.Render("> "+item) + "\n")
+		} else {
+			content.WriteString(lm.styles.ListItem.Render("  "+item) + "\n")
+		}
+	}
+
+	if details != "" {
+		content.WriteString(lm.styles.Help.Render(details) + "\n")
+	}
+	switch {
+	case err != nil:
+		content.WriteString(lm.styles.Error.Render(" "+err.Error()) + "\n")
+	case warning != "":
+		content.WriteString(lm.styles.Warning.Render(" "+warning) + "\n")
+	case notice != "":
+		content.WriteString(lm.styles.Result.Render(" "+notice) + "\n")
+	}
+
+	content.WriteString("\n" + lm.styles.Help.Render("up/down: navigate , enter: copy secret , esc: back") + "\n")
+	content.WriteString(lm.styles.Help.Render("ctrl+n: new , ctrl+e: edit , ctrl+x: delete , ctrl+l: lock"))
 
 	return content.String()
 }
 
+func (lm *LayoutManager) RenderVaultForm(title string, labels, fields []string, focus int, err error, helpText string) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.ListPrompt.Render(title) + "\n")
+	for i, label := range labels {
+		style := lm.styles.ListItem
+		if i == focus {
+			style = lm.styles.SelectedListItem
+		}
+		content.WriteString(style.Render(label+":") + "\n")
+		content.WriteString(fields[i] + "\n")
+	}
+
+	if err != nil {
+		content.WriteString(lm.styles.Error.Render(" "+err.Error()) + "\n")
+	}
+
+	content.WriteString(lm.styles.Help.Render(helpText))
+
+	return content.String()
+}
+
+func (lm *LayoutManager) RenderOutputPrompt(source, inputView, warning string) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.ListPrompt.Render(fmt.Sprintf("Write %s to:", source)) + "\n")
+	content.WriteString(inputView + "\n")
+	if warning != "" {
+		content.WriteString(lm.styles.Warning.Render(" "+warning) + "\n")
+	}
+	content.WriteString(lm.styles.Help.Render(fmt.Sprintf("enter: start , esc: back , %s: paste , ctrl+c: quit", lm.config.Keys.Paste)))
+
+	return content.String()
+}
+
+func (lm *LayoutManager) RenderProgress(title string, done, total int64, width int) string {
+	var content strings.Builder
+
+	fraction := 1.0
+	if total > 0 {
+		fraction = min(float64(done)/float64(total), 1)
+	}
+	barWidth := max(width-8, 10)
+	filled := int(fraction * float64(barWidth))
+
+	content.WriteString(lm.styles.ListPrompt.Render(title) + "\n")
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+	content.WriteString(lm.styles.SelectedListItem.Render(fmt.Sprintf("%s %3.0f%%", bar, fraction*100)) + "\n")
+	content.WriteString(lm.styles.Help.Render(fmt.Sprintf("%s of %s , ctrl+c: quit", formatSize(done), formatSize(total))))
+
+	return content.String()
+}
+
+// RenderDiagnostics lists every clipboard backend with its status and
+// latency, the one copies use marked with a star, and why each failed or
+// was ruled out.
+func (lm *LayoutManager) RenderDiagnostics(environment, target string, checks []platform.ClipboardCheck, running bool) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.ListPrompt.Render("Clipboard Diagnostics:") + "\n")
+	if running {
+		content.WriteString(lm.styles.Help.Render("  Checking every backend; the clipboard will be emptied...") + "\n")
+		content.WriteString("\n" + lm.styles.Help.Render("esc: back , ctrl+c: quit"))
+		return content.String()
+	}
+
+	content.WriteString(lm.styles.Help.Render(truncateLine("  "+environment, diagnosticsWidth)) + "\n")
+	content.WriteString(lm.styles.Help.Render("  target: "+target) + "\n\n")
+	for _, check := range checks {
+		mark, style := "  ", lm.styles.ListItem
+		if check.Chosen {
+			mark, style = "* ", lm.styles.SelectedListItem
+		}
+		if check.Available && !check.Verified {
+			style = lm.styles.Warning
+		}
+		content.WriteString(style.Render(fmt.Sprintf("%s%-8s %-12s %s", mark, check.Name, check.Status(), check.Latency())) + "\n")
+		content.WriteString(lm.styles.Help.Render(truncateLine("    "+check.Detail, diagnosticsWidth)) + "\n")
+		if check.Err != nil {
+			lines := strings.Split(check.Err.Error(), "\n")
+			for i, line := range lines {
+				lines[i] = truncateLine("    "+line, diagnosticsWidth)
+			}
+			content.WriteString(lm.styles.Error.UnsetMarginBottom().Render(strings.Join(lines, "\n")) + "\n")
+		}
+	}
+
+	content.WriteString("\n" + lm.styles.Help.Render("* copies use this backend , r: run again , enter/esc: back"))
+	return content.String()
+}
+
+// diagnosticsWidth fits the narrowest layout the app allows.
+const diagnosticsWidth = 72
+
+// truncateLine cuts s to width runes, marking the cut with an ellipsis.
+func truncateLine(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func (lm *LayoutManager) RenderResult(success bool, message, details string) string {
 	var content strings.Builder
 
 	if success {
-		content.WriteString(ResultStyle.Render(" "+message) + "\n\n")
+		content.WriteString(lm.styles.Result.Render(" "+message) + "\n\n")
 	} else {
-		content.WriteString(ErrorStyle.Render(" "+message) + "\n\n")
+		content.WriteString(lm.styles.Error.Render(" "+message) + "\n\n")
 	}
 
 	if details != "" {
-		content.WriteString(HelpStyle.Render(details) + "\n\n")
+		content.WriteString(lm.styles.Help.Render(details) + "\n\n")
 	}
 
-	content.WriteString(HelpStyle.Render("enter: continue"))
+	content.WriteString(lm.styles.Help.Render("enter: continue"))
 
 	return content.String()
 }
 
+func (lm *LayoutManager) RenderResultViewer(message, details, warning, body, notice string, canEncode bool, clipboardErr error) string {
+	var content strings.Builder
+
+	content.WriteString(lm.styles.Result.Render(" "+message) + "\n")
+	content.WriteString(lm.styles.Help.Render(details) + "\n")
+	if warning != "" {
+		content.WriteString(lm.styles.Warning.Render(" "+warning) + "\n")
+	}
+	content.WriteString("\n")
+	content.WriteString(lm.styles.Code.Render(body) + "\n")
+
+	if clipboardErr != nil {
+		content.WriteString(lm.styles.Error.Render(" Clipboard: "+clipboardErr.Error()) + "\n")
+	} else if notice != "" {
+		content.WriteString(lm.styles.Result.Render(" "+notice) + "\n")
+	}
+
+	keys := lm.config.Keys
+	help := fmt.Sprintf("%s: reveal , up/down: line , pgup/pgdown: scroll , %s: copy all , %s: copy line , ", keys.Reveal, keys.CopyAll, keys.CopyLine)
+	if canEncode {
+		help += fmt.Sprintf("%s: encoding , ", keys.Encoding)
+	}
+	content.WriteString(lm.styles.Help.Render(help + "enter: continue"))
+
+	return content.String()
+}
+
+func (lm *LayoutManager) RenderResultLines(lines []string, selected int, revealed bool, width int) (string, int, int) {
+	var content strings.Builder
+	lineStyle := lipgloss.NewStyle().Width(width - 2)
+
+	row, top, bottom := 0, 0, 0
+	for i, line := range lines {
+		if !revealed {
+			line = strings.Repeat("•", utf8.RuneCountInString(line))
+		}
+
+		wrapped := lineStyle.Render(line)
+		height := lipgloss.Height(wrapped)
+
+		marker := "  "
+		if i == selected {
+			marker = "> "
+			wrapped = lm.styles.SelectedListItem.Render(wrapped)
+			top, bottom = row, row+height
+		}
+
+		if i > 0 {
+			content.WriteString("\n")
+		}
+		content.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, marker, wrapped))
+		row += height
+	}
+
+	return content.String(), top, bottom
+}
+
 func (lm *LayoutManager) RenderInputState(state InputState) string {
 	if !state.HasIndicators() {
 		return ""
@@ -86,11 +381,11 @@ func (lm *LayoutManager) RenderInputState(state InputState) string {
 	var indicators []string
 
 	if state.KoreanActive {
-		indicators = append(indicators, KoreanIndicatorStyle.Render("한글"))
+		indicators = append(indicators, lm.styles.KoreanIndicator.Render("한글"))
 	}
 
 	if state.CapsLockOn {
-		indicators = append(indicators, CapsIndicatorStyle.Render("CAPS"))
+		indicators = append(indicators, lm.styles.CapsIndicator.Render("CAPS"))
 	}
 
 	return "\n\n" + strings.Join(indicators, " ")
@@ -100,15 +395,15 @@ func (lm *LayoutManager) RenderApp(content string) string {
 	var app strings.Builder
 
 	logo := " TEXT ENCRYPTOR "
-	app.WriteString(LogoStyle.Render(logo) + "\n\n")
+	app.WriteString(lm.styles.Logo.Render(logo) + "\n\n")
 
 	app.WriteString(content)
 
-	return AppStyle.Render(app.String())
+	return lm.styles.App.Render(app.String())
 }
 
 func (lm *LayoutManager) CreateStyledInput(inputView string, width int) string {
 	styleWidth := width + 6 
-	inputStyle := TextInputStyle.Width(styleWidth)
+	inputStyle := lm.styles.TextInput.Width(styleWidth)
 	return inputStyle.Render(inputView)
 }
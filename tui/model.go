@@ -2,13 +2,65 @@ package tui
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 	"txt-encdec-cli/core"
+	"txt-encdec-cli/keystore"
 	"txt-encdec-cli/platform"
+	"unicode/utf8"
 
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+type clipboardClearedMsg platform.ClearResult
+
+type CryptorFactory func(secret string, algorithm core.AlgorithmID) core.Cryptor
+
+type KeyStore interface {
+	Identities() ([]keystore.Entry, error)
+	Recipients() ([]keystore.Entry, error)
+	Identity(name string) (*core.Identity, error)
+	Recipient(name string) (*core.Recipient, error)
+}
+
+type Option func(*Model)
+
+func WithClipboard(clipboard platform.ClipboardManager) Option {
+	return func(m *Model) {
+		m.clipboard = clipboard
+	}
+}
+
+func WithDetector(detector platform.SystemStateDetector) Option {
+	return func(m *Model) {
+		m.detector = detector
+	}
+}
+
+func WithCryptorFactory(factory CryptorFactory) Option {
+	return func(m *Model) {
+		m.newCryptor = factory
+	}
+}
+
+func WithKeyStore(store KeyStore) Option {
+	return func(m *Model) {
+		m.keyStore = store
+	}
+}
+
+func WithClipboardDiagnoser(diagnose ClipboardDiagnoser) Option {
+	return func(m *Model) {
+		m.diagnose = diagnose
+	}
+}
+
 type Model struct {
 	state        AppState
 	mode         OperationMode
@@ -16,41 +68,95 @@ type Model struct {
 	terminalSize TerminalSize
 
 	textInput  textinput.Model
+	textArea   textarea.Model
 	inputState InputState
 
-	cryptor   core.Cryptor
-	clipboard platform.ClipboardManager
-	detector  platform.SystemStateDetector
+	cryptor    core.Cryptor
+	newCryptor CryptorFactory
+	clipboard  platform.ClipboardManager
+	detector   platform.SystemStateDetector
+	keyStore   KeyStore
+	diagnose   ClipboardDiagnoser
 
 	layout *LayoutManager
 	config AppConfig
 
-	secretKey string
-	result    string
-	lastError error
-
-	availableModes []string
+	secretKey     string
+	keyfiles      []string
+	keyfilePicker filepicker.Model
+	context       string
+	result        string
+	lastError     error
+
+	resultView   viewport.Model
+	resultInfo   ResultInfo
+	resultLine   int
+	revealed     bool
+	clipboardErr error
+	notice       string
+	offer        string
+
+	algorithm      core.AlgorithmID
+	format         core.Format
+	availableModes []ModeOption
+
+	keyEntries  []keystore.Entry
+	keyCursor   int
+	keySelected []bool
+	identity    *core.Identity
+
+	filePicker filepicker.Model
+	filePath   string
+	overwrite  bool
+	fileJob    *fileJob
+
+	vault    *vaultSession
+	newVault *pendingVault
+
+	diagnostics *diagnosticsRun
 }
 
 func New() Model {
 	return NewWithConfig(DefaultConfig())
 }
 
-func NewWithConfig(config AppConfig) Model {
+func NewWithConfig(config AppConfig, opts ...Option) Model {
 	ti := textinput.New()
 	ti.Focus()
 	ti.CharLimit = config.InputCharLimit
 
-	return Model{
+	ta := textarea.New()
+	ta.Prompt = ""
+	ta.ShowLineNumbers = true
+	ta.CharLimit = config.TextCharLimit
+	ta.MaxHeight = config.TextMaxLines
+
+	m := Model{
 		state:          StateSelectMode,
 		terminalSize:   TerminalSize{Width: config.DefaultWidth, Height: config.DefaultHeight},
 		textInput:      ti,
-		clipboard:      platform.NewLinuxClipboardManager(),
+		textArea:       ta,
+		resultView:     viewport.New(config.MinInputWidth, config.MinTextAreaHeight),
+		clipboard:      platform.NewClipboardManager(config.Clipboard),
 		detector:       platform.NewLinuxSystemDetector(),
+		keyStore:       keystore.New(config.KeyStoreDir),
+		diagnose:       diagnoseClipboard,
 		layout:         NewLayoutManager(config),
 		config:         config,
-		availableModes: []string{"Encrypt", "Decrypt"},
+		availableModes: BuildModeOptions(config.Cipher),
+		keyfiles:       slices.Clone(config.Keyfiles),
+		keyfilePicker:  newFilePicker(config.KeyfileDir),
+		filePicker:     newFilePicker(config.FileDir),
+	}
+	m.newCryptor = func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF).WithPacking(config.Packing)
+	}
+
+	for _, opt := range opts {
+		opt(&m)
 	}
+
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
@@ -61,12 +167,51 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.terminalSize = TerminalSize{Width: msg.Width, Height: msg.Height}
+		m.resizeTextArea()
+		m.refreshResultView()
+
+	case clipboardClearedMsg:
+		m.handleClipboardCleared(platform.ClearResult(msg))
+		return m, nil
+
+	case vaultLockMsg:
+		return m, m.handleVaultLock(msg)
+
+	case fileProgressMsg:
+		m.fileJob.progress = msg
+		return m, m.waitForFileUpdate()
+
+	case fileDoneMsg:
+		m.handleFileDone(msg)
+		return m, nil
+
+	case clipboardPeekMsg:
+		m.handleClipboardPeek(msg)
+		return m, nil
+
+	case clipboardPasteMsg:
+		return m.pasteClipboard(msg)
+
+	case diagnosticsMsg:
+		m.handleDiagnosticsDone(msg)
+		return m, nil
 
 	case tea.KeyMsg:
 		if msg.Type == tea.KeyCtrlC {
 			return m, tea.Quit
 		}
 
+		if !m.touchVault() {
+			return m, nil
+		}
+
+		if m.canPaste() {
+			m.notice, m.clipboardErr = "", nil
+			if msg.String() == m.config.Keys.Paste {
+				return m, m.readClipboard()
+			}
+		}
+
 		if m.state == StateEnterSecret {
 			m.updateInputState(msg)
 		} else {
@@ -79,11 +224,42 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	var cmd tea.Cmd
-	m.textInput, cmd = m.textInput.Update(msg)
+	switch m.state {
+	case StateEnterText:
+		m.textArea, cmd = m.textArea.Update(msg)
+	case StateSelectKeyfile:
+		m.keyfilePicker, cmd = m.keyfilePicker.Update(msg)
+		if ok, path := m.keyfilePicker.DidSelectFile(msg); ok {
+			m.addKeyfile(path)
+			return m, textinput.Blink
+		}
+	case StateVaultList:
+		m.textInput, cmd = m.textInput.Update(msg)
+		m.filterVault()
+	case StateVaultEdit:
+		cmd = m.updateVaultForm(msg)
+	case StateSelectFile:
+		m.filePicker, cmd = m.filePicker.Update(msg)
+		if ok, path := m.filePicker.DidSelectFile(msg); ok {
+			m.transitionToOutputEntry(path)
+			return m, textinput.Blink
+		}
+	case StateFileProgress, StateDiagnostics:
+	default:
+		m.textInput, cmd = m.textInput.Update(msg)
+	}
 
 	return m, cmd
 }
 
+func newFilePicker(dir string) filepicker.Model {
+	picker := filepicker.New()
+	picker.CurrentDirectory = dir
+	picker.ShowPermissions = false
+	picker.AutoHeight = false
+	return picker
+}
+
 func (m *Model) updateInputState(msg tea.KeyMsg) {
 	m.inputState.CapsLockOn = m.detector.IsCapsLockOn()
 
@@ -117,12 +293,32 @@ func (m *Model) handleKeyEvent(msg tea.KeyMsg) tea.Cmd {
 		return m.handleModeSelection(msg)
 	case StateEnterSecret:
 		return m.handleSecretEntry(msg)
+	case StateSelectKeyfile:
+		return m.handleKeyfileSelection(msg)
+	case StateSelectKeys:
+		return m.handleKeySelection(msg)
+	case StateEnterContext:
+		return m.handleContextEntry(msg)
 	case StateEnterText:
 		return m.handleTextEntry(msg)
-	case StateShowResult, StateShowError:
+	case StateShowResult:
+		return m.handleResultViewer(msg)
+	case StateShowError:
 		return m.handleResultScreen(msg)
 	case StateWaitingToClear:
 		return m.handleClipboardClear(msg)
+	case StateVaultList:
+		return m.handleVaultList(msg)
+	case StateVaultEdit:
+		return m.handleVaultEdit(msg)
+	case StateSelectFile:
+		return m.handleFileSelection(msg)
+	case StateEnterOutput:
+		return m.handleOutputEntry(msg)
+	case StateFileProgress:
+		return m.handleFileProgress(msg)
+	case StateDiagnostics:
+		return m.handleDiagnostics(msg)
 	}
 	return nil
 }
@@ -140,27 +336,205 @@ func (m *Model) handleModeSelection(msg tea.KeyMsg) tea.Cmd {
 			m.cursor++
 		}
 	case "enter":
-		m.mode = OperationMode(m.cursor)
+		selected := m.availableModes[m.cursor]
+		m.mode = selected.Mode
+		m.algorithm = selected.Algorithm
+		m.format = selected.Format
+		if m.mode == ModeVault {
+			return m.openVault()
+		}
+		if m.mode == ModeDiagnostics {
+			return m.runDiagnostics()
+		}
+		if m.mode.UsesKeys() {
+			m.transitionToKeySelection()
+			return nil
+		}
 		m.transitionToSecretEntry()
 		return textinput.Blink
 	}
 	return nil
 }
 
+func (m *Model) handleKeySelection(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		return m.resetToModeSelection()
+	case "up", "k":
+		if m.keyCursor > 0 {
+			m.keyCursor--
+		}
+	case "down", "j":
+		if m.keyCursor < len(m.keyEntries)-1 {
+			m.keyCursor++
+		}
+	case " ":
+		if m.keySelected != nil {
+			m.keySelected[m.keyCursor] = !m.keySelected[m.keyCursor]
+		}
+	case "enter":
+		cryptor, err := m.cryptorForKeys()
+		if err != nil {
+			m.state = StateShowError
+			m.lastError = err
+			return nil
+		}
+		m.cryptor = cryptor
+		return m.transitionAfterKey()
+	}
+	return nil
+}
+
+// cryptorForKeys encrypts to every checked recipient (or the one under the
+// cursor when none are checked) and decrypts with the identity under the
+// cursor.
+func (m *Model) cryptorForKeys() (core.Cryptor, error) {
+	if m.mode == ModeDecryptIdentity {
+		identity, err := m.keyStore.Identity(m.keyEntries[m.keyCursor].Name)
+		if err != nil {
+			return nil, err
+		}
+		m.identity = identity
+		return core.NewRecipientCryptor(m.config.Cipher, nil, []*core.Identity{identity}), nil
+	}
+
+	var recipients []*core.Recipient
+	for i, entry := range m.keyEntries {
+		if !m.keySelected[i] {
+			continue
+		}
+		recipient, err := m.keyStore.Recipient(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		recipient, err := m.keyStore.Recipient(m.keyEntries[m.keyCursor].Name)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if m.format == core.FormatAge {
+		return core.NewAgeRecipientCryptor(recipients, nil)
+	}
+	return core.NewRecipientCryptor(m.algorithm, recipients, nil).WithPacking(m.config.Packing), nil
+}
+
+// decryptorFor routes sniffed age and openssl input to a matching cryptor,
+// using the secret or identity chosen for this session.
+func (m *Model) decryptorFor(format core.Format) (core.Cryptor, error) {
+	switch {
+	case format == core.FormatAge && m.mode == ModeDecryptIdentity:
+		return core.NewAgeRecipientCryptor(nil, []*core.Identity{m.identity})
+	case format == core.FormatAge:
+		return core.NewAgePassphraseCryptor(m.secretKey, 0)
+	case format == core.FormatOpenSSL && m.mode == ModeDecryptIdentity:
+		return nil, core.ErrPassphraseEnvelope
+	case format == core.FormatOpenSSL:
+		return core.NewOpenSSLCryptor(m.secretKey, m.config.OpenSSL), nil
+	default:
+		return m.cryptor, nil
+	}
+}
+
 func (m *Model) handleSecretEntry(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == m.config.Keys.Keyfile {
+		m.state = StateSelectKeyfile
+		m.keyfilePicker.SetHeight(m.layout.CalculateTextAreaHeight(m.terminalSize))
+		return m.keyfilePicker.Init()
+	}
+
 	if msg.Type == tea.KeyEnter {
-		m.secretKey = m.textInput.Value()
-		m.cryptor = core.NewAESCryptor(m.secretKey)
-		m.transitionToTextEntry()
+		secret, err := m.composeSecret(m.textInput.Value())
+		if err != nil {
+			m.state = StateShowError
+			m.lastError = err
+			return nil
+		}
+		if m.mode == ModeVault {
+			return m.unlockVault(secret)
+		}
+		m.secretKey = secret
+		switch m.format {
+		case core.FormatAge:
+			cryptor, err := core.NewAgePassphraseCryptor(m.secretKey, core.AgeWorkFactor(m.config.KDF))
+			if err != nil {
+				m.state = StateShowError
+				m.lastError = err
+				return nil
+			}
+			m.cryptor = cryptor
+		case core.FormatOpenSSL:
+			m.cryptor = core.NewOpenSSLCryptor(m.secretKey, m.config.OpenSSL)
+		default:
+			m.cryptor = m.newCryptor(m.secretKey, m.algorithm)
+		}
+		return m.transitionAfterKey()
+	}
+	return nil
+}
+
+// handleKeyfileSelection only handles leaving the picker; Update passes
+// every other message to it.
+func (m *Model) handleKeyfileSelection(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == "esc" {
+		m.state = StateEnterSecret
 		return textinput.Blink
 	}
 	return nil
 }
 
-func (m *Model) handleTextEntry(msg tea.KeyMsg) tea.Cmd {
+func (m *Model) addKeyfile(path string) {
+	if !slices.Contains(m.keyfiles, path) {
+		m.keyfiles = append(m.keyfiles, path)
+	}
+	m.state = StateEnterSecret
+}
+
+// composeSecret combines the typed passphrase with the chosen keyfiles and
+// the configured challenge-response provider.
+func (m *Model) composeSecret(passphrase string) (string, error) {
+	factors := core.SecretFactors{Keyfiles: m.keyfiles}
+	if m.config.Challenge != "" {
+		responder, err := core.OpenChallengeResponder(m.config.Challenge)
+		if err != nil {
+			return "", err
+		}
+		factors.Responder = responder
+	}
+	return factors.Compose(passphrase)
+}
+
+func (m *Model) keyfileNames() []string {
+	names := make([]string, len(m.keyfiles))
+	for i, path := range m.keyfiles {
+		names[i] = filepath.Base(path)
+	}
+	return names
+}
+
+func (m *Model) handleContextEntry(msg tea.KeyMsg) tea.Cmd {
 	if msg.Type == tea.KeyEnter {
-		inputText := m.textInput.Value()
-		m.processInput(inputText)
+		context := strings.TrimSpace(m.textInput.Value())
+		if err := core.ValidateContext(context); err != nil {
+			m.state = StateShowError
+			m.lastError = err
+			return nil
+		}
+		m.context = context
+		return m.transitionToTextEntry()
+	}
+	return nil
+}
+
+func (m *Model) handleTextEntry(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == m.config.Keys.Submit {
+		inputText := m.textArea.Value()
+		return m.processInput(inputText)
 	}
 	return nil
 }
@@ -172,6 +546,167 @@ func (m *Model) handleResultScreen(msg tea.KeyMsg) tea.Cmd {
 	return nil
 }
 
+func (m *Model) handleResultViewer(msg tea.KeyMsg) tea.Cmd {
+	m.notice = ""
+
+	keys := m.config.Keys
+	switch msg.String() {
+	case "enter":
+		return m.resetToModeSelection()
+	case keys.Reveal:
+		m.revealed = !m.revealed
+	case "up", "k":
+		if m.resultLine > 0 {
+			m.resultLine--
+		}
+	case "down", "j":
+		if m.resultLine < len(m.resultLines())-1 {
+			m.resultLine++
+		}
+	case "pgup":
+		m.resultView.PageUp()
+		return nil
+	case "pgdown":
+		m.resultView.PageDown()
+		return nil
+	case keys.CopyAll:
+		return m.copyResult(m.result, "Result copied to "+m.clipboardTarget())
+	case keys.CopyLine:
+		return m.copyResult(m.resultLines()[m.resultLine], fmt.Sprintf("Line %d copied to %s", m.resultLine+1, m.clipboardTarget()))
+	case keys.Encoding:
+		if m.canReencode() {
+			return m.cycleEncoding()
+		}
+	}
+
+	m.refreshResultView()
+	return nil
+}
+
+// canReencode reports whether the result is native ciphertext this session
+// produced, which is all the encoding key may rewrite.
+func (m *Model) canReencode() bool {
+	encrypted := m.mode == ModeEncrypt || m.mode == ModeEncryptRecipients
+	return encrypted && m.resultInfo.Format == core.FormatNative && m.resultInfo.Envelope != nil
+}
+
+func (m *Model) cycleEncoding() tea.Cmd {
+	current := m.resultInfo.Encoding
+	if current == "armor" {
+		current = core.EncodingBase64
+	}
+
+	encodings := core.Encodings()
+	next := encodings[0]
+	for i, enc := range encodings {
+		if enc.Name == current {
+			next = encodings[(i+1)%len(encodings)]
+		}
+	}
+
+	result, err := m.encodeOutput(m.result, next.Name)
+	if err != nil {
+		m.clipboardErr = err
+		return nil
+	}
+
+	m.result = result
+	m.resultInfo.OutputBytes = len(result)
+	m.resultInfo.Encoding = encodingName(result)
+	m.resultLine = 0
+	m.refreshResultView()
+	return m.copyResult(result, fmt.Sprintf("Re-encoded as %s and copied", m.resultInfo.Encoding))
+}
+
+// encodeOutput writes native ciphertext in the named encoding, as armor
+// when that is configured and the encoding is base64.
+func (m *Model) encodeOutput(ciphertext, name string) (string, error) {
+	enc, err := core.EncodingByName(name)
+	if err != nil {
+		return "", err
+	}
+	if m.config.Armor && enc.Name == core.EncodingBase64 {
+		return core.ArmorCiphertext(ciphertext, time.Now())
+	}
+	return core.EncodeCiphertext(ciphertext, enc)
+}
+
+func encodingName(ciphertext string) string {
+	if core.IsArmored(ciphertext) {
+		return "armor"
+	}
+	enc, _, err := core.SniffEncoding(ciphertext)
+	if err != nil {
+		return ""
+	}
+	return enc.Name
+}
+
+// clipboardTarget names the selections copies go to, for messages.
+func (m Model) clipboardTarget() string {
+	return m.config.Clipboard.Target.Label()
+}
+
+func (m *Model) copyResult(text, notice string) tea.Cmd {
+	m.clipboardErr = m.clipboard.Copy(text)
+	if m.clipboardErr != nil {
+		return nil
+	}
+	m.notice = notice
+	return m.waitForClear()
+}
+
+func (m *Model) waitForClear() tea.Cmd {
+	reporter, ok := m.clipboard.(platform.ClearReporter)
+	if !ok {
+		return nil
+	}
+
+	results := reporter.ClearResults()
+	return func() tea.Msg {
+		return clipboardClearedMsg(<-results)
+	}
+}
+
+func (m *Model) handleClipboardCleared(result platform.ClearResult) {
+	switch result.Outcome {
+	case platform.ClearDone:
+		m.notice = "Clipboard cleared"
+	case platform.ClearSkipped:
+		m.notice = "Clipboard changed since copy; left untouched"
+	default:
+		m.notice = ""
+		m.clipboardErr = result.Err
+	}
+}
+
+func (m *Model) keyNames() []string {
+	names := make([]string, len(m.keyEntries))
+	for i, entry := range m.keyEntries {
+		names[i] = entry.Name
+	}
+	return names
+}
+
+func (m *Model) resultLines() []string {
+	return strings.Split(m.result, "\n")
+}
+
+func (m *Model) refreshResultView() {
+	width := m.layout.CalculateInputWidth(m.terminalSize)
+	m.resultView.Width = width
+	m.resultView.Height = max(m.layout.CalculateTextAreaHeight(m.terminalSize)-4, m.config.MinTextAreaHeight)
+
+	content, top, bottom := m.layout.RenderResultLines(m.resultLines(), m.resultLine, m.revealed, width)
+	m.resultView.SetContent(content)
+
+	if top < m.resultView.YOffset {
+		m.resultView.SetYOffset(top)
+	} else if bottom > m.resultView.YOffset+m.resultView.Height {
+		m.resultView.SetYOffset(bottom - m.resultView.Height)
+	}
+}
+
 func (m *Model) transitionToSecretEntry() {
 	m.state = StateEnterSecret
 	m.textInput.Prompt = ""
@@ -180,22 +715,84 @@ func (m *Model) transitionToSecretEntry() {
 	m.textInput.Reset()
 }
 
-func (m *Model) transitionToTextEntry() {
-	m.state = StateEnterText
-	m.textInput.Prompt = ""
+// transitionAfterKey asks for a context label when the output format can
+// carry one; decryption cannot know the format yet, so it always asks.
+// File modes pick a file instead.
+func (m *Model) transitionAfterKey() tea.Cmd {
+	if m.mode.UsesFiles() {
+		return m.transitionToFileSelection()
+	}
+	if m.format != core.FormatNative {
+		return m.transitionToTextEntry()
+	}
+
+	m.state = StateEnterContext
 	m.textInput.EchoMode = textinput.EchoNormal
 	m.textInput.Reset()
+	m.textInput.Focus()
+	return textinput.Blink
+}
+
+func (m *Model) transitionToKeySelection() {
+	var entries []keystore.Entry
+	var err error
+	if m.mode == ModeDecryptIdentity {
+		entries, err = m.keyStore.Identities()
+	} else {
+		entries, err = m.keyStore.Recipients()
+	}
+	if err == nil && len(entries) == 0 {
+		err = ErrNoKeys
+	}
+	if err != nil {
+		m.state = StateShowError
+		m.lastError = err
+		return
+	}
+
+	m.state = StateSelectKeys
+	m.keyEntries = entries
+	m.keyCursor = 0
+	m.keySelected = nil
+	if m.mode == ModeEncryptRecipients {
+		m.keySelected = make([]bool, len(entries))
+	}
+}
+
+// transitionToTextEntry also peeks at the clipboard when decrypting, to
+// offer pasting ciphertext found there.
+func (m *Model) transitionToTextEntry() tea.Cmd {
+	m.state = StateEnterText
+	m.textInput.Blur()
+	m.textArea.Reset()
+	m.resizeTextArea()
+	m.textArea.Focus()
+	if m.mode == ModeDecrypt || m.mode == ModeDecryptIdentity {
+		return tea.Batch(textarea.Blink, m.peekClipboard())
+	}
+	return textarea.Blink
+}
+
+func (m *Model) resizeTextArea() {
+	m.textArea.SetWidth(m.layout.CalculateInputWidth(m.terminalSize))
+	m.textArea.SetHeight(m.layout.CalculateTextAreaHeight(m.terminalSize))
 }
 
-func (m *Model) processInput(inputText string) {
+func (m *Model) processInput(inputText string) tea.Cmd {
 	var result string
 	var err error
 
 	switch m.mode {
-	case ModeEncrypt:
-		result, err = m.cryptor.Encrypt(inputText)
-	case ModeDecrypt:
-		result, err = m.cryptor.Decrypt(inputText)
+	case ModeEncrypt, ModeEncryptRecipients:
+		result, err = core.EncryptContext(m.cryptor, inputText, m.context)
+		if err == nil && m.format == core.FormatNative && (m.config.Armor || m.config.Encoding != core.EncodingBase64) {
+			result, err = m.encodeOutput(result, m.config.Encoding)
+		}
+	case ModeDecrypt, ModeDecryptIdentity:
+		var cryptor core.Cryptor
+		if cryptor, err = m.decryptorFor(core.DetectFormat(inputText)); err == nil {
+			result, err = core.DecryptContext(cryptor, inputText, m.context)
+		}
 	default:
 		err = &AppError{Op: "process_input", Err: ErrInvalidOperation}
 	}
@@ -203,21 +800,38 @@ func (m *Model) processInput(inputText string) {
 	if err != nil {
 		m.state = StateShowError
 		m.lastError = err
-	} else {
-		m.result = result
-		_ = platform.CopyToClipboard(result)
-		m.state = StateShowResult
+		return nil
 	}
+
+	m.result = result
+	m.resultInfo = ResultInfo{InputBytes: len(inputText), OutputBytes: len(result)}
+	ciphertext := result
+	if m.mode == ModeDecrypt || m.mode == ModeDecryptIdentity {
+		ciphertext = inputText
+	}
+	m.resultInfo.Format = core.DetectFormat(ciphertext)
+	switch m.resultInfo.Format {
+	case core.FormatNative:
+		m.resultInfo.Envelope, _ = core.InspectCiphertext(ciphertext)
+		m.resultInfo.Encoding = encodingName(ciphertext)
+	case core.FormatOpenSSL:
+		m.resultInfo.OpenSSL = m.config.OpenSSL
+	}
+
+	m.state = StateShowResult
+	m.refreshResultView()
+	return m.copyResult(result, "")
 }
 
 func (m *Model) handleClipboardClear(msg tea.KeyMsg) tea.Cmd {
-	_ = platform.ClearClipboard()
+	_ = m.clipboard.Copy("")
 	return m.resetToModeSelection()
 }
 
 func (m *Model) resetToModeSelection() tea.Cmd {
-	newModel := NewWithConfig(m.config)
+	newModel := NewWithConfig(m.config, WithClipboard(m.clipboard), WithDetector(m.detector), WithCryptorFactory(m.newCryptor), WithKeyStore(m.keyStore), WithClipboardDiagnoser(m.diagnose))
 	newModel.terminalSize = m.terminalSize
+	newModel.vault = m.vault
 	*m = newModel
 	return nil
 }
@@ -227,35 +841,84 @@ func (m Model) View() string {
 
 	switch m.state {
 	case StateSelectMode:
-		content = m.layout.RenderModeSelection(m.cursor, m.availableModes)
+		content = m.layout.RenderModeSelection(m.cursor, ModeLabels(m.availableModes))
 
 	case StateEnterSecret:
 		inputWidth := m.layout.CalculateInputWidth(m.terminalSize)
 		m.textInput.Width = inputWidth
 		inputView := m.layout.CreateStyledInput(m.textInput.View(), inputWidth)
-		content = m.layout.RenderInputPrompt("Enter Secret Key:", inputView, "enter: confirm , ctrl+c: quit")
+		title := "Enter Secret Key:"
+		if m.mode == ModeVault {
+			title = "Enter Master Passphrase:"
+			if m.newVault != nil {
+				title = "Repeat Master Passphrase:"
+			}
+		}
+		helpText := fmt.Sprintf("enter: confirm , %s: add keyfile , %s: paste , ctrl+c: quit", m.config.Keys.Keyfile, m.config.Keys.Paste)
+		content = m.layout.RenderInputPrompt(title, inputView, helpText)
+		content += m.layout.RenderSecretFactors(m.keyfileNames(), m.config.Challenge)
+		content += m.layout.RenderPasteStatus(m.notice, m.clipboardErr)
 		content += m.layout.RenderInputState(m.inputState)
 
-	case StateEnterText:
+	case StateSelectKeyfile:
+		content = m.layout.RenderInputPrompt("Select Keyfile:", m.keyfilePicker.View(), "enter: select , left/right: directory , esc: back")
+
+	case StateSelectKeys:
+		title := "Select recipients:"
+		helpText := "up/down: navigate , space: toggle , enter: confirm , esc: back"
+		if m.mode == ModeDecryptIdentity {
+			title = "Select identity:"
+			helpText = "up/down: navigate , enter: select , esc: back"
+		}
+		content = m.layout.RenderKeySelection(title, m.keyNames(), m.keyCursor, m.keySelected, helpText)
+
+	case StateEnterContext:
 		inputWidth := m.layout.CalculateInputWidth(m.terminalSize)
 		m.textInput.Width = inputWidth
 		inputView := m.layout.CreateStyledInput(m.textInput.View(), inputWidth)
-		title := fmt.Sprintf("Enter Text to %s:", m.mode.String())
-		content = m.layout.RenderInputPrompt(title, inputView, "enter: confirm , ctrl+c: quit")
+		title := "Context Label (optional):"
+		if m.mode == ModeDecrypt || m.mode == ModeDecryptIdentity {
+			title = "Expected Context Label (optional):"
+		}
+		helpText := fmt.Sprintf("enter: confirm (empty for none) , %s: paste , ctrl+c: quit", m.config.Keys.Paste)
+		content = m.layout.RenderInputPrompt(title, inputView, helpText)
+		content += m.layout.RenderPasteStatus(m.notice, m.clipboardErr)
+
+	case StateEnterText:
+		inputWidth := m.layout.CalculateInputWidth(m.terminalSize)
+		inputView := m.layout.CreateStyledInput(m.textArea.View(), inputWidth)
+		title := fmt.Sprintf("Enter Text to %s:", m.availableModes[m.cursor].Label)
+		helpText := fmt.Sprintf("%s: confirm , enter: new line , %s: paste , ctrl+c: quit", m.config.Keys.Submit, m.config.Keys.Paste)
+		content = m.layout.RenderInputPrompt(title, inputView, helpText)
+		if m.offer != "" && m.textArea.Value() == "" {
+			content += m.layout.RenderClipboardOffer(core.DetectFormat(m.offer).String(), clipboardPreview(m.offer), utf8.RuneCountInString(m.offer))
+		}
+		content += m.layout.RenderPasteStatus(m.notice, m.clipboardErr)
 
 	case StateShowResult:
-		message := "Success! Result copied to clipboard"
-		details := fmt.Sprintf("Result length: %d characters", len(m.result))
-		content = m.layout.RenderResult(true, message, details)
+		message := "Success! Result copied to " + m.clipboardTarget()
+		if m.clipboardErr != nil {
+			message = "Success!"
+		}
+		content = m.layout.RenderResultViewer(message, m.resultInfo.String(), m.resultInfo.Warning(), m.resultView.View(), m.notice, m.canReencode(), m.clipboardErr)
 
 	case StateShowError:
 		message := fmt.Sprintf("Error: %v", m.lastError)
-		content = m.layout.RenderResult(false, message, "")
+		content = m.layout.RenderResult(false, message, ErrorHint(m.lastError))
 
 	case StateWaitingToClear:
-		message := "Success! Result copied to clipboard"
-		details := "Press any key to clear clipboard and continue"
+		message := "Success! Result copied to " + m.clipboardTarget()
+		details := fmt.Sprintf("Press any key to clear %s and continue", m.clipboardTarget())
 		content = m.layout.RenderResult(true, message, details)
+
+	case StateVaultList, StateVaultEdit:
+		content = m.viewVault()
+
+	case StateDiagnostics:
+		content = m.viewDiagnostics()
+
+	case StateSelectFile, StateEnterOutput, StateFileProgress:
+		content = m.viewFiles()
 	}
 
 	return m.layout.RenderApp(content)
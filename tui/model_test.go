@@ -0,0 +1,1002 @@
+package tui
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/filecrypt"
+	"txt-encdec-cli/platform"
+	"txt-encdec-cli/vault"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/muesli/termenv"
+)
+
+func TestMain(m *testing.M) {
+	lipgloss.SetColorProfile(termenv.Ascii)
+	os.Exit(m.Run())
+}
+
+type harness struct {
+	t         *testing.T
+	model     Model
+	clipboard *fakeClipboard
+	detector  *fakeDetector
+	keys      *fakeKeyStore
+	diagnoser *fakeDiagnoser
+}
+
+func newHarness(t *testing.T, config AppConfig, factory CryptorFactory) *harness {
+	t.Helper()
+
+	h := &harness{
+		t:         t,
+		clipboard: &fakeClipboard{},
+		detector:  &fakeDetector{},
+		keys:      newFakeKeyStore(),
+		diagnoser: &fakeDiagnoser{},
+	}
+	h.model = NewWithConfig(config,
+		WithClipboard(h.clipboard),
+		WithDetector(h.detector),
+		WithCryptorFactory(factory),
+		WithKeyStore(h.keys),
+		WithClipboardDiagnoser(h.diagnoser.diagnose),
+	)
+	h.send(tea.WindowSizeMsg{Width: 80, Height: 30})
+	return h
+}
+
+func (h *harness) send(msgs ...tea.Msg) {
+	h.t.Helper()
+	for _, msg := range msgs {
+		next, _ := h.model.Update(msg)
+		h.model = next.(Model)
+	}
+}
+
+func (h *harness) press(keys ...tea.KeyType) {
+	h.t.Helper()
+	for _, key := range keys {
+		h.send(tea.KeyMsg{Type: key})
+	}
+}
+
+func (h *harness) typeText(text string) {
+	h.t.Helper()
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)})
+}
+
+// paste presses the paste key and delivers the clipboard read it starts.
+func (h *harness) paste() {
+	h.t.Helper()
+	next, cmd := h.model.Update(tea.KeyMsg{Type: tea.KeyCtrlV})
+	h.model = next.(Model)
+	if cmd == nil {
+		h.t.Fatal("paste key did not read the clipboard")
+	}
+	h.send(cmd())
+}
+
+func (h *harness) requireState(want AppState) {
+	h.t.Helper()
+	if h.model.state != want {
+		h.t.Fatalf("state = %s, want %s (error: %v)", h.model.state, want, h.model.lastError)
+	}
+}
+
+func (h *harness) golden(name string) {
+	h.t.Helper()
+	h.t.Run(name, func(t *testing.T) {
+		golden.RequireEqual(t, h.model.View())
+	})
+}
+
+func (h *harness) selectMode(mode OperationMode) {
+	h.t.Helper()
+	for h.model.availableModes[h.model.cursor].Mode != mode {
+		h.press(tea.KeyDown)
+	}
+	h.press(tea.KeyEnter)
+}
+
+func (h *harness) selectOption(mode OperationMode, format core.Format) {
+	h.t.Helper()
+	for option := h.model.availableModes[h.model.cursor]; option.Mode != mode || option.Format != format; option = h.model.availableModes[h.model.cursor] {
+		h.press(tea.KeyDown)
+	}
+	h.press(tea.KeyEnter)
+}
+
+func (h *harness) enterSecret(mode OperationMode, secret string) {
+	h.t.Helper()
+	h.selectMode(mode)
+	h.typeText(secret)
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterContext)
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterText)
+}
+
+func TestEncryptFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.golden("select_mode")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterSecret)
+	h.typeText("pw")
+	h.golden("enter_secret")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterContext)
+	h.golden("enter_context")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterText)
+	h.typeText("hello")
+	h.press(tea.KeyEnter)
+	h.typeText("world")
+	h.golden("enter_text")
+
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	h.golden("result_masked")
+
+	want := "ENC[pw:hello\nworld]"
+	if len(h.clipboard.copies) != 1 || h.clipboard.copies[0] != want {
+		t.Fatalf("clipboard copies = %q, want [%q]", h.clipboard.copies, want)
+	}
+
+	h.typeText("r")
+	h.golden("result_revealed")
+
+	h.press(tea.KeyDown)
+	h.typeText("y")
+	if h.clipboard.content != "world]" {
+		t.Fatalf("clipboard = %q, want selected line %q", h.clipboard.content, "world]")
+	}
+	h.golden("result_line_copied")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateSelectMode)
+}
+
+func TestDecryptFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.typeText("ENC[pw:top secret]")
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "top secret" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "top secret")
+	}
+	h.golden("result")
+}
+
+func TestDecryptWrongSecret(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.enterSecret(ModeDecrypt, "nope")
+	h.typeText("ENC[pw:top secret]")
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrDecryptionFailed) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrDecryptionFailed)
+	}
+	if len(h.clipboard.copies) != 0 {
+		t.Fatalf("clipboard copies = %q, want none", h.clipboard.copies)
+	}
+	h.golden("error")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateSelectMode)
+}
+
+func TestClipboardTargetIsShown(t *testing.T) {
+	config := DefaultConfig()
+	config.Clipboard.Target = platform.TargetBoth
+	h := newHarness(t, config, newFakeCryptor)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.typeText("ENC[pw:top secret]")
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	h.golden("result")
+
+	h.typeText("r")
+	h.typeText("y")
+	if h.model.notice != "Line 1 copied to clipboard and primary selection" {
+		t.Fatalf("notice = %q", h.model.notice)
+	}
+}
+
+func TestDiagnosticsFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.selectMode(ModeDiagnostics)
+	h.requireState(StateDiagnostics)
+	h.golden("running")
+
+	h.typeText("r")
+	h.send(h.model.runDiagnostics()())
+	h.golden("findings")
+	if h.diagnoser.runs != 1 {
+		t.Fatalf("diagnoser ran %d times, want 1", h.diagnoser.runs)
+	}
+
+	stale := h.model.runDiagnostics()
+	h.press(tea.KeyEsc)
+	h.requireState(StateSelectMode)
+	h.send(stale())
+	h.requireState(StateSelectMode)
+	if h.model.diagnostics != nil {
+		t.Fatal("findings for a screen that was left were kept")
+	}
+}
+
+func TestClipboardFailureIsShown(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.clipboard.err = platform.ErrNoClipboardTool
+	h.enterSecret(ModeEncrypt, "pw")
+	h.typeText("hello")
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if !errors.Is(h.model.clipboardErr, platform.ErrNoClipboardTool) {
+		t.Fatalf("clipboardErr = %v, want %v", h.model.clipboardErr, platform.ErrNoClipboardTool)
+	}
+	h.golden("result")
+}
+
+func TestCapsLockIndicator(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.detector.capsLock = true
+	h.press(tea.KeyEnter)
+	h.typeText("PW")
+	h.golden("enter_secret")
+}
+
+func TestRoundTripWithAESCryptor(t *testing.T) {
+	config := DefaultConfig()
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+
+	h := newHarness(t, config, factory)
+	h.enterSecret(ModeEncrypt, "pw")
+	h.typeText("line one")
+	h.press(tea.KeyEnter)
+	h.typeText("line two")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	ciphertext := h.clipboard.content
+
+	h.press(tea.KeyEnter)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if want := "line one\nline two"; h.clipboard.content != want {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, want)
+	}
+}
+
+func TestClipboardPaste(t *testing.T) {
+	config := DefaultConfig()
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+
+	h := newHarness(t, config, factory)
+	h.enterSecret(ModeEncrypt, "pw")
+	h.typeText("from the clipboard")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	ciphertext := h.clipboard.content
+
+	h.press(tea.KeyEnter)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(h.model.peekClipboard()())
+	if h.model.offer != ciphertext {
+		t.Fatalf("offer = %q, want the ciphertext %q", h.model.offer, ciphertext)
+	}
+	h.paste()
+	if h.model.textArea.Value() != ciphertext {
+		t.Fatalf("text = %q, want %q", h.model.textArea.Value(), ciphertext)
+	}
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	if want := "from the clipboard"; h.clipboard.content != want {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, want)
+	}
+
+	h.press(tea.KeyEnter)
+	h.clipboard.content = "a shopping list"
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(h.model.peekClipboard()())
+	if h.model.offer != "" {
+		t.Fatalf("offered to paste %q", h.model.offer)
+	}
+}
+
+func TestClipboardPasteScreens(t *testing.T) {
+	config := DefaultConfig()
+	config.TextCharLimit = 32
+	h := newHarness(t, config, newFakeCryptor)
+
+	h.clipboard.content = "-----BEGIN AGE ENCRYPTED FILE-----\nYWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IHNjcnlwdCBzYWx0\n-----END AGE ENCRYPTED FILE-----\n"
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(h.model.peekClipboard()())
+	h.golden("offer")
+
+	h.paste()
+	if h.model.textArea.Value() != "" {
+		t.Fatalf("pasted %q past the character limit", h.model.textArea.Value())
+	}
+	if !errors.Is(h.model.clipboardErr, ErrPasteTooLong) {
+		t.Fatalf("paste error = %v, want %v", h.model.clipboardErr, ErrPasteTooLong)
+	}
+	h.golden("too_long")
+
+	h.model.resetToModeSelection()
+	h.clipboard.content = "staging/db\n"
+	h.selectMode(ModeEncrypt)
+	h.typeText("pw")
+	h.press(tea.KeyEnter)
+	h.paste()
+	if h.model.textInput.Value() != "staging/db" {
+		t.Fatalf("context = %q, want %q", h.model.textInput.Value(), "staging/db")
+	}
+	h.golden("context")
+
+	_, read := h.model.Update(tea.KeyMsg{Type: tea.KeyCtrlV})
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterText)
+	h.send(read())
+	if h.model.textArea.Value() != "" {
+		t.Fatalf("a paste meant for the context screen reached the text: %q", h.model.textArea.Value())
+	}
+}
+
+func TestOSC52ClipboardIsNotRead(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.model.clipboard = platform.NewOSC52ClipboardManager(platform.DefaultClipboardOptions())
+	h.enterSecret(ModeDecrypt, "pw")
+	if h.model.peekClipboard() != nil {
+		t.Fatal("peekClipboard queries the terminal over OSC 52")
+	}
+
+	next, cmd := h.model.Update(tea.KeyMsg{Type: tea.KeyCtrlV})
+	h.model = next.(Model)
+	if cmd != nil {
+		t.Fatal("the paste key queries the terminal over OSC 52")
+	}
+	if !errors.Is(h.model.clipboardErr, ErrPasteTerminal) {
+		t.Fatalf("paste error = %v, want %v", h.model.clipboardErr, ErrPasteTerminal)
+	}
+	h.golden("paste_with_terminal")
+}
+
+func TestEncryptWithSelectedSuite(t *testing.T) {
+	config := DefaultConfig()
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+
+	for i, option := range BuildModeOptions(config.Cipher) {
+		if option.Mode != ModeEncrypt || option.Format != core.FormatNative {
+			continue
+		}
+		t.Run(option.Algorithm.String(), func(t *testing.T) {
+			h := newHarness(t, config, factory)
+			for range i {
+				h.press(tea.KeyDown)
+			}
+			h.press(tea.KeyEnter)
+			h.typeText("pw")
+			h.press(tea.KeyEnter, tea.KeyEnter)
+			h.typeText("hello")
+			h.press(tea.KeyCtrlD)
+			h.requireState(StateShowResult)
+
+			env, err := core.InspectCiphertext(h.clipboard.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if env.Algorithm != option.Algorithm {
+				t.Fatalf("envelope algorithm = %s, want %s", env.Algorithm, option.Algorithm)
+			}
+		})
+	}
+}
+
+func TestEncryptToRecipientsFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.keys = newFakeKeyStore("alice", "bob", "carol")
+	h.model.keyStore = h.keys
+
+	h.selectMode(ModeEncryptRecipients)
+	h.requireState(StateSelectKeys)
+	h.typeText(" ")
+	h.press(tea.KeyDown, tea.KeyDown)
+	h.typeText(" ")
+	h.golden("select_recipients")
+
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterContext)
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterText)
+	h.typeText("for the team")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	h.golden("result")
+
+	ciphertext := h.clipboard.content
+	env, err := core.InspectCiphertext(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Recipients) != 2 {
+		t.Fatalf("envelope has %d recipient stanzas, want 2", len(env.Recipients))
+	}
+
+	for _, name := range []string{"alice", "carol"} {
+		h.press(tea.KeyEnter)
+		h.selectMode(ModeDecryptIdentity)
+		h.requireState(StateSelectKeys)
+		for h.model.keyEntries[h.model.keyCursor].Name != name {
+			h.press(tea.KeyDown)
+		}
+		h.press(tea.KeyEnter, tea.KeyEnter)
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+		h.press(tea.KeyCtrlD)
+
+		h.requireState(StateShowResult)
+		if h.clipboard.content != "for the team" {
+			t.Fatalf("%s decrypted %q, want %q", name, h.clipboard.content, "for the team")
+		}
+	}
+
+	h.press(tea.KeyEnter)
+	h.selectMode(ModeDecryptIdentity)
+	h.press(tea.KeyDown)
+	h.golden("select_identity")
+	h.press(tea.KeyEnter, tea.KeyEnter)
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrNoMatchingIdentity) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrNoMatchingIdentity)
+	}
+	h.golden("wrong_identity")
+}
+
+func TestEmptyKeyStore(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.selectMode(ModeEncryptRecipients)
+
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, ErrNoKeys) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, ErrNoKeys)
+	}
+	h.golden("error")
+}
+
+func TestAgePassphraseFlow(t *testing.T) {
+	config := DefaultConfig()
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	h := newHarness(t, config, newFakeCryptor)
+
+	h.selectOption(ModeEncrypt, core.FormatAge)
+	h.typeText("pw")
+	h.press(tea.KeyEnter)
+	h.typeText("hello age")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	if h.model.resultInfo.Format != core.FormatAge {
+		t.Fatalf("result format = %s, want %s", h.model.resultInfo.Format, core.FormatAge)
+	}
+	ciphertext := h.clipboard.content
+
+	h.press(tea.KeyEnter)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hello age" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hello age")
+	}
+}
+
+func TestAgeRecipientsFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+	h.keys = newFakeKeyStore("alice", "bob")
+	h.model.keyStore = h.keys
+
+	h.selectOption(ModeEncryptRecipients, core.FormatAge)
+	h.requireState(StateSelectKeys)
+	h.press(tea.KeyDown, tea.KeyEnter)
+	h.typeText("for bob")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	ciphertext := h.clipboard.content
+	if core.DetectFormat(ciphertext) != core.FormatAge {
+		t.Fatalf("output is not age:\n%s", ciphertext)
+	}
+
+	h.press(tea.KeyEnter)
+	h.selectMode(ModeDecryptIdentity)
+	h.press(tea.KeyDown, tea.KeyEnter, tea.KeyEnter)
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "for bob" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "for bob")
+	}
+}
+
+func TestOpenSSLDecryptFlow(t *testing.T) {
+	h := newHarness(t, DefaultConfig(), newFakeCryptor)
+
+	// printf 'hello openssl' | openssl enc -aes-256-cbc -pbkdf2 -salt -base64 -pass pass:secret
+	h.enterSecret(ModeDecrypt, "secret")
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("U2FsdGVkX19Y3DFxcYk1lIi3rQEUeb7K++fK/rTZ970=\n"), Paste: true})
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hello openssl" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hello openssl")
+	}
+	h.golden("result")
+
+	h.press(tea.KeyEnter)
+	h.selectOption(ModeEncrypt, core.FormatOpenSSL)
+	h.typeText("secret")
+	h.press(tea.KeyEnter)
+	h.typeText("hello again")
+	h.press(tea.KeyCtrlD)
+
+	h.requireState(StateShowResult)
+	if core.DetectFormat(h.clipboard.content) != core.FormatOpenSSL {
+		t.Fatalf("output is not openssl enc:\n%s", h.clipboard.content)
+	}
+	if h.model.resultInfo.Warning() == "" {
+		t.Fatal("openssl result carries no warning")
+	}
+}
+
+func TestContextLabelFlow(t *testing.T) {
+	config := DefaultConfig()
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	h.selectMode(ModeEncrypt)
+	h.typeText("pw")
+	h.press(tea.KeyEnter)
+	h.typeText("staging/db")
+	h.press(tea.KeyEnter)
+	h.typeText("hunter2")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	ciphertext := h.clipboard.content
+
+	decrypt := func(context string) {
+		h.t.Helper()
+		h.press(tea.KeyEnter)
+		h.selectMode(ModeDecrypt)
+		h.typeText("pw")
+		h.press(tea.KeyEnter)
+		h.requireState(StateEnterContext)
+		h.typeText(context)
+		h.press(tea.KeyEnter)
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+		h.press(tea.KeyCtrlD)
+	}
+
+	decrypt("")
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hunter2" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hunter2")
+	}
+	if !strings.Contains(h.model.View(), `context "staging/db"`) {
+		t.Fatal("result does not show the context label")
+	}
+
+	decrypt("prod/db")
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrContextMismatch) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrContextMismatch)
+	}
+	h.golden("mismatch")
+}
+
+func TestArmoredFlow(t *testing.T) {
+	config := DefaultConfig()
+	config.Armor = true
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	h.enterSecret(ModeEncrypt, "pw")
+	h.typeText("hello armor")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	armored := h.clipboard.content
+	if !strings.HasPrefix(armored, core.ArmorBegin+"\n") {
+		t.Fatalf("result is not armored:\n%s", armored)
+	}
+	h.typeText("e")
+	if h.model.resultInfo.Encoding != core.EncodingBase64URL {
+		t.Fatalf("encoding after cycling from armor = %q, want %q", h.model.resultInfo.Encoding, core.EncodingBase64URL)
+	}
+
+	paste := func(text string) {
+		h.t.Helper()
+		h.press(tea.KeyEnter)
+		h.enterSecret(ModeDecrypt, "pw")
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text), Paste: true})
+		h.press(tea.KeyCtrlD)
+	}
+
+	paste("alice: see below\n> " + strings.ReplaceAll(armored, "\n", "\n> ") + "\n")
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hello armor" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hello armor")
+	}
+
+	paste(strings.Replace(armored, "\n=", "x\n=", 1))
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrDamagedArmor) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrDamagedArmor)
+	}
+	h.golden("damaged")
+}
+
+func TestEncodingFlow(t *testing.T) {
+	config := DefaultConfig()
+	config.Encoding = core.EncodingHex
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	h.enterSecret(ModeEncrypt, "pw")
+	h.typeText("hello encodings")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	if h.model.resultInfo.Encoding != core.EncodingHex {
+		t.Fatalf("encoding = %q, want %q", h.model.resultInfo.Encoding, core.EncodingHex)
+	}
+
+	h.typeText("e")
+	if h.model.resultInfo.Encoding != core.EncodingZ85 {
+		t.Fatalf("encoding after cycling = %q, want %q", h.model.resultInfo.Encoding, core.EncodingZ85)
+	}
+	h.golden("reencoded")
+	z85 := h.clipboard.content
+
+	h.press(tea.KeyEnter)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(z85), Paste: true})
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hello encodings" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hello encodings")
+	}
+
+	h.press(tea.KeyEnter)
+	h.enterSecret(ModeDecrypt, "pw")
+	h.typeText("dead~beef")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrInvalidEncoding) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrInvalidEncoding)
+	}
+}
+
+func TestKeyfileFlow(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.key": "first keyfile", "b.key": "second keyfile"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := DefaultConfig()
+	config.KeyfileDir = dir
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	pickKeyfile := func() {
+		h.t.Helper()
+		h.press(tea.KeyCtrlO)
+		h.requireState(StateSelectKeyfile)
+		h.send(h.model.keyfilePicker.Init()())
+	}
+
+	h.selectMode(ModeEncrypt)
+	h.typeText("pw")
+	pickKeyfile()
+	h.golden("select_keyfile")
+	h.press(tea.KeyDown, tea.KeyEnter)
+	h.requireState(StateEnterSecret)
+	h.golden("enter_secret")
+
+	h.press(tea.KeyEnter, tea.KeyEnter)
+	h.typeText("hello keyfile")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateShowResult)
+	ciphertext := h.clipboard.content
+
+	decrypt := func(withKeyfile bool) {
+		h.t.Helper()
+		h.press(tea.KeyEnter)
+		h.selectMode(ModeDecrypt)
+		h.typeText("pw")
+		if withKeyfile {
+			pickKeyfile()
+			h.press(tea.KeyDown, tea.KeyEnter)
+		}
+		h.press(tea.KeyEnter, tea.KeyEnter)
+		h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(ciphertext), Paste: true})
+		h.press(tea.KeyCtrlD)
+	}
+
+	decrypt(false)
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrDecryptionFailed) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrDecryptionFailed)
+	}
+
+	decrypt(true)
+	h.requireState(StateShowResult)
+	if h.clipboard.content != "hello keyfile" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hello keyfile")
+	}
+}
+
+func TestVaultFlow(t *testing.T) {
+	config := DefaultConfig()
+	config.VaultPath = filepath.Join(t.TempDir(), vault.FileName)
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	unlock := func(passphrase string) {
+		h.t.Helper()
+		h.selectMode(ModeVault)
+		h.requireState(StateEnterSecret)
+		h.typeText(passphrase)
+		h.press(tea.KeyEnter)
+	}
+
+	unlock("master")
+	h.requireState(StateEnterSecret)
+	h.golden("repeat_passphrase")
+	h.typeText("mister")
+	h.press(tea.KeyEnter)
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, ErrPassphraseMismatch) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, ErrPassphraseMismatch)
+	}
+	if _, err := os.Stat(config.VaultPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("mismatched passphrases created the vault: %v", err)
+	}
+
+	h.press(tea.KeyEnter)
+	unlock("master")
+	h.typeText("master")
+	h.press(tea.KeyEnter)
+	h.requireState(StateVaultList)
+	h.golden("empty")
+	h.model.vault.vault.Now = func() time.Time { return time.Date(2026, 10, 17, 9, 0, 0, 0, time.Local) }
+
+	h.press(tea.KeyCtrlN)
+	h.requireState(StateVaultEdit)
+	h.typeText("db")
+	h.press(tea.KeyEnter)
+	h.typeText("hunter2")
+	h.press(tea.KeyTab)
+	h.typeText("prod, sql")
+	h.press(tea.KeyEnter)
+	h.typeText("primary")
+	h.golden("add_entry")
+	h.press(tea.KeyEnter)
+	h.requireState(StateVaultList)
+
+	h.press(tea.KeyCtrlN)
+	h.typeText("api")
+	h.press(tea.KeyTab)
+	h.typeText("tok")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateVaultList)
+	h.golden("list")
+
+	h.typeText("prod")
+	h.press(tea.KeyEnter)
+	if h.clipboard.content != "hunter2" {
+		t.Fatalf("clipboard = %q, want %q", h.clipboard.content, "hunter2")
+	}
+	h.golden("search")
+	h.press(tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace)
+
+	h.press(tea.KeyCtrlE)
+	h.requireState(StateVaultEdit)
+	h.press(tea.KeyTab, tea.KeyBackspace, tea.KeyBackspace, tea.KeyBackspace)
+	h.typeText("tok2")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateVaultList)
+	if e, err := h.model.vault.vault.Get("api"); err != nil || e.Secret != "tok2" {
+		t.Fatalf("edited entry = %+v, %v", e, err)
+	}
+
+	h.press(tea.KeyCtrlN)
+	h.typeText("db")
+	h.press(tea.KeyTab)
+	h.typeText("x")
+	h.press(tea.KeyCtrlD)
+	h.requireState(StateVaultEdit)
+	if !errors.Is(h.model.vault.formErr, vault.ErrEntryExists) {
+		t.Fatalf("formErr = %v, want %v", h.model.vault.formErr, vault.ErrEntryExists)
+	}
+	h.golden("duplicate")
+	h.press(tea.KeyEsc)
+
+	h.press(tea.KeyCtrlX)
+	h.golden("confirm_delete")
+	h.press(tea.KeyCtrlX)
+	if names := h.model.vaultItems(); len(names) != 1 || names[0] != "db  [prod, sql]" {
+		t.Fatalf("entries after delete = %q", names)
+	}
+
+	h.press(tea.KeyEsc)
+	h.requireState(StateSelectMode)
+	h.selectMode(ModeVault)
+	h.requireState(StateVaultList)
+
+	h.model.vault.lastActive = time.Now().Add(-time.Hour)
+	h.send(vaultLockMsg{session: h.model.vault})
+	h.requireState(StateSelectMode)
+	if h.model.vault != nil {
+		t.Fatal("vault still unlocked after auto-lock")
+	}
+
+	unlock("wrong")
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrDecryptionFailed) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrDecryptionFailed)
+	}
+
+	h.press(tea.KeyEnter)
+	unlock("master")
+	h.requireState(StateVaultList)
+	if names := h.model.vaultItems(); len(names) != 1 {
+		t.Fatalf("entries after reopening = %q", names)
+	}
+}
+
+func TestFileFlow(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "notes.txt")
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.WriteFile(src, []byte("file contents"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.FileDir = dir
+	config.KDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+	factory := func(secret string, algorithm core.AlgorithmID) core.Cryptor {
+		return core.NewCryptor(secret, algorithm, config.KDF)
+	}
+	h := newHarness(t, config, factory)
+
+	pickFile := func(mode OperationMode, secret string, down int) {
+		h.t.Helper()
+		h.selectMode(mode)
+		h.typeText(secret)
+		h.press(tea.KeyEnter)
+		h.requireState(StateSelectFile)
+		h.send(h.model.filePicker.Init()())
+		for range down {
+			h.press(tea.KeyDown)
+		}
+		h.press(tea.KeyEnter)
+		h.requireState(StateEnterOutput)
+	}
+	finish := func() {
+		h.t.Helper()
+		for {
+			msg := h.model.waitForFileUpdate()()
+			h.send(msg)
+			if _, ok := msg.(fileDoneMsg); ok {
+				return
+			}
+		}
+	}
+
+	h.selectMode(ModeEncryptFile)
+	h.typeText("pw")
+	h.press(tea.KeyEnter)
+	h.send(h.model.filePicker.Init()())
+	h.golden("select_file")
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterOutput)
+	if want := src + filecrypt.Ext; h.model.textInput.Value() != want {
+		t.Fatalf("output path = %q, want %q", h.model.textInput.Value(), want)
+	}
+	h.press(tea.KeyEnter)
+	h.requireState(StateFileProgress)
+	h.send(fileProgressMsg{done: 512, total: 2048})
+	h.golden("progress")
+	finish()
+	h.requireState(StateFileProgress)
+	if !h.model.fileJob.finished {
+		t.Fatal("file job not finished")
+	}
+	if _, err := os.Stat(src + filecrypt.Ext); err != nil {
+		t.Fatal(err)
+	}
+
+	h.press(tea.KeyEnter)
+	pickFile(ModeDecryptFile, "wrong", 1)
+	h.press(tea.KeyEnter)
+	h.requireState(StateEnterOutput)
+	if !strings.Contains(h.model.View(), "press enter again to overwrite") {
+		t.Fatal("existing output was not flagged")
+	}
+	h.press(tea.KeyEnter)
+	finish()
+	h.requireState(StateShowError)
+	if !errors.Is(h.model.lastError, core.ErrDecryptionFailed) {
+		t.Fatalf("lastError = %v, want %v", h.model.lastError, core.ErrDecryptionFailed)
+	}
+
+	if err := os.WriteFile(src, []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h.press(tea.KeyEnter)
+	pickFile(ModeDecryptFile, "pw", 1)
+	h.press(tea.KeyEnter, tea.KeyEnter)
+	finish()
+	h.requireState(StateFileProgress)
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "file contents" || info.Mode().Perm() != 0o640 || !info.ModTime().Equal(mtime) {
+		t.Fatalf("decrypted file = %q, %v, %v", data, info.Mode().Perm(), info.ModTime())
+	}
+}
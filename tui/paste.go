@@ -0,0 +1,154 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/platform"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// clipboardPeekMsg carries what the clipboard held when Decrypt reached
+// its text screen.
+type clipboardPeekMsg struct {
+	text string
+}
+
+// clipboardPasteMsg carries the clipboard read the paste key started on
+// state's screen.
+type clipboardPasteMsg struct {
+	state AppState
+	text  string
+	err   error
+}
+
+// readsTerminal reports whether reading the clipboard means an OSC 52
+// query, whose reply comes in on the terminal Bubble Tea is reading keys
+// from and could be taken for typing. Such a clipboard is never read.
+func (m *Model) readsTerminal() bool {
+	_, ok := m.clipboard.(*platform.OSC52ClipboardManager)
+	return ok
+}
+
+// peekClipboard reads the clipboard off the UI goroutine; a slow or
+// missing clipboard tool just means no offer.
+func (m *Model) peekClipboard() tea.Cmd {
+	if m.readsTerminal() {
+		return nil
+	}
+	clipboard := m.clipboard
+	return func() tea.Msg {
+		text, err := clipboard.Read()
+		if err != nil {
+			return clipboardPeekMsg{}
+		}
+		return clipboardPeekMsg{text: text}
+	}
+}
+
+func (m *Model) handleClipboardPeek(msg clipboardPeekMsg) {
+	if m.state != StateEnterText || m.textArea.Value() != "" || !looksLikeCiphertext(msg.text) {
+		return
+	}
+	m.offer = strings.TrimRight(msg.text, "\r\n")
+}
+
+// looksLikeCiphertext accepts age and openssl text by their prefixes and
+// native text only when its envelope header parses.
+func looksLikeCiphertext(text string) bool {
+	if strings.TrimSpace(text) == "" {
+		return false
+	}
+	if core.DetectFormat(text) != core.FormatNative {
+		return true
+	}
+	_, err := core.InspectCiphertext(text)
+	return err == nil
+}
+
+// canPaste reports whether the current screen has a text field for the
+// paste key to fill.
+func (m *Model) canPaste() bool {
+	switch m.state {
+	case StateEnterSecret, StateEnterContext, StateEnterText, StateVaultList, StateVaultEdit, StateEnterOutput:
+		return true
+	}
+	return false
+}
+
+// readClipboard reads the clipboard for the paste key off the UI
+// goroutine, or leaves pasting to the terminal when that would query it.
+func (m *Model) readClipboard() tea.Cmd {
+	m.offer = ""
+	if m.readsTerminal() {
+		m.showPasteError(ErrPasteTerminal)
+		return nil
+	}
+	clipboard, state := m.clipboard, m.state
+	return func() tea.Msg {
+		text, err := clipboard.Read()
+		return clipboardPasteMsg{state: state, text: text, err: err}
+	}
+}
+
+// pasteClipboard feeds the clipboard to the focused field as a bracketed
+// paste. Text that would not fit is refused whole rather than cut at the
+// field's limit, which is what a terminal paste silently does. A read that
+// finishes after its screen was left is dropped.
+func (m Model) pasteClipboard(msg clipboardPasteMsg) (tea.Model, tea.Cmd) {
+	if msg.state != m.state || !m.canPaste() {
+		return m, nil
+	}
+
+	text, err := strings.TrimRight(msg.text, "\r\n"), msg.err
+	if err == nil && text == "" {
+		err = ErrClipboardEmpty
+	}
+	n := utf8.RuneCountInString(text)
+	if limit, used := m.pasteLimit(); err == nil && limit > 0 && n > limit-used {
+		err = fmt.Errorf("%w: %d characters, room for %d", ErrPasteTooLong, n, limit-used)
+	}
+	if err != nil {
+		m.showPasteError(err)
+		return m, nil
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text), Paste: true})
+	pasted := updated.(Model)
+	pasted.notice = fmt.Sprintf("Pasted %d characters from the clipboard", n)
+	return pasted, cmd
+}
+
+func (m *Model) pasteLimit() (limit, used int) {
+	switch m.state {
+	case StateEnterText:
+		return m.textArea.CharLimit, m.textArea.Length()
+	case StateVaultEdit:
+		field := m.vault.form[m.vault.focus]
+		return field.CharLimit, utf8.RuneCountInString(field.Value())
+	default:
+		return m.textInput.CharLimit, utf8.RuneCountInString(m.textInput.Value())
+	}
+}
+
+// showPasteError puts err where the screen shows errors.
+func (m *Model) showPasteError(err error) {
+	if m.state == StateVaultEdit {
+		m.vault.formErr = err
+		return
+	}
+	m.clipboardErr = err
+}
+
+// clipboardPreview shows the first and last characters of text with its
+// whitespace collapsed.
+func clipboardPreview(text string) string {
+	const edge = 12
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= 2*edge+1 {
+		return string(runes)
+	}
+	return string(runes[:edge]) + "…" + string(runes[len(runes)-edge:])
+}
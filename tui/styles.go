@@ -24,79 +24,122 @@ const (
 	IndicatorPadding     = 1
 )
 
-var (
-	AppStyle = lipgloss.NewStyle().
+type Theme struct {
+	Primary    lipgloss.Color
+	Success    lipgloss.Color
+	Error      lipgloss.Color
+	Warning    lipgloss.Color
+	Info       lipgloss.Color
+	Muted      lipgloss.Color
+	Background lipgloss.Color
+	Foreground lipgloss.Color
+}
+
+func DefaultTheme() Theme {
+	return Theme{
+		Primary:    PrimaryColor,
+		Success:    SuccessColor,
+		Error:      ErrorColor,
+		Warning:    WarningColor,
+		Info:       InfoColor,
+		Muted:      MutedColor,
+		Background: BackgroundColor,
+		Foreground: ForegroundColor,
+	}
+}
+
+type Styles struct {
+	App  lipgloss.Style
+	Logo lipgloss.Style
+
+	ListPrompt       lipgloss.Style
+	ListItem         lipgloss.Style
+	SelectedListItem lipgloss.Style
+	Help             lipgloss.Style
+
+	TextInput lipgloss.Style
+
+	Result  lipgloss.Style
+	Warning lipgloss.Style
+	Error   lipgloss.Style
+	Code    lipgloss.Style
+
+	CapsIndicator   lipgloss.Style
+	KoreanIndicator lipgloss.Style
+	StatusIndicator lipgloss.Style
+}
+
+func NewStyles(theme Theme) Styles {
+	baseIndicator := lipgloss.NewStyle().
+		Padding(0, IndicatorPadding).
+		Bold(true).
+		MarginRight(1)
+
+	return Styles{
+		App: lipgloss.NewStyle().
 			Padding(AppPaddingVertical, AppPaddingHorizontal).
-			Margin(AppMarginVertical, AppMarginHorizontal)
+			Margin(AppMarginVertical, AppMarginHorizontal),
 
-	LogoStyle = lipgloss.NewStyle().
-			Foreground(PrimaryColor).
+		Logo: lipgloss.NewStyle().
+			Foreground(theme.Primary).
 			Bold(true).
-			MarginBottom(1)
-)
+			MarginBottom(1),
 
-var (
-	ListPromptStyle = lipgloss.NewStyle().
+		ListPrompt: lipgloss.NewStyle().
 			Foreground(WhiteColor).
 			Bold(true).
-			MarginBottom(1)
+			MarginBottom(1),
 
-	ListItemStyle = lipgloss.NewStyle().
-			Foreground(MutedColor).
-			MarginBottom(0)
+		ListItem: lipgloss.NewStyle().
+			Foreground(theme.Muted).
+			MarginBottom(0),
 
-	SelectedListItemStyle = lipgloss.NewStyle().
-				Foreground(WarningColor).
-				Bold(true).
-				MarginBottom(0)
+		SelectedListItem: lipgloss.NewStyle().
+			Foreground(theme.Warning).
+			Bold(true).
+			MarginBottom(0),
 
-	HelpStyle = lipgloss.NewStyle().
-			Foreground(MutedColor).
-			Italic(true)
-)
+		Help: lipgloss.NewStyle().
+			Foreground(theme.Muted).
+			Italic(true),
 
-var (
-	TextInputStyle = lipgloss.NewStyle().
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(PrimaryColor).
-		Padding(InputPadding, InputPadding*2).
-		MarginBottom(1)
-)
+		TextInput: lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(theme.Primary).
+			Padding(InputPadding, InputPadding*2).
+			MarginBottom(1),
 
-var (
-	ResultStyle = lipgloss.NewStyle().
-			Foreground(SuccessColor).
+		Result: lipgloss.NewStyle().
+			Foreground(theme.Success).
 			Bold(true).
-			MarginBottom(1)
+			MarginBottom(1),
 
-	ErrorStyle = lipgloss.NewStyle().
-			Foreground(ErrorColor).
+		Warning: lipgloss.NewStyle().
+			Foreground(theme.Warning).
+			Bold(true),
+
+		Error: lipgloss.NewStyle().
+			Foreground(theme.Error).
 			Bold(true).
-			MarginBottom(1)
+			MarginBottom(1),
 
-	CodeStyle = lipgloss.NewStyle().
-			Background(BackgroundColor).
-			Foreground(ForegroundColor).
+		Code: lipgloss.NewStyle().
+			Background(theme.Background).
+			Foreground(theme.Foreground).
 			Padding(InputPadding, InputPadding*2).
 			Border(lipgloss.RoundedBorder()).
-			BorderForeground(MutedColor)
-)
+			BorderForeground(theme.Muted),
 
-var (
-	baseIndicatorStyle = lipgloss.NewStyle().
-				Padding(0, IndicatorPadding).
-				Bold(true).
-				MarginRight(1)
-
-	CapsIndicatorStyle = baseIndicatorStyle.Copy().
-				Background(ErrorColor).
-				Foreground(WhiteColor)
-
-	KoreanIndicatorStyle = baseIndicatorStyle.Copy().
-				Background(InfoColor).
-				Foreground(WhiteColor)
-
-	StatusIndicatorStyle = baseIndicatorStyle.Copy().
-				Background(WarningColor).
-				Foreground(BlackColor)
-)
+		CapsIndicator: baseIndicator.
+			Background(theme.Error).
+			Foreground(WhiteColor),
+
+		KoreanIndicator: baseIndicator.
+			Background(theme.Info).
+			Foreground(WhiteColor),
+
+		StatusIndicator: baseIndicator.
+			Background(theme.Warning).
+			Foreground(BlackColor),
+	}
+}
@@ -3,6 +3,15 @@ package tui
 import (
 	"errors"
 	"fmt"
+	"os"
+	"time"
+	"txt-encdec-cli/config"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/filecrypt"
+	"txt-encdec-cli/platform"
+	"txt-encdec-cli/vault"
+
+	"github.com/charmbracelet/lipgloss"
 )
 
 type AppState int
@@ -10,10 +19,19 @@ type AppState int
 const (
 	StateSelectMode AppState = iota
 	StateEnterSecret
+	StateSelectKeyfile
+	StateSelectKeys
+	StateEnterContext
 	StateEnterText
 	StateShowResult
 	StateShowError
 	StateWaitingToClear
+	StateVaultList
+	StateVaultEdit
+	StateSelectFile
+	StateEnterOutput
+	StateFileProgress
+	StateDiagnostics
 )
 
 func (s AppState) String() string {
@@ -22,12 +40,30 @@ func (s AppState) String() string {
 		return "SelectMode"
 	case StateEnterSecret:
 		return "EnterSecret"
+	case StateSelectKeyfile:
+		return "SelectKeyfile"
+	case StateSelectKeys:
+		return "SelectKeys"
+	case StateEnterContext:
+		return "EnterContext"
 	case StateEnterText:
 		return "EnterText"
 	case StateShowResult:
 		return "ShowResult"
 	case StateShowError:
 		return "ShowError"
+	case StateVaultList:
+		return "VaultList"
+	case StateVaultEdit:
+		return "VaultEdit"
+	case StateSelectFile:
+		return "SelectFile"
+	case StateEnterOutput:
+		return "EnterOutput"
+	case StateFileProgress:
+		return "FileProgress"
+	case StateDiagnostics:
+		return "Diagnostics"
 	default:
 		return fmt.Sprintf("Unknown(%d)", int(s))
 	}
@@ -38,19 +74,90 @@ type OperationMode int
 const (
 	ModeEncrypt OperationMode = iota
 	ModeDecrypt
+	ModeEncryptRecipients
+	ModeDecryptIdentity
+	ModeVault
+	ModeEncryptFile
+	ModeDecryptFile
+	ModeDiagnostics
 )
 
+func (m OperationMode) UsesKeys() bool {
+	return m == ModeEncryptRecipients || m == ModeDecryptIdentity
+}
+
+func (m OperationMode) UsesFiles() bool {
+	return m == ModeEncryptFile || m == ModeDecryptFile
+}
+
 func (m OperationMode) String() string {
 	switch m {
 	case ModeEncrypt:
 		return "Encrypt"
 	case ModeDecrypt:
 		return "Decrypt"
+	case ModeEncryptRecipients:
+		return "Encrypt to recipients"
+	case ModeDecryptIdentity:
+		return "Decrypt with identity"
+	case ModeVault:
+		return "Vault"
+	case ModeEncryptFile:
+		return "Encrypt file"
+	case ModeDecryptFile:
+		return "Decrypt file"
+	case ModeDiagnostics:
+		return "Clipboard diagnostics"
 	default:
 		return fmt.Sprintf("Unknown(%d)", int(m))
 	}
 }
 
+type ModeOption struct {
+	Label     string
+	Mode      OperationMode
+	Algorithm core.AlgorithmID
+	Format    core.Format
+}
+
+func BuildModeOptions(defaultCipher core.AlgorithmID) []ModeOption {
+	encrypt := func(algorithm core.AlgorithmID) ModeOption {
+		return ModeOption{
+			Label:     fmt.Sprintf("%s (%s)", ModeEncrypt, algorithm),
+			Mode:      ModeEncrypt,
+			Algorithm: algorithm,
+		}
+	}
+
+	options := []ModeOption{encrypt(defaultCipher)}
+	for _, suite := range core.Suites() {
+		if suite.ID != defaultCipher {
+			options = append(options, encrypt(suite.ID))
+		}
+	}
+
+	return append(options,
+		ModeOption{Label: fmt.Sprintf("%s (%s)", ModeEncrypt, core.FormatAge), Mode: ModeEncrypt, Format: core.FormatAge},
+		ModeOption{Label: fmt.Sprintf("%s (%s, unauthenticated)", ModeEncrypt, core.FormatOpenSSL), Mode: ModeEncrypt, Format: core.FormatOpenSSL},
+		ModeOption{Label: ModeEncryptRecipients.String(), Mode: ModeEncryptRecipients, Algorithm: defaultCipher},
+		ModeOption{Label: fmt.Sprintf("%s (%s)", ModeEncryptRecipients, core.FormatAge), Mode: ModeEncryptRecipients, Format: core.FormatAge},
+		ModeOption{Label: ModeDecrypt.String(), Mode: ModeDecrypt},
+		ModeOption{Label: ModeDecryptIdentity.String(), Mode: ModeDecryptIdentity},
+		ModeOption{Label: ModeEncryptFile.String(), Mode: ModeEncryptFile, Algorithm: defaultCipher},
+		ModeOption{Label: ModeDecryptFile.String(), Mode: ModeDecryptFile},
+		ModeOption{Label: ModeVault.String(), Mode: ModeVault, Algorithm: defaultCipher},
+		ModeOption{Label: ModeDiagnostics.String(), Mode: ModeDiagnostics},
+	)
+}
+
+func ModeLabels(options []ModeOption) []string {
+	labels := make([]string, len(options))
+	for i, option := range options {
+		labels[i] = option.Label
+	}
+	return labels
+}
+
 type InputState struct {
 	CapsLockOn   bool
 	KoreanActive bool
@@ -60,6 +167,53 @@ func (s InputState) HasIndicators() bool {
 	return s.CapsLockOn || s.KoreanActive
 }
 
+type ResultInfo struct {
+	InputBytes  int
+	OutputBytes int
+	Format      core.Format
+	Envelope    *core.Envelope
+	Encoding    string
+	OpenSSL     core.OpenSSLParams
+}
+
+func (i ResultInfo) String() string {
+	sizes := fmt.Sprintf("%d bytes in , %d bytes out", i.InputBytes, i.OutputBytes)
+	switch i.Format {
+	case core.FormatAge:
+		return "age v1 , " + sizes
+	case core.FormatOpenSSL:
+		return fmt.Sprintf("openssl enc , %s , %s", i.OpenSSL, sizes)
+	}
+	if i.Envelope == nil {
+		return "legacy format , " + sizes
+	}
+	key := i.Envelope.KDF.ID.String()
+	if n := len(i.Envelope.Recipients); n > 0 {
+		key = fmt.Sprintf("%s (%d recipients)", key, n)
+	}
+	if i.Envelope.Context != "" {
+		key = fmt.Sprintf("%s , context %q", key, i.Envelope.Context)
+	}
+	if i.Envelope.Compression != core.CompressNone {
+		key = fmt.Sprintf("%s , %s", key, i.Envelope.Compression)
+	}
+	if i.Envelope.Padding != core.PadNone {
+		key = fmt.Sprintf("%s , %s padding", key, i.Envelope.Padding)
+	}
+	if i.Encoding != "" && i.Encoding != core.EncodingBase64 {
+		key = fmt.Sprintf("%s , %s", key, i.Encoding)
+	}
+	return fmt.Sprintf("envelope v%d , %s , %s , %s", i.Envelope.Version, i.Envelope.Algorithm, key, sizes)
+}
+
+// Warning flags results whose format cannot detect tampering.
+func (i ResultInfo) Warning() string {
+	if i.Format == core.FormatOpenSSL {
+		return "Unauthenticated: openssl enc cannot detect tampering"
+	}
+	return ""
+}
+
 type TerminalSize struct {
 	Width  int
 	Height int
@@ -76,16 +230,120 @@ type AppConfig struct {
 	DefaultHeight    int
 	InputCharLimit   int
 	MinTerminalWidth int
+
+	MinTextAreaHeight int
+	MaxTextAreaHeight int
+	TextCharLimit     int
+	TextMaxLines      int
+
+	Clipboard     platform.ClipboardOptions
+	Cipher        core.AlgorithmID
+	Armor         bool
+	Encoding      string
+	KDF           core.KDFParams
+	OpenSSL       core.OpenSSLParams
+	Packing       core.Packing
+	KeyStoreDir   string
+	Keyfiles      []string
+	Challenge     string
+	KeyfileDir    string
+	FileDir       string
+	VaultPath     string
+	VaultAutoLock time.Duration
+	Theme         Theme
+	Keys          KeyBindings
 }
 
 func DefaultConfig() AppConfig {
+	return AppConfigFrom(config.Default())
+}
+
+func AppConfigFrom(cfg config.Config) AppConfig {
+	kdf, _ := cfg.KDFParams()
+	packing, _ := cfg.PackingParams()
+	cipher, err := core.AlgorithmByName(cfg.Cipher)
+	if err != nil {
+		cipher = core.AlgAES256GCM
+	}
+	l := cfg.Layout
+	t := cfg.Theme
+
 	return AppConfig{
-		MinInputWidth:    50,
-		MaxInputWidth:    100,
-		DefaultWidth:     80,
-		DefaultHeight:    24,
-		InputCharLimit:   1024,
-		MinTerminalWidth: 66,
+		MinInputWidth:     l.MinInputWidth,
+		MaxInputWidth:     l.MaxInputWidth,
+		DefaultWidth:      l.DefaultWidth,
+		DefaultHeight:     l.DefaultHeight,
+		InputCharLimit:    l.InputCharLimit,
+		MinTerminalWidth:  l.MinTerminalWidth,
+		MinTextAreaHeight: l.MinTextAreaHeight,
+		MaxTextAreaHeight: l.MaxTextAreaHeight,
+		TextCharLimit:     l.TextCharLimit,
+		TextMaxLines:      l.TextMaxLines,
+
+		Clipboard:     cfg.ClipboardOptions(),
+		Cipher:        cipher,
+		Armor:         cfg.Armor,
+		Encoding:      cfg.Encoding,
+		KDF:           kdf,
+		OpenSSL:       cfg.OpenSSLParams(),
+		Packing:       packing,
+		KeyStoreDir:   cfg.KeyStoreDir(),
+		Keyfiles:      cfg.Secret.Keyfiles,
+		Challenge:     cfg.Secret.Challenge,
+		KeyfileDir:    cfg.KeyfileDir(),
+		FileDir:       workingDir(),
+		VaultPath:     cfg.VaultPath(),
+		VaultAutoLock: cfg.Vault.AutoLock,
+		Theme: Theme{
+			Primary:    lipgloss.Color(t.Primary),
+			Success:    lipgloss.Color(t.Success),
+			Error:      lipgloss.Color(t.Error),
+			Warning:    lipgloss.Color(t.Warning),
+			Info:       lipgloss.Color(t.Info),
+			Muted:      lipgloss.Color(t.Muted),
+			Background: lipgloss.Color(t.Background),
+			Foreground: lipgloss.Color(t.Foreground),
+		},
+		Keys: KeyBindings{
+			Submit:   cfg.Keys.Submit,
+			Reveal:   cfg.Keys.Reveal,
+			CopyAll:  cfg.Keys.CopyAll,
+			CopyLine: cfg.Keys.CopyLine,
+			Encoding: cfg.Keys.Encoding,
+			Keyfile:  cfg.Keys.Keyfile,
+			Paste:    cfg.Keys.Paste,
+		},
+	}
+}
+
+// workingDir is where the file picker starts.
+func workingDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return dir
+}
+
+type KeyBindings struct {
+	Submit   string
+	Reveal   string
+	CopyAll  string
+	CopyLine string
+	Encoding string
+	Keyfile  string
+	Paste    string
+}
+
+func DefaultKeyBindings() KeyBindings {
+	return KeyBindings{
+		Submit:   "ctrl+d",
+		Reveal:   "r",
+		CopyAll:  "c",
+		CopyLine: "y",
+		Encoding: "e",
+		Keyfile:  "ctrl+o",
+		Paste:    "ctrl+v",
 	}
 }
 
@@ -109,4 +367,73 @@ var (
 	ErrInvalidState     = errors.New("invalid application state")
 	ErrInvalidOperation = errors.New("invalid operation")
 	ErrEmptyInput       = errors.New("input cannot be empty")
+	ErrNoKeys           = errors.New("no keys in the key store")
+	ErrClipboardEmpty   = errors.New("clipboard is empty")
+	ErrPasteTooLong     = errors.New("clipboard text does not fit")
+	ErrPasteTerminal    = errors.New("OSC 52 cannot be read while the TUI runs; paste with the terminal")
+
+	ErrPassphraseMismatch = errors.New("passphrases do not match")
 )
+
+func ErrorHint(err error) string {
+	switch {
+	case errors.Is(err, core.ErrUnknownVersion):
+		return "The ciphertext was produced by a newer version of this tool"
+	case errors.Is(err, core.ErrTruncatedHeader):
+		return "The ciphertext header is incomplete; check that the whole text was pasted"
+	case errors.Is(err, core.ErrUnsupportedAlgorithm):
+		return "The ciphertext uses an algorithm this build does not support"
+	case errors.Is(err, core.ErrUnsupportedKDF), errors.Is(err, core.ErrInvalidKDF):
+		return "The ciphertext carries key derivation parameters this build will not use"
+	case errors.Is(err, core.ErrUnsupportedPacking):
+		return "The ciphertext was compressed or padded in a way this build does not support"
+	case errors.Is(err, core.ErrKeyfile):
+		return "Keyfiles must be readable and not empty; the same files are needed to decrypt"
+	case errors.Is(err, core.ErrChallengeResponse):
+		return "Check secret.challenge in the config file and that the token is present"
+	case errors.Is(err, ErrPassphraseMismatch):
+		return "Type the same master passphrase twice to create the vault"
+	case errors.Is(err, vault.ErrCorruptVault):
+		return "The vault decrypted but its contents are damaged; restore it from a backup"
+	case errors.Is(err, filecrypt.ErrExists):
+		return "Choose another output path, or confirm overwriting it"
+	case errors.Is(err, filecrypt.ErrOutputInInput):
+		return "Write the encrypted archive outside the directory being encrypted"
+	case errors.Is(err, filecrypt.ErrUnsupportedFile):
+		return "Only regular files, directories and symlinks can be encrypted"
+	case errors.Is(err, filecrypt.ErrInvalidArchive):
+		return "The file decrypted but does not hold a usable archive"
+	case errors.Is(err, core.ErrTruncatedStream):
+		return "The encrypted file is incomplete; copy it again"
+	case errors.Is(err, core.ErrNotStream):
+		return "Only files written by 'Encrypt file' can be decrypted here; paste text with 'Decrypt'"
+	case errors.Is(err, ErrNoKeys):
+		return "Run 'enc keygen' to create an identity, or 'enc keys add' to import a recipient"
+	case errors.Is(err, core.ErrRecipientEnvelope):
+		return "Choose 'Decrypt with identity' for ciphertext encrypted to recipients"
+	case errors.Is(err, core.ErrPassphraseEnvelope):
+		return "Choose 'Decrypt' and enter the secret key"
+	case errors.Is(err, core.ErrNoMatchingIdentity):
+		return "The ciphertext was not encrypted to this identity"
+	case errors.Is(err, core.ErrContextMismatch):
+		return "The ciphertext belongs to another context; check the label, or leave it empty to accept any"
+	case errors.Is(err, core.ErrInvalidContext):
+		return "Context labels are a single line of text, at most 255 bytes"
+	case errors.Is(err, core.ErrContextUnsupported):
+		return "Only native envelopes carry a context label; leave it empty"
+	case errors.Is(err, core.ErrDamagedArmor):
+		return "The armored text was altered in transit; copy it again, BEGIN to END line"
+	case errors.Is(err, core.ErrInvalidOpenSSL):
+		return "Check the [openssl] section of the config file"
+	case errors.Is(err, core.ErrInvalidBase64):
+		return "The input is not valid base64"
+	case errors.Is(err, core.ErrInvalidEncoding):
+		return "The input is not valid text in any supported encoding; check the reported position"
+	case errors.Is(err, core.ErrDecryptionFailed):
+		return "Wrong secret key, or the ciphertext was modified"
+	case errors.Is(err, core.ErrInvalidCiphertext):
+		return "The ciphertext is too short or malformed"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,361 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+	"txt-encdec-cli/vault"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// vaultLockMsg asks whether session has been idle long enough to lock.
+type vaultLockMsg struct {
+	session *vaultSession
+}
+
+var vaultFieldLabels = []string{"Name", "Secret", "Tags (comma separated)", "Notes"}
+
+const (
+	vaultFieldName = iota
+	vaultFieldSecret
+	vaultFieldTags
+	vaultFieldNotes
+)
+
+// vaultSession is an unlocked vault. It outlives returns to mode
+// selection, so the master passphrase is asked for once until it locks.
+type vaultSession struct {
+	vault      *vault.Vault
+	lastActive time.Time
+
+	entries  []vault.Entry
+	cursor   int
+	deleting bool
+	err      error
+
+	form    []textinput.Model
+	focus   int
+	editing string
+	formErr error
+}
+
+// pendingVault is a vault whose file does not exist yet, held until the
+// master passphrase has been typed a second time.
+type pendingVault struct {
+	vault  *vault.Vault
+	secret string
+}
+
+func (m *Model) openVault() tea.Cmd {
+	if m.vault != nil {
+		m.transitionToVaultList()
+		return textinput.Blink
+	}
+	m.transitionToSecretEntry()
+	return textinput.Blink
+}
+
+// unlockVault opens the vault with the native cryptor for secret; it is
+// bound to vault.Context, so only that cryptor can read it. A vault that
+// does not exist yet is only created once secret has been repeated.
+func (m *Model) unlockVault(secret string) tea.Cmd {
+	if p := m.newVault; p != nil {
+		m.newVault = nil
+		if secret != p.secret {
+			m.state = StateShowError
+			m.lastError = ErrPassphraseMismatch
+			return nil
+		}
+		return m.startVaultSession(p.vault)
+	}
+
+	cryptor, ok := m.newCryptor(secret, m.algorithm).(core.ContextCryptor)
+	if !ok {
+		m.state = StateShowError
+		m.lastError = core.ErrContextUnsupported
+		return nil
+	}
+
+	v, err := vault.Open(m.config.VaultPath, cryptor)
+	if err != nil {
+		m.state = StateShowError
+		m.lastError = err
+		return nil
+	}
+	if !v.Exists() {
+		m.newVault = &pendingVault{vault: v, secret: secret}
+		m.transitionToSecretEntry()
+		m.notice = "No vault file yet; repeat the passphrase to create it"
+		return textinput.Blink
+	}
+	return m.startVaultSession(v)
+}
+
+func (m *Model) startVaultSession(v *vault.Vault) tea.Cmd {
+	m.vault = &vaultSession{vault: v, lastActive: time.Now()}
+	m.transitionToVaultList()
+	return tea.Batch(textinput.Blink, m.scheduleVaultLock(m.config.VaultAutoLock))
+}
+
+func (m *Model) scheduleVaultLock(after time.Duration) tea.Cmd {
+	if after <= 0 {
+		return nil
+	}
+	session := m.vault
+	return tea.Tick(after, func(time.Time) tea.Msg {
+		return vaultLockMsg{session: session}
+	})
+}
+
+// handleVaultLock locks an idle session or checks again when it would
+// next expire. Ticks for a session that was already locked are dropped.
+func (m *Model) handleVaultLock(msg vaultLockMsg) tea.Cmd {
+	if m.vault == nil || msg.session != m.vault {
+		return nil
+	}
+	if remaining := m.config.VaultAutoLock - time.Since(m.vault.lastActive); remaining > 0 {
+		return m.scheduleVaultLock(remaining)
+	}
+	m.lockVault()
+	return nil
+}
+
+// touchVault records a key press. A session that expired before its tick
+// arrived is locked instead, and the key is reported as consumed when it
+// was meant for a vault screen.
+func (m *Model) touchVault() bool {
+	if m.vault == nil {
+		return true
+	}
+	if lock := m.config.VaultAutoLock; lock > 0 && time.Since(m.vault.lastActive) >= lock {
+		inVault := m.state == StateVaultList || m.state == StateVaultEdit
+		m.lockVault()
+		return !inVault
+	}
+	m.vault.lastActive = time.Now()
+	return true
+}
+
+// lockVault forgets the decrypted entries, leaving the vault screens.
+func (m *Model) lockVault() {
+	inVault := m.state == StateVaultList || m.state == StateVaultEdit
+	m.vault = nil
+	if inVault {
+		m.resetToModeSelection()
+	}
+}
+
+func (m *Model) transitionToVaultList() {
+	m.state = StateVaultList
+	m.vault.deleting = false
+	m.vault.err = nil
+	m.textInput.Prompt = ""
+	m.textInput.EchoMode = textinput.EchoNormal
+	m.textInput.Reset()
+	m.textInput.Focus()
+	m.filterVault()
+}
+
+// filterVault reapplies the search query, keeping the cursor in range.
+func (m *Model) filterVault() {
+	m.vault.entries = m.vault.vault.Search(m.textInput.Value())
+	m.vault.cursor = min(m.vault.cursor, max(len(m.vault.entries)-1, 0))
+}
+
+func (m *Model) selectedVaultEntry() (vault.Entry, bool) {
+	if len(m.vault.entries) == 0 {
+		return vault.Entry{}, false
+	}
+	return m.vault.entries[m.vault.cursor], true
+}
+
+func (m *Model) handleVaultList(msg tea.KeyMsg) tea.Cmd {
+	s := m.vault
+	deleting := s.deleting
+	s.deleting = false
+	s.err = nil
+	m.notice = ""
+	m.clipboardErr = nil
+
+	switch msg.String() {
+	case "esc":
+		return m.resetToModeSelection()
+	case "ctrl+l":
+		m.lockVault()
+	case "up":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down":
+		if s.cursor < len(s.entries)-1 {
+			s.cursor++
+		}
+	case "enter":
+		if e, ok := m.selectedVaultEntry(); ok {
+			return m.copyResult(e.Secret, fmt.Sprintf("Secret of %s copied to %s", e.Name, m.clipboardTarget()))
+		}
+	case "ctrl+n":
+		m.transitionToVaultEdit(vault.Entry{}, "")
+		return textinput.Blink
+	case "ctrl+e":
+		if e, ok := m.selectedVaultEntry(); ok {
+			m.transitionToVaultEdit(e, e.Name)
+			return textinput.Blink
+		}
+	case "ctrl+x":
+		e, ok := m.selectedVaultEntry()
+		if !ok {
+			break
+		}
+		if !deleting {
+			s.deleting = true
+			break
+		}
+		if err := s.vault.Delete(e.Name); err != nil {
+			s.err = err
+		}
+		m.filterVault()
+	}
+	return nil
+}
+
+func (m *Model) transitionToVaultEdit(e vault.Entry, editing string) {
+	m.state = StateVaultEdit
+	m.textInput.Blur()
+
+	values := []string{e.Name, e.Secret, strings.Join(e.Tags, ", "), e.Notes}
+	form := make([]textinput.Model, len(values))
+	for i, value := range values {
+		form[i] = textinput.New()
+		form[i].Prompt = ""
+		form[i].CharLimit = m.config.InputCharLimit
+		form[i].SetValue(value)
+	}
+	form[vaultFieldSecret].EchoMode = textinput.EchoPassword
+	form[vaultFieldSecret].EchoCharacter = '*'
+	form[vaultFieldName].Focus()
+
+	s := m.vault
+	s.form = form
+	s.focus = vaultFieldName
+	s.editing = editing
+	s.formErr = nil
+}
+
+func (m *Model) handleVaultEdit(msg tea.KeyMsg) tea.Cmd {
+	s := m.vault
+	switch msg.String() {
+	case "esc":
+		m.transitionToVaultList()
+		return textinput.Blink
+	case m.config.Keys.Submit:
+		return m.saveVaultEntry()
+	case "enter":
+		if s.focus == len(s.form)-1 {
+			return m.saveVaultEntry()
+		}
+		m.focusVaultField(s.focus + 1)
+	case "tab", "down":
+		m.focusVaultField((s.focus + 1) % len(s.form))
+	case "shift+tab", "up":
+		m.focusVaultField((s.focus + len(s.form) - 1) % len(s.form))
+	}
+	return nil
+}
+
+func (m *Model) focusVaultField(i int) {
+	s := m.vault
+	s.form[s.focus].Blur()
+	s.focus = i
+	s.form[s.focus].Focus()
+}
+
+func (m *Model) saveVaultEntry() tea.Cmd {
+	s := m.vault
+	e := vault.Entry{
+		Name:   s.form[vaultFieldName].Value(),
+		Secret: s.form[vaultFieldSecret].Value(),
+		Tags:   vault.ParseTags(s.form[vaultFieldTags].Value()),
+		Notes:  s.form[vaultFieldNotes].Value(),
+	}
+
+	var err error
+	if s.editing == "" {
+		err = s.vault.Add(e)
+	} else {
+		err = s.vault.Update(s.editing, e)
+	}
+	if err != nil {
+		s.formErr = err
+		return nil
+	}
+
+	m.transitionToVaultList()
+	m.notice = fmt.Sprintf("Saved %s", strings.TrimSpace(e.Name))
+	return textinput.Blink
+}
+
+func (m *Model) updateVaultForm(msg tea.Msg) tea.Cmd {
+	s := m.vault
+	var cmd tea.Cmd
+	s.form[s.focus], cmd = s.form[s.focus].Update(msg)
+	return cmd
+}
+
+func (m *Model) vaultItems() []string {
+	items := make([]string, len(m.vault.entries))
+	for i, e := range m.vault.entries {
+		items[i] = e.Name
+		if len(e.Tags) > 0 {
+			items[i] += "  [" + strings.Join(e.Tags, ", ") + "]"
+		}
+	}
+	return items
+}
+
+func (m *Model) vaultDetails() string {
+	e, ok := m.selectedVaultEntry()
+	if !ok {
+		return ""
+	}
+	details := "updated " + e.Updated.Local().Format(time.DateTime)
+	if e.Notes != "" {
+		details = e.Notes + " , " + details
+	}
+	return details
+}
+
+func (m *Model) viewVault() string {
+	s := m.vault
+	inputWidth := m.layout.CalculateInputWidth(m.terminalSize)
+
+	if m.state == StateVaultEdit {
+		fields := make([]string, len(s.form))
+		for i := range s.form {
+			s.form[i].Width = inputWidth
+			fields[i] = m.layout.CreateStyledInput(s.form[i].View(), inputWidth)
+		}
+		title := "New Vault Entry:"
+		if s.editing != "" {
+			title = fmt.Sprintf("Edit %s:", s.editing)
+		}
+		helpText := fmt.Sprintf("tab/up/down: field , enter: next , %s: save , esc: cancel", m.config.Keys.Submit)
+		return m.layout.RenderVaultForm(title, vaultFieldLabels, fields, s.focus, s.formErr, helpText)
+	}
+
+	m.textInput.Width = inputWidth
+	searchView := m.layout.CreateStyledInput(m.textInput.View(), inputWidth)
+
+	var warning string
+	if e, ok := m.selectedVaultEntry(); ok && s.deleting {
+		warning = fmt.Sprintf("Press ctrl+x again to delete %s", e.Name)
+	}
+	err := s.err
+	if err == nil && m.clipboardErr != nil {
+		err = fmt.Errorf("clipboard: %w", m.clipboardErr)
+	}
+	return m.layout.RenderVaultList(searchView, m.vaultItems(), s.cursor, m.vaultDetails(), warning, m.notice, err)
+}
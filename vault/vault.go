@@ -0,0 +1,257 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"txt-encdec-cli/core"
+)
+
+const (
+	FileName = "vault.tedc"
+
+	// Context is the label every vault file is bound to, so a vault and a
+	// pasted message can never be mistaken for one another.
+	Context = "txt-encdec-cli/vault"
+
+	formatVersion = 1
+)
+
+var (
+	ErrEntryExists   = errors.New("vault entry already exists")
+	ErrEntryNotFound = errors.New("vault entry not found")
+	ErrInvalidEntry  = errors.New("invalid vault entry")
+	ErrCorruptVault  = errors.New("vault contents are unreadable")
+)
+
+type Entry struct {
+	Name    string    `json:"name"`
+	Secret  string    `json:"secret"`
+	Tags    []string  `json:"tags,omitempty"`
+	Notes   string    `json:"notes,omitempty"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Matches reports whether every word of query occurs, ignoring case, in
+// the name, a tag or the notes. Secrets are never searched.
+func (e Entry) Matches(query string) bool {
+	text := strings.ToLower(strings.Join(append([]string{e.Name, e.Notes}, e.Tags...), "\n"))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+type contents struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Vault is a single encrypted file of named entries. It is decrypted once
+// on Open and rewritten in full, through the same cryptor, on every change.
+type Vault struct {
+	Path string
+
+	// Now stamps entries as they are added and updated.
+	Now func() time.Time
+
+	cryptor core.ContextCryptor
+	entries []Entry
+	exists  bool
+}
+
+// Open decrypts the vault at path. A missing file opens an empty vault
+// that is created by the first change; callers should confirm the
+// passphrase first, since nothing checks it until then.
+func Open(path string, cryptor core.ContextCryptor) (*Vault, error) {
+	v := &Vault{Path: path, Now: time.Now, cryptor: cryptor}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := cryptor.DecryptWithContext(string(data), Context)
+	if err != nil {
+		return nil, err
+	}
+
+	var c contents
+	if err := json.Unmarshal([]byte(plaintext), &c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptVault, err)
+	}
+	if c.Version != formatVersion {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrCorruptVault, c.Version)
+	}
+	sortEntries(c.Entries)
+	v.entries = c.Entries
+	v.exists = true
+	return v, nil
+}
+
+// Exists reports whether the vault file was there when it was opened or
+// has been written since.
+func (v *Vault) Exists() bool {
+	return v.exists
+}
+
+// Entries returns the entries sorted by name.
+func (v *Vault) Entries() []Entry {
+	return slices.Clone(v.entries)
+}
+
+func (v *Vault) Search(query string) []Entry {
+	var found []Entry
+	for _, e := range v.entries {
+		if e.Matches(query) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func (v *Vault) Get(name string) (Entry, error) {
+	i := v.index(name)
+	if i < 0 {
+		return Entry{}, fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	return v.entries[i], nil
+}
+
+func (v *Vault) Add(e Entry) error {
+	e, err := normalize(e)
+	if err != nil {
+		return err
+	}
+	if v.index(e.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrEntryExists, e.Name)
+	}
+
+	e.Created = v.Now().UTC()
+	e.Updated = e.Created
+	return v.save(append(slices.Clone(v.entries), e))
+}
+
+// Update replaces the entry called name, which e may rename.
+func (v *Vault) Update(name string, e Entry) error {
+	i := v.index(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	e, err := normalize(e)
+	if err != nil {
+		return err
+	}
+	if j := v.index(e.Name); j >= 0 && j != i {
+		return fmt.Errorf("%w: %s", ErrEntryExists, e.Name)
+	}
+
+	e.Created = v.entries[i].Created
+	e.Updated = v.Now().UTC()
+	entries := slices.Clone(v.entries)
+	entries[i] = e
+	return v.save(entries)
+}
+
+func (v *Vault) Delete(name string) error {
+	i := v.index(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrEntryNotFound, name)
+	}
+	return v.save(slices.Delete(slices.Clone(v.entries), i, i+1))
+}
+
+func (v *Vault) index(name string) int {
+	return slices.IndexFunc(v.entries, func(e Entry) bool { return e.Name == name })
+}
+
+// save writes entries and only then makes them current, so a failed write
+// leaves the vault as it was on disk.
+func (v *Vault) save(entries []Entry) error {
+	sortEntries(entries)
+
+	data, err := json.Marshal(contents{Version: formatVersion, Entries: entries})
+	if err != nil {
+		return err
+	}
+	encrypted, err := v.cryptor.EncryptWithContext(string(data), Context)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(v.Path, []byte(encrypted+"\n")); err != nil {
+		return err
+	}
+
+	v.entries = entries
+	v.exists = true
+	return nil
+}
+
+func sortEntries(entries []Entry) {
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Name, b.Name) })
+}
+
+// writeFile replaces path atomically with a 0600 file.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".vault-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ParseTags splits comma-separated tags, dropping blanks and duplicates.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func normalize(e Entry) (Entry, error) {
+	e.Name = strings.TrimSpace(e.Name)
+	switch {
+	case e.Name == "":
+		return e, fmt.Errorf("%w: name is empty", ErrInvalidEntry)
+	case strings.ContainsAny(e.Name, "\r\n"):
+		return e, fmt.Errorf("%w: name must be a single line", ErrInvalidEntry)
+	case e.Secret == "":
+		return e, fmt.Errorf("%w: secret is empty", ErrInvalidEntry)
+	}
+	e.Tags = ParseTags(strings.Join(e.Tags, ","))
+	return e, nil
+}
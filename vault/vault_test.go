@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"txt-encdec-cli/core"
+)
+
+var testKDF = core.KDFParams{ID: core.KDFScrypt, LogN: 10, R: 8, P: 1}
+
+func newTestVault(t *testing.T, path, secret string) *Vault {
+	t.Helper()
+	v, err := Open(path, core.NewCryptor(secret, core.AlgAES256GCM, testKDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", FileName)
+	v := newTestVault(t, path, "master")
+	if len(v.Entries()) != 0 || v.Exists() {
+		t.Fatal("new vault is not empty")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("opening a missing vault created it: %v", err)
+	}
+
+	created := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	v.Now = func() time.Time { return created }
+	if err := v.Add(Entry{Name: " db ", Secret: "hunter2", Tags: []string{"prod", " prod", "sql"}, Notes: "primary"}); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Exists() {
+		t.Fatal("Exists is false after the first save")
+	}
+	if err := v.Add(Entry{Name: "api", Secret: "tok"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Add(Entry{Name: "db", Secret: "again"}); !errors.Is(err, ErrEntryExists) {
+		t.Fatalf("Add duplicate = %v, want %v", err, ErrEntryExists)
+	}
+
+	v.Now = func() time.Time { return created.Add(time.Hour) }
+	if err := v.Update("db", Entry{Name: "db-prod", Secret: "hunter3", Tags: []string{"prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("vault file mode = %v, want 0600", perm)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter3") {
+		t.Fatal("vault file contains a plaintext secret")
+	}
+
+	reopened := newTestVault(t, path, "master")
+	entries := reopened.Entries()
+	if len(entries) != 2 || entries[0].Name != "api" || entries[1].Name != "db-prod" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	e := entries[1]
+	if e.Secret != "hunter3" || !e.Created.Equal(created) || !e.Updated.Equal(created.Add(time.Hour)) {
+		t.Fatalf("updated entry = %+v", e)
+	}
+
+	if err := reopened.Delete("api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("api"); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("Get deleted = %v, want %v", err, ErrEntryNotFound)
+	}
+
+	if _, err := Open(path, core.NewCryptor("wrong", core.AlgAES256GCM, testKDF)); !errors.Is(err, core.ErrDecryptionFailed) {
+		t.Fatalf("Open with wrong passphrase = %v, want %v", err, core.ErrDecryptionFailed)
+	}
+}
+
+func TestVaultRejectsMessages(t *testing.T) {
+	c := core.NewCryptor("master", core.AlgAES256GCM, testKDF)
+	message, err := c.Encrypt(`{"version":1,"entries":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(message), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, c); !errors.Is(err, core.ErrContextMismatch) {
+		t.Fatalf("Open of a plain message = %v, want %v", err, core.ErrContextMismatch)
+	}
+}
+
+func TestOpenSortsEntries(t *testing.T) {
+	c := core.NewCryptor("master", core.AlgAES256GCM, testKDF)
+	encrypted, err := c.EncryptWithContext(`{"version":1,"entries":[{"name":"zeta","secret":"z"},{"name":"alpha","secret":"a"}]}`, Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte(encrypted), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := Open(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := v.Entries(); len(entries) != 2 || entries[0].Name != "alpha" || !v.Exists() {
+		t.Fatalf("entries = %+v, exists = %v", entries, v.Exists())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	v := newTestVault(t, filepath.Join(t.TempDir(), FileName), "master")
+	for _, e := range []Entry{
+		{Name: "GitHub", Secret: "s1", Tags: []string{"work"}, Notes: "2fa recovery"},
+		{Name: "bank", Secret: "github", Notes: "savings"},
+		{Name: "laptop", Secret: "s3", Tags: []string{"work", "disk"}},
+	} {
+		if err := v.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"":            "GitHub bank laptop",
+		"github":      "GitHub",
+		"WORK":        "GitHub laptop",
+		"work disk":   "laptop",
+		"recovery 2f": "GitHub",
+		"nothing":     "",
+	} {
+		var names []string
+		for _, e := range v.Search(query) {
+			names = append(names, e.Name)
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("Search(%q) = %q, want %q", query, got, want)
+		}
+	}
+}